@@ -6,6 +6,7 @@
 package u2f
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/sha256"
 	"encoding/asn1"
@@ -15,11 +16,12 @@ import (
 )
 
 // SignRequest creates a request to initiate an authentication.
+// Registrations with the same fingerprint are only listed once.
 func (c *Challenge) SignRequest(regs []Registration) *WebSignRequest {
 	var sr WebSignRequest
 	sr.AppID = c.AppID
 	sr.Challenge = encodeBase64(c.Challenge)
-	for _, r := range regs {
+	for _, r := range uniqueRegistrations(regs) {
 		rk := getRegisteredKey(c.AppID, r)
 		sr.RegisteredKeys = append(sr.RegisteredKeys, rk)
 	}
@@ -38,8 +40,41 @@ var ErrCounterTooLow = errors.New("u2f: counter too low")
 // (i.e. resp.KeyHandle).
 // The latest counter value is returned, which the caller should store.
 func (reg *Registration) Authenticate(resp SignResponse, c Challenge, counter uint32) (newCounter uint32, err error) {
+	return reg.AuthenticateContext(context.Background(), resp, c, counter, nil)
+}
+
+// AuthenticateWithConfig calls AuthenticateContext with the background
+// context.
+func (reg *Registration) AuthenticateWithConfig(resp SignResponse, c Challenge, counter uint32, config *Config) (newCounter uint32, err error) {
+	return reg.AuthenticateContext(context.Background(), resp, c, counter, config)
+}
+
+// AuthenticateContext is Authenticate with a context and a Config, which may
+// be nil. The config's Events hook, if any, receives the outcome and the
+// context. An error is returned if the context is done.
+func (reg *Registration) AuthenticateContext(ctx context.Context, resp SignResponse, c Challenge, counter uint32, config *Config) (newCounter uint32, err error) {
+	e := config.newEvent(ctx, CeremonyAuthenticate, ProtocolU2F, c)
+	if err = ctx.Err(); err == nil {
+		newCounter, err = reg.authenticate(resp, c, counter)
+	}
+	if e != nil {
+		e.Origin = clientDataOrigin(resp.ClientData)
+		e.CounterBefore = counter
+		e.CounterAfter = newCounter
+		config.emit(ctx, e, reg, err)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return newCounter, nil
+}
+
+// authenticate returns the token's counter if the response's signature
+// verified, even if the response fails to validate otherwise, and zero if
+// it didn't.
+func (reg *Registration) authenticate(resp SignResponse, c Challenge, counter uint32) (uint32, error) {
 	if time.Now().Sub(c.Timestamp) > timeout {
-		return 0, errors.New("u2f: challenge has expired")
+		return 0, ErrChallengeExpired
 	}
 	if resp.KeyHandle != encodeBase64(reg.KeyHandle) {
 		return 0, errors.New("u2f: wrong key handle")
@@ -60,11 +95,7 @@ func (reg *Registration) Authenticate(resp SignResponse, c Challenge, counter ui
 		return 0, err
 	}
 
-	if ar.Counter < counter {
-		return 0, ErrCounterTooLow
-	}
-
-	if err := verifyClientData(clientData, c); err != nil {
+	if err := VerifyClientData(clientData, c); err != nil {
 		return 0, err
 	}
 
@@ -73,12 +104,49 @@ func (reg *Registration) Authenticate(resp SignResponse, c Challenge, counter ui
 	}
 
 	if !ar.UserPresenceVerified {
-		return 0, errors.New("u2f: user was not present")
+		return ar.Counter, ErrUserNotPresent
+	}
+
+	// The counter is checked after the signature, so that forged responses
+	// can't be mistaken for cloned tokens.
+	if ar.Counter < counter {
+		return ar.Counter, ErrCounterTooLow
 	}
 
 	return ar.Counter, nil
 }
 
+// SignatureData is the decoded form of an authentication response message as
+// defined by the FIDO U2F Raw Message Formats specification.
+type SignatureData struct {
+	// Flags is the user presence byte.
+	Flags   byte
+	Counter uint32
+
+	// Signature is the DER encoded signature.
+	Signature []byte
+}
+
+// UserPresent reports whether the token verified the user's presence.
+func (sd *SignatureData) UserPresent() bool {
+	return sd.Flags&1 == 1
+}
+
+// ParseSignatureData decodes an authentication response message, i.e. the
+// decoded SignatureData field of a SignResponse. The signature is not
+// verified.
+func ParseSignatureData(data []byte) (*SignatureData, error) {
+	ar, err := parseSignResponse(data)
+	if err != nil {
+		return nil, err
+	}
+	return &SignatureData{
+		Flags:     ar.raw[0],
+		Counter:   ar.Counter,
+		Signature: append([]byte(nil), data[len(ar.raw):]...),
+	}, nil
+}
+
 type ecdsaSig struct {
 	R, S *big.Int
 }
@@ -118,18 +186,40 @@ func parseSignResponse(sd []byte) (*authResp, error) {
 	return &ar, nil
 }
 
+// Verify checks the signature as defined by the FIDO U2F Raw Message Formats
+// specification. appParam is the SHA-256 hash of the AppID and
+// challengeParam the SHA-256 hash of the client data. Protocols that reuse
+// the U2F signature format, such as OpenSSH security keys, hash other data
+// instead. User presence and the counter are not checked.
+func (sd *SignatureData) Verify(pubKey *ecdsa.PublicKey, appParam, challengeParam [32]byte) error {
+	var sig ecdsaSig
+	rest, err := asn1.Unmarshal(sd.Signature, &sig)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.New("u2f: trailing data")
+	}
+
+	header := []byte{sd.Flags, byte(sd.Counter >> 24), byte(sd.Counter >> 16), byte(sd.Counter >> 8), byte(sd.Counter)}
+	return verifySignature(pubKey, appParam, header, challengeParam, sig)
+}
+
 func verifyAuthSignature(ar authResp, pubKey *ecdsa.PublicKey, appID string, clientData []byte) error {
 	appParam := sha256.Sum256([]byte(appID))
 	challenge := sha256.Sum256(clientData)
+	return verifySignature(pubKey, appParam, ar.raw, challenge, ar.sig)
+}
 
+func verifySignature(pubKey *ecdsa.PublicKey, appParam [32]byte, header []byte, challenge [32]byte, sig ecdsaSig) error {
 	var buf []byte
 	buf = append(buf, appParam[:]...)
-	buf = append(buf, ar.raw...)
+	buf = append(buf, header...)
 	buf = append(buf, challenge[:]...)
 	hash := sha256.Sum256(buf)
 
-	if !ecdsa.Verify(pubKey, hash[:], ar.sig.R, ar.sig.S) {
-		return errors.New("u2f: invalid signature")
+	if !ecdsa.Verify(pubKey, hash[:], sig.R, sig.S) {
+		return ErrInvalidSignature
 	}
 
 	return nil
@@ -0,0 +1,292 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+/*
+Package client implements the client side of the FIDO U2F protocol: the role
+played by the browser between the relying party and the token.
+
+A Client answers the WebRegisterRequest and WebSignRequest messages created
+by the u2f package with the RegisterResponse and SignResponse messages it
+verifies, by exchanging raw U2F messages with a Device.
+
+	dev, _ := ctaphid.Open(hidDevice)
+	c := &client.Client{Device: dev, Origin: "https://example.com"}
+	resp, err := c.Sign(req)
+*/
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/ctap1"
+)
+
+const u2fVersion = "U2F_V2"
+
+const (
+	typRegister = "navigator.id.finishEnrollment"
+	typSign     = "navigator.id.getAssertion"
+)
+
+const (
+	defaultPollInterval = 200 * time.Millisecond
+	defaultTimeout      = 30 * time.Second
+)
+
+// ErrAlreadyRegistered is returned by Register when the token already holds
+// one of the request's registered keys.
+var ErrAlreadyRegistered = errors.New("client: token is already registered")
+
+// ErrNoMatchingKey is returned by Sign when the token holds none of the
+// request's registered keys.
+var ErrNoMatchingKey = errors.New("client: token holds no registered key")
+
+// ErrTimeout is returned when the user does not confirm their presence in
+// time.
+var ErrTimeout = errors.New("client: timed out waiting for user presence")
+
+// Device sends raw U2F request messages to a token and returns the raw
+// response messages. *ctaphid.Device and *softtoken.Token implement Device.
+type Device interface {
+	Message(apdu []byte) ([]byte, error)
+}
+
+// Client produces responses to U2F requests using a token.
+type Client struct {
+	Device Device
+
+	// Origin is the facet ID of the client, e.g. https://example.com.
+	Origin string
+
+	// ChannelID is the TLS Channel ID public key to include in the client
+	// data. It is omitted if nil.
+	ChannelID *u2f.JwkKey
+
+	// PollInterval is the delay between attempts while waiting for the
+	// user to touch the token. It defaults to 200ms.
+	PollInterval time.Duration
+
+	// Timeout is how long to wait for the user to touch the token. It
+	// defaults to 30s.
+	Timeout time.Duration
+}
+
+// clientData is u2f.ClientData with an optional cid_pubkey.
+type clientData struct {
+	Typ       string      `json:"typ"`
+	Challenge string      `json:"challenge"`
+	Origin    string      `json:"origin"`
+	CIDPubKey *u2f.JwkKey `json:"cid_pubkey,omitempty"`
+}
+
+// Register enrols the token, asking the user to touch it.
+func (c *Client) Register(req *u2f.WebRegisterRequest) (*u2f.RegisterResponse, error) {
+	var rr *u2f.RegisterRequest
+	for i := range req.RegisterRequests {
+		if req.RegisterRequests[i].Version == u2fVersion {
+			rr = &req.RegisterRequests[i]
+			break
+		}
+	}
+	if rr == nil {
+		return nil, errors.New("client: no supported register request")
+	}
+
+	appID := c.appID(req.AppID)
+	for _, rk := range req.RegisteredKeys {
+		if rk.Version != u2fVersion {
+			continue
+		}
+		ok, err := c.check(c.keyAppID(appID, rk), rk.KeyHandle)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return nil, ErrAlreadyRegistered
+		}
+	}
+
+	cd, err := c.clientData(typRegister, rr.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	r := ctap1.RegisterRequest{
+		Challenge:   sha256.Sum256(cd),
+		Application: sha256.Sum256([]byte(appID)),
+	}
+	regData, err := c.waitForPresence(r.Command())
+	if err != nil {
+		return nil, err
+	}
+
+	return &u2f.RegisterResponse{
+		Version:          u2fVersion,
+		RegistrationData: encodeBase64(regData),
+		ClientData:       encodeBase64(cd),
+	}, nil
+}
+
+// Sign authenticates with the first of the request's registered keys that
+// the token holds, asking the user to touch it.
+func (c *Client) Sign(req *u2f.WebSignRequest) (*u2f.SignResponse, error) {
+	appID := c.appID(req.AppID)
+	for _, rk := range req.RegisteredKeys {
+		if rk.Version != u2fVersion {
+			continue
+		}
+		keyAppID := c.keyAppID(appID, rk)
+		ok, err := c.check(keyAppID, rk.KeyHandle)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		cd, err := c.clientData(typSign, req.Challenge)
+		if err != nil {
+			return nil, err
+		}
+		kh, err := decodeBase64(rk.KeyHandle)
+		if err != nil {
+			return nil, err
+		}
+
+		r := ctap1.AuthenticateRequest{
+			Control:     ctap1.ControlEnforceUserPresence,
+			Challenge:   sha256.Sum256(cd),
+			Application: sha256.Sum256([]byte(keyAppID)),
+			KeyHandle:   kh,
+		}
+		cmd, err := r.Command()
+		if err != nil {
+			return nil, err
+		}
+		sigData, err := c.waitForPresence(cmd)
+		if err != nil {
+			return nil, err
+		}
+
+		return &u2f.SignResponse{
+			KeyHandle:     rk.KeyHandle,
+			SignatureData: encodeBase64(sigData),
+			ClientData:    encodeBase64(cd),
+		}, nil
+	}
+	return nil, ErrNoMatchingKey
+}
+
+// appID returns the AppID to use for a request. As in browsers, an empty
+// AppID defaults to the origin.
+func (c *Client) appID(appID string) string {
+	if appID == "" {
+		return c.Origin
+	}
+	return appID
+}
+
+func (c *Client) keyAppID(appID string, rk u2f.RegisteredKey) string {
+	if rk.AppID != "" {
+		return rk.AppID
+	}
+	return appID
+}
+
+// check reports whether the token created the key handle for the
+// application, using a check-only authentication request.
+func (c *Client) check(appID, keyHandle string) (bool, error) {
+	kh, err := decodeBase64(keyHandle)
+	if err != nil {
+		return false, err
+	}
+	r := ctap1.AuthenticateRequest{
+		Control:     ctap1.ControlCheckOnly,
+		Application: sha256.Sum256([]byte(appID)),
+		KeyHandle:   kh,
+	}
+	cmd, err := r.Command()
+	if err != nil {
+		// Key handles longer than 255 bytes can't belong to the token.
+		return false, nil
+	}
+
+	resp, err := c.exchange(cmd)
+	if err != nil {
+		return false, err
+	}
+	switch resp.SW {
+	case ctap1.SWConditionsNotSatisfied:
+		return true, nil
+	case ctap1.SWWrongData:
+		return false, nil
+	}
+	return false, resp.Err()
+}
+
+// waitForPresence repeats a request until the user touches the token.
+func (c *Client) waitForPresence(cmd *ctap1.Command) ([]byte, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	interval := c.PollInterval
+	if interval == 0 {
+		interval = defaultPollInterval
+	}
+	deadline := time.Now().Add(timeout)
+
+	for {
+		resp, err := c.exchange(cmd)
+		if err != nil {
+			return nil, err
+		}
+		if resp.SW != ctap1.SWConditionsNotSatisfied {
+			if err := resp.Err(); err != nil {
+				return nil, err
+			}
+			return resp.Data, nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return nil, ErrTimeout
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (c *Client) exchange(cmd *ctap1.Command) (*ctap1.Response, error) {
+	req, err := cmd.MarshalExtended()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Device.Message(req)
+	if err != nil {
+		return nil, err
+	}
+	return ctap1.ParseResponse(resp)
+}
+
+func (c *Client) clientData(typ, challenge string) ([]byte, error) {
+	return json.Marshal(clientData{
+		Typ:       typ,
+		Challenge: challenge,
+		Origin:    c.Origin,
+		CIDPubKey: c.ChannelID,
+	})
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func encodeBase64(buf []byte) string {
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
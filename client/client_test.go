@@ -0,0 +1,146 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/ctap1"
+	"github.com/tstranex/u2f/softtoken"
+)
+
+const appID = "https://example.com"
+
+// slowDevice makes the user touch the token after a number of requests
+// that enforce user presence.
+type slowDevice struct {
+	token   *softtoken.Token
+	touches int
+}
+
+func (d *slowDevice) Message(req []byte) ([]byte, error) {
+	cmd, err := ctap1.ParseCommand(req)
+	if err != nil {
+		return nil, err
+	}
+	enforce := cmd.INS == ctap1.InsRegister ||
+		cmd.INS == ctap1.InsAuthenticate && cmd.P1 == ctap1.ControlEnforceUserPresence
+	if enforce && d.touches > 0 {
+		d.touches--
+		resp := ctap1.Response{SW: ctap1.SWConditionsNotSatisfied}
+		return resp.Marshal(), nil
+	}
+	return d.token.Message(req)
+}
+
+func newClient(t *testing.T) (*Client, *softtoken.Token) {
+	token := softtoken.NewTest(t)
+	return &Client{Device: token, Origin: appID, PollInterval: time.Millisecond}, token
+}
+
+func TestRegisterAndSign(t *testing.T) {
+	c, token := newClient(t)
+	slow := &slowDevice{token: token, touches: 3}
+	c.Device = slow
+
+	ch, _ := u2f.NewChallenge(appID, []string{appID})
+	regResp, err := c.Register(u2f.NewWebRegisterRequest(ch, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slow.touches != 0 {
+		t.Errorf("register did not wait for user presence")
+	}
+	reg, err := u2f.Register(*regResp, *ch, &u2f.Config{SkipAttestationVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, otherReg := softtoken.Enrol(t, appID)
+
+	slow.touches = 3
+	ch, _ = u2f.NewChallenge(appID, []string{appID})
+	resp, err := c.Sign(ch.SignRequest([]u2f.Registration{*otherReg, *reg}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slow.touches != 0 {
+		t.Errorf("sign did not wait for user presence")
+	}
+	if resp.KeyHandle != ch.SignRequest([]u2f.Registration{*reg}).RegisteredKeys[0].KeyHandle {
+		t.Errorf("signed with the wrong key handle")
+	}
+
+	counter, err := reg.Authenticate(*resp, *ch, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counter != 1 {
+		t.Errorf("unexpected counter: %d", counter)
+	}
+}
+
+func TestClientData(t *testing.T) {
+	c, _ := newClient(t)
+	c.ChannelID = &u2f.JwkKey{KTy: "EC", Crv: "P-256", X: "x", Y: "y"}
+
+	ch, _ := u2f.NewChallenge(appID, []string{appID})
+	resp, err := c.Register(u2f.NewWebRegisterRequest(ch, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := decodeBase64(resp.ClientData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cd u2f.ClientData
+	if err := json.Unmarshal(buf, &cd); err != nil {
+		t.Fatal(err)
+	}
+	if cd.Typ != typRegister || cd.Origin != appID || cd.Challenge != encodeBase64(ch.Challenge) {
+		t.Errorf("unexpected client data: %s", buf)
+	}
+	var jwk u2f.JwkKey
+	if err := json.Unmarshal(cd.CIDPubKey, &jwk); err != nil || jwk.X != "x" {
+		t.Errorf("unexpected cid_pubkey: %s", cd.CIDPubKey)
+	}
+}
+
+func TestAlreadyRegistered(t *testing.T) {
+	c, token := newClient(t)
+	reg := token.Enrol(t, appID)
+
+	ch, _ := u2f.NewChallenge(appID, []string{appID})
+	if _, err := c.Register(u2f.NewWebRegisterRequest(ch, []u2f.Registration{*reg})); err != ErrAlreadyRegistered {
+		t.Errorf("expected ErrAlreadyRegistered, got %v", err)
+	}
+}
+
+func TestNoMatchingKey(t *testing.T) {
+	c, _ := newClient(t)
+	_, reg := softtoken.Enrol(t, appID)
+
+	ch, _ := u2f.NewChallenge(appID, []string{appID})
+	if _, err := c.Sign(ch.SignRequest([]u2f.Registration{*reg})); err != ErrNoMatchingKey {
+		t.Errorf("expected ErrNoMatchingKey, got %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	c, token := newClient(t)
+	reg := token.Enrol(t, appID)
+
+	token.UserNotPresent = true
+	c.Timeout = 10 * time.Millisecond
+	ch, _ := u2f.NewChallenge(appID, []string{appID})
+	if _, err := c.Sign(ch.SignRequest([]u2f.Registration{*reg})); err != ErrTimeout {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+}
@@ -0,0 +1,320 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Command u2f-audit re-verifies logged U2F authentications, for incident
+// response.
+//
+// It reads events as JSON lines from the named file, or standard input.
+// Each event holds a stored registration, the challenge that was issued and
+// the SignResponse that answered it:
+//
+//	{
+//	  "id": "login-1234",
+//	  "registration": "<base64 of Registration.MarshalBinary>",
+//	  "challenge": <u2f.Challenge as JSON>,
+//	  "response": <u2f.SignResponse as JSON>,
+//	  "counter": 41
+//	}
+//
+// The optional counter is the counter that was stored for the registration
+// before the authentication.
+//
+// For each event it reports whether the key handle, signature, origin,
+// challenge, counter and user presence were valid, using the same checks as
+// Registration.Authenticate. The origin and challenge are checked
+// independently. The challenge's expiry is not checked. The counter must not be lower than the event's stored counter,
+// as in Registration.Authenticate, and must be higher than the counter of any
+// earlier event in the log for the same registration, as identified by its
+// fingerprint.
+//
+// The exit status is 1 if any event fails verification.
+//
+// Usage:
+//
+//	u2f-audit [-json] [file]
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/tstranex/u2f"
+)
+
+// maxLineSize bounds the size of a single event.
+const maxLineSize = 1 << 20
+
+type event struct {
+	ID           string           `json:"id"`
+	Registration []byte           `json:"registration"`
+	Challenge    u2f.Challenge    `json:"challenge"`
+	Response     u2f.SignResponse `json:"response"`
+	Counter      *uint32          `json:"counter,omitempty"`
+}
+
+// check is the outcome of one verification step.
+type check struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// result is the verification report of one event.
+type result struct {
+	Line        int              `json:"line"`
+	ID          string           `json:"id,omitempty"`
+	Fingerprint *u2f.Fingerprint `json:"fingerprint,omitempty"`
+	OK          bool             `json:"ok"`
+	Error       string           `json:"error,omitempty"`
+	Checks      []check          `json:"checks,omitempty"`
+}
+
+func (r *result) add(name string, err error, detail string) {
+	c := check{Name: name, OK: err == nil, Detail: detail}
+	if err != nil {
+		c.Detail = err.Error()
+		r.OK = false
+	}
+	r.Checks = append(r.Checks, c)
+}
+
+// auditor verifies a sequence of events, remembering the last counter seen
+// for each registration.
+type auditor struct {
+	counters map[u2f.Fingerprint]lastCounter
+}
+
+type lastCounter struct {
+	counter uint32
+	id      string
+	line    int
+}
+
+func main() {
+	jsonOutput := flag.Bool("json", false, "write the report as JSON lines")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [file]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(0)
+
+	var r io.Reader
+	switch flag.NArg() {
+	case 0:
+		r = os.Stdin
+	case 1:
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		r = f
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	failed, err := audit(os.Stdout, r, *jsonOutput)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// audit verifies the events read from r and writes the report to w. It
+// returns the number of events that failed verification.
+func audit(w io.Writer, r io.Reader, jsonOutput bool) (int, error) {
+	a := &auditor{counters: make(map[u2f.Fingerprint]lastCounter)}
+	enc := json.NewEncoder(w)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	var line, total, failed int
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		res := a.verify(line, []byte(text))
+		total++
+		if !res.OK {
+			failed++
+		}
+		if jsonOutput {
+			if err := enc.Encode(res); err != nil {
+				return failed, err
+			}
+		} else {
+			printResult(w, res)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return failed, fmt.Errorf("line %d: %v", line+1, err)
+	}
+
+	if !jsonOutput {
+		fmt.Fprintf(w, "%d events, %d failed\n", total, failed)
+	}
+	return failed, nil
+}
+
+func (a *auditor) verify(line int, text []byte) *result {
+	res := &result{Line: line, OK: true}
+
+	var ev event
+	if err := json.Unmarshal(text, &ev); err != nil {
+		res.OK = false
+		res.Error = fmt.Sprintf("invalid event: %v", err)
+		return res
+	}
+	res.ID = ev.ID
+
+	var reg u2f.Registration
+	if err := reg.UnmarshalBinary(ev.Registration); err != nil {
+		res.OK = false
+		res.Error = fmt.Sprintf("invalid registration: %v", err)
+		return res
+	}
+	fingerprint := reg.Fingerprint()
+	res.Fingerprint = &fingerprint
+	sigData, err := decodeBase64(ev.Response.SignatureData)
+	if err != nil {
+		res.OK = false
+		res.Error = fmt.Sprintf("invalid signatureData: %v", err)
+		return res
+	}
+	sd, err := u2f.ParseSignatureData(sigData)
+	if err != nil {
+		res.OK = false
+		res.Error = fmt.Sprintf("invalid signatureData: %v", err)
+		return res
+	}
+	clientData, err := decodeBase64(ev.Response.ClientData)
+	if err != nil {
+		res.OK = false
+		res.Error = fmt.Sprintf("invalid clientData: %v", err)
+		return res
+	}
+	var cd u2f.ClientData
+	if err := json.Unmarshal(clientData, &cd); err != nil {
+		res.OK = false
+		res.Error = fmt.Sprintf("invalid clientData: %v", err)
+		return res
+	}
+
+	res.add("key handle", checkKeyHandle(encodeBase64(reg.KeyHandle), ev.Response.KeyHandle), "")
+	sigErr := sd.Verify(&reg.PubKey, sha256.Sum256([]byte(ev.Challenge.AppID)), sha256.Sum256(clientData))
+	res.add("signature", sigErr, "")
+	res.add("origin", checkOrigin(cd.Origin, ev.Challenge), cd.Origin)
+	res.add("challenge", u2f.VerifyChallenge(cd.Challenge, ev.Challenge), "")
+	detail, err := a.checkCounter(fingerprint, sd.Counter, ev, line, sigErr == nil)
+	res.add("counter", err, detail)
+	var presenceErr error
+	if !sd.UserPresent() {
+		presenceErr = u2f.ErrUserNotPresent
+	}
+	res.add("user presence", presenceErr, "")
+
+	return res
+}
+
+func checkKeyHandle(kh, respKH string) error {
+	if strings.TrimRight(respKH, "=") != kh {
+		return errors.New("response is for another key handle")
+	}
+	return nil
+}
+
+// checkOrigin checks the origin as u2f.VerifyOrigin does, reporting the
+// origin on failure.
+func checkOrigin(origin string, c u2f.Challenge) error {
+	if err := u2f.VerifyOrigin(origin, c); err != nil {
+		return fmt.Errorf("%w %q", err, origin)
+	}
+	return nil
+}
+
+// checkCounter checks the counter against the event's stored counter and
+// the last counter seen in the log for the registration. If record is set, the
+// counter becomes the last one seen; only counters of authentic responses
+// are recorded so that a forged event can't mask later ones.
+func (a *auditor) checkCounter(fingerprint u2f.Fingerprint, counter uint32, ev event, line int, record bool) (string, error) {
+	detail := fmt.Sprintf("%d", counter)
+	if ev.Counter != nil {
+		if counter < *ev.Counter {
+			return "", fmt.Errorf("%d is lower than the stored counter %d", counter, *ev.Counter)
+		}
+		detail += fmt.Sprintf(", stored %d", *ev.Counter)
+	}
+
+	last, seen := a.counters[fingerprint]
+	if seen && counter <= last.counter {
+		return "", fmt.Errorf("%d is not higher than %d in %s", counter, last.counter, last.describe())
+	}
+	if record {
+		a.counters[fingerprint] = lastCounter{counter: counter, id: ev.ID, line: line}
+	}
+	if seen {
+		detail += fmt.Sprintf(", previous %d in %s", last.counter, last.describe())
+	}
+	return detail, nil
+}
+
+func (l lastCounter) describe() string {
+	if l.id != "" {
+		return fmt.Sprintf("event %s", l.id)
+	}
+	return fmt.Sprintf("line %d", l.line)
+}
+
+func printResult(w io.Writer, res *result) {
+	name := fmt.Sprintf("line %d", res.Line)
+	if res.ID != "" {
+		name = fmt.Sprintf("event %s (line %d)", res.ID, res.Line)
+	}
+	status := "OK"
+	if !res.OK {
+		status = "FAILED"
+	}
+	fmt.Fprintf(w, "%s: %s\n", name, status)
+	if res.Fingerprint != nil {
+		fmt.Fprintf(w, "  fingerprint: %s\n", res.Fingerprint)
+	}
+	if res.Error != "" {
+		fmt.Fprintf(w, "  error: %s\n", res.Error)
+	}
+	for _, c := range res.Checks {
+		status := "ok"
+		if !c.OK {
+			status = "FAILED"
+		}
+		if c.Detail != "" {
+			fmt.Fprintf(w, "  %s: %s (%s)\n", c.Name, status, c.Detail)
+		} else {
+			fmt.Fprintf(w, "  %s: %s\n", c.Name, status)
+		}
+	}
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func encodeBase64(buf []byte) string {
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
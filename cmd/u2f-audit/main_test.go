@@ -0,0 +1,176 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/client"
+	"github.com/tstranex/u2f/softtoken"
+)
+
+const appID = "https://example.com"
+
+type logger struct {
+	t      *testing.T
+	client *client.Client
+	reg    *u2f.Registration
+	blob   []byte
+	buf    bytes.Buffer
+}
+
+func newLogger(t *testing.T) *logger {
+	token, reg := softtoken.Enrol(t, appID)
+	c := &client.Client{Device: token, Origin: appID}
+	blob, err := reg.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &logger{t: t, client: c, reg: reg, blob: blob}
+}
+
+// sign authenticates and returns the logged event.
+func (l *logger) sign(id string) event {
+	ch, _ := u2f.NewChallenge(appID, []string{appID})
+	resp, err := l.client.Sign(ch.SignRequest([]u2f.Registration{*l.reg}))
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	return event{ID: id, Registration: l.blob, Challenge: *ch, Response: *resp}
+}
+
+func (l *logger) log(ev event) {
+	if err := json.NewEncoder(&l.buf).Encode(ev); err != nil {
+		l.t.Fatal(err)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	l := newLogger(t)
+
+	first := l.sign("first")
+	l.log(first)
+
+	// A replay of the first response against a new challenge.
+	replay := l.sign("replay")
+	replay.Response = first.Response
+	l.log(replay)
+
+	// A response from an untrusted origin.
+	phished := l.sign("phished")
+	phished.Challenge.TrustedFacets = []string{"https://other.example.com"}
+	l.log(phished)
+
+	// A counter lower than the one stored.
+	stored := l.sign("stored")
+	counter := uint32(100)
+	stored.Counter = &counter
+	l.log(stored)
+
+	l.buf.WriteString("\n{not json}\n")
+
+	var out bytes.Buffer
+	failed, err := audit(&out, &l.buf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed != 4 {
+		t.Errorf("expected 4 failed events, got %d", failed)
+	}
+
+	report := out.String()
+	for _, want := range []string{
+		"event first (line 1): OK\n",
+		"  fingerprint: " + l.reg.Fingerprint().String() + "\n",
+		"  counter: ok (1)\n",
+		"event replay (line 2): FAILED\n",
+		"  challenge: FAILED (u2f: challenge does not match)\n",
+		"  counter: FAILED (1 is not higher than 1 in event first)\n",
+		"event phished (line 3): FAILED\n",
+		"  origin: FAILED (u2f: untrusted facet id \"https://example.com\")\n",
+		"  challenge: ok\n",
+		"  counter: ok (3, previous 1 in event first)\n",
+		"event stored (line 4): FAILED\n",
+		"  counter: FAILED (4 is lower than the stored counter 100)\n",
+		"line 6: FAILED\n",
+		"5 events, 4 failed\n",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report does not contain %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestAuditForgedCounter(t *testing.T) {
+	l := newLogger(t)
+
+	// A forged event with a high counter must not make later authentic
+	// events fail.
+	forged := l.sign("forged")
+	sigData, _ := decodeBase64(forged.Response.SignatureData)
+	sigData[1] = 0xff
+	forged.Response.SignatureData = encodeBase64(sigData)
+	l.log(forged)
+	l.log(l.sign("genuine"))
+
+	var out bytes.Buffer
+	if _, err := audit(&out, &l.buf, true); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := json.NewDecoder(&out)
+	var results []result
+	for dec.More() {
+		var res result
+		if err := dec.Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, res)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].OK || results[0].Checks[1].Name != "signature" || results[0].Checks[1].OK {
+		t.Errorf("forged event passed: %+v", results[0])
+	}
+	if !results[1].OK {
+		t.Errorf("genuine event failed: %+v", results[1])
+	}
+}
+
+// TestAuditOriginAndChallenge checks that the origin and challenge are both
+// reported when both are wrong.
+func TestAuditOriginAndChallenge(t *testing.T) {
+	l := newLogger(t)
+	first := l.sign("first")
+	ev := l.sign("both")
+	ev.Response = first.Response
+	ev.Challenge.TrustedFacets = []string{"https://other.example.com"}
+	l.log(ev)
+
+	var out bytes.Buffer
+	if _, err := audit(&out, &l.buf, true); err != nil {
+		t.Fatal(err)
+	}
+	var res result
+	if err := json.Unmarshal(out.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	checks := make(map[string]check)
+	for _, c := range res.Checks {
+		checks[c.Name] = c
+	}
+	if c := checks["origin"]; c.OK || c.Detail != `u2f: untrusted facet id "https://example.com"` {
+		t.Errorf("unexpected origin check: %+v", c)
+	}
+	if c := checks["challenge"]; c.OK || c.Detail != "u2f: challenge does not match" {
+		t.Errorf("unexpected challenge check: %+v", c)
+	}
+}
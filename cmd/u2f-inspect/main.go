@@ -0,0 +1,386 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Command u2f-inspect decodes U2F registration and authentication data and
+// prints its structure, to help debug failing enrolments and
+// authentications.
+//
+// It reads from the named file, or standard input, one of:
+//
+//   - a RegisterResponse or SignResponse as JSON,
+//   - a registration blob as stored with Registration.MarshalBinary,
+//   - raw registration data, signature data or client data,
+//
+// where binary data may be hex or base64 encoded. The kind of input is
+// detected automatically unless -type is given.
+//
+// With -verify, responses are also verified against the challenge given
+// with -challenge and the AppID given with -appid. Verifying a SignResponse
+// requires the registration given with -reg. The challenge's expiry is not
+// checked.
+//
+// Usage:
+//
+//	u2f-inspect [flags] [file]
+package main
+
+import (
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tstranex/u2f"
+)
+
+type options struct {
+	typ         string
+	verify      bool
+	appID       string
+	challenge   string
+	facets      string
+	regFile     string
+	counter     uint
+	attestation bool
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.typ, "type", "auto", "input type: auto, register, sign, registration, regdata, sigdata or clientdata")
+	flag.BoolVar(&opts.verify, "verify", false, "verify the response against -challenge and -appid")
+	flag.StringVar(&opts.appID, "appid", "", "AppID to verify against")
+	flag.StringVar(&opts.challenge, "challenge", "", "base64url encoded challenge to verify against")
+	flag.StringVar(&opts.facets, "facets", "", "comma separated trusted facets (default: the AppID)")
+	flag.StringVar(&opts.regFile, "reg", "", "file holding the registration blob to verify a SignResponse with")
+	flag.UintVar(&opts.counter, "counter", 0, "last known counter when verifying a SignResponse")
+	flag.BoolVar(&opts.attestation, "attestation", false, "verify the attestation certificate against the bundled roots")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [file]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(0)
+
+	var input []byte
+	var err error
+	switch flag.NArg() {
+	case 0:
+		input, err = io.ReadAll(os.Stdin)
+	case 1:
+		input, err = os.ReadFile(flag.Arg(0))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := inspect(os.Stdout, input, &opts); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func inspect(w io.Writer, input []byte, opts *options) error {
+	typ := opts.typ
+	var data []byte
+	if typ == "auto" {
+		var err error
+		typ, data, err = detect(input)
+		if err != nil {
+			return err
+		}
+	} else if typ != "register" && typ != "sign" {
+		data = decodeBlob(input)
+	}
+
+	switch typ {
+	case "register":
+		var resp u2f.RegisterResponse
+		if err := json.Unmarshal(input, &resp); err != nil {
+			return err
+		}
+		return inspectRegisterResponse(w, resp, opts)
+	case "sign":
+		var resp u2f.SignResponse
+		if err := json.Unmarshal(input, &resp); err != nil {
+			return err
+		}
+		return inspectSignResponse(w, resp, opts)
+	case "registration":
+		var reg u2f.Registration
+		if err := reg.UnmarshalBinary(data); err != nil {
+			return err
+		}
+		printRegistration(w, &reg)
+		return nil
+	case "regdata":
+		return printRegistrationData(w, data)
+	case "sigdata":
+		return printSignatureData(w, data)
+	case "clientdata":
+		return printClientData(w, data)
+	}
+	return fmt.Errorf("unknown input type %q", typ)
+}
+
+// detect guesses the kind of input.
+func detect(input []byte) (string, []byte, error) {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(input, &fields) == nil {
+		switch {
+		case fields["registrationData"] != nil:
+			return "register", nil, nil
+		case fields["signatureData"] != nil:
+			return "sign", nil, nil
+		case fields["typ"] != nil:
+			return "clientdata", input, nil
+		}
+		return "", nil, errors.New("unrecognized JSON input")
+	}
+
+	data := decodeBlob(input)
+	switch {
+	case len(data) > 0 && data[0] == '{':
+		return "clientdata", data, nil
+	case len(data) > 0 && data[0] == 0x05:
+		// Registration blobs stored with MarshalBinary are usually the raw
+		// registration data.
+		return "regdata", data, nil
+	case len(data) > 0 && data[0] == 0x01 && isCompactRegistration(data):
+		// The compact encoding of registrations without raw data. Signature
+		// data with user presence can start with the same bytes.
+		return "registration", data, nil
+	case len(data) > 0 && data[0] <= 1:
+		return "sigdata", data, nil
+	}
+	return "", nil, errors.New("unrecognized input")
+}
+
+// isCompactRegistration reports whether data is a registration in the
+// compact encoding of Registration.MarshalBinary.
+func isCompactRegistration(data []byte) bool {
+	var reg u2f.Registration
+	return reg.UnmarshalBinary(data) == nil
+}
+
+// decodeBlob decodes hex or base64 encoded input, or returns binary input
+// unchanged.
+func decodeBlob(input []byte) []byte {
+	s := strings.TrimSpace(string(input))
+	if b, err := hex.DecodeString(s); err == nil {
+		return b
+	}
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding, base64.URLEncoding,
+		base64.RawStdEncoding, base64.RawURLEncoding,
+	} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b
+		}
+	}
+	return input
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func inspectRegisterResponse(w io.Writer, resp u2f.RegisterResponse, opts *options) error {
+	fmt.Fprintf(w, "RegisterResponse\n")
+	fmt.Fprintf(w, "  version: %s\n", resp.Version)
+
+	regData, err := decodeBase64(resp.RegistrationData)
+	if err != nil {
+		return fmt.Errorf("registrationData: %v", err)
+	}
+	clientData, err := decodeBase64(resp.ClientData)
+	if err != nil {
+		return fmt.Errorf("clientData: %v", err)
+	}
+	if err := printRegistrationData(w, regData); err != nil {
+		return err
+	}
+	if err := printClientData(w, clientData); err != nil {
+		return err
+	}
+
+	if opts.verify {
+		c, err := opts.newChallenge()
+		if err != nil {
+			return err
+		}
+		config := &u2f.Config{SkipAttestationVerify: !opts.attestation}
+		_, err = u2f.Register(resp, *c, config)
+		printVerification(w, err)
+	}
+	return nil
+}
+
+func inspectSignResponse(w io.Writer, resp u2f.SignResponse, opts *options) error {
+	fmt.Fprintf(w, "SignResponse\n")
+	kh, err := decodeBase64(resp.KeyHandle)
+	if err != nil {
+		return fmt.Errorf("keyHandle: %v", err)
+	}
+	fmt.Fprintf(w, "  key handle: %x (%d bytes)\n", kh, len(kh))
+
+	sigData, err := decodeBase64(resp.SignatureData)
+	if err != nil {
+		return fmt.Errorf("signatureData: %v", err)
+	}
+	clientData, err := decodeBase64(resp.ClientData)
+	if err != nil {
+		return fmt.Errorf("clientData: %v", err)
+	}
+	if err := printSignatureData(w, sigData); err != nil {
+		return err
+	}
+	if err := printClientData(w, clientData); err != nil {
+		return err
+	}
+
+	if opts.verify {
+		if opts.regFile == "" {
+			return errors.New("-verify of a SignResponse requires -reg")
+		}
+		buf, err := os.ReadFile(opts.regFile)
+		if err != nil {
+			return err
+		}
+		var reg u2f.Registration
+		if err := reg.UnmarshalBinary(decodeBlob(buf)); err != nil {
+			return fmt.Errorf("registration: %v", err)
+		}
+		c, err := opts.newChallenge()
+		if err != nil {
+			return err
+		}
+		newCounter, err := reg.Authenticate(resp, *c, uint32(opts.counter))
+		printVerification(w, err)
+		if err == nil {
+			fmt.Fprintf(w, "  new counter: %d\n", newCounter)
+		}
+	}
+	return nil
+}
+
+// newChallenge builds the challenge to verify against. Its timestamp is the
+// current time so that it never expires.
+func (opts *options) newChallenge() (*u2f.Challenge, error) {
+	if opts.appID == "" || opts.challenge == "" {
+		return nil, errors.New("-verify requires -appid and -challenge")
+	}
+	challenge, err := decodeBase64(opts.challenge)
+	if err != nil {
+		return nil, fmt.Errorf("challenge: %v", err)
+	}
+	facets := []string{opts.appID}
+	if opts.facets != "" {
+		facets = strings.Split(opts.facets, ",")
+	}
+	return &u2f.Challenge{
+		Challenge:     challenge,
+		Timestamp:     time.Now(),
+		AppID:         opts.appID,
+		TrustedFacets: facets,
+	}, nil
+}
+
+func printVerification(w io.Writer, err error) {
+	fmt.Fprintf(w, "Verification\n")
+	if err != nil {
+		fmt.Fprintf(w, "  result: FAILED: %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "  result: OK\n")
+}
+
+func printRegistrationData(w io.Writer, data []byte) error {
+	rd, err := u2f.ParseRegistrationData(data)
+	if err != nil {
+		return fmt.Errorf("registration data: %v", err)
+	}
+	fmt.Fprintf(w, "Registration data\n")
+	fmt.Fprintf(w, "  reserved byte: %#02x\n", data[0])
+	printKey(w, &rd.Registration)
+	printCert(w, &rd.Registration)
+	if rd.CertFixed {
+		fmt.Fprintf(w, "  certificate fixup: applied (known malformed certificate)\n")
+	}
+	fmt.Fprintf(w, "  signature: %x\n", rd.Signature)
+	return nil
+}
+
+func printRegistration(w io.Writer, reg *u2f.Registration) {
+	fmt.Fprintf(w, "Registration\n")
+	printKey(w, reg)
+	if reg.AttestationCert != nil {
+		printCert(w, reg)
+	}
+	if a := reg.Attestation; a != nil {
+		fmt.Fprintf(w, "  attestation summary:\n")
+		fmt.Fprintf(w, "    issuer: %s\n", a.Issuer)
+		fmt.Fprintf(w, "    trusted: %t\n", a.Trusted)
+		fmt.Fprintf(w, "    certificate sha256: %x\n", a.CertDigest)
+	}
+}
+
+func printKey(w io.Writer, reg *u2f.Registration) {
+	pubKey := elliptic.Marshal(reg.PubKey.Curve, reg.PubKey.X, reg.PubKey.Y)
+	fmt.Fprintf(w, "  public key: %x\n", pubKey)
+	fmt.Fprintf(w, "  key handle: %x (%d bytes)\n", reg.KeyHandle, len(reg.KeyHandle))
+	fmt.Fprintf(w, "  fingerprint: %s\n", reg.Fingerprint())
+}
+
+func printCert(w io.Writer, reg *u2f.Registration) {
+	cert := reg.AttestationCert
+	fp := sha256.Sum256(cert.Raw)
+	fmt.Fprintf(w, "  attestation certificate:\n")
+	fmt.Fprintf(w, "    subject: %s\n", cert.Subject)
+	fmt.Fprintf(w, "    issuer: %s\n", cert.Issuer)
+	fmt.Fprintf(w, "    serial: %s\n", cert.SerialNumber)
+	fmt.Fprintf(w, "    validity: %s to %s\n",
+		cert.NotBefore.UTC().Format(time.RFC3339), cert.NotAfter.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "    signature algorithm: %s\n", cert.SignatureAlgorithm)
+	fmt.Fprintf(w, "    public key algorithm: %s\n", cert.PublicKeyAlgorithm)
+	fmt.Fprintf(w, "    sha256: %x\n", fp)
+}
+
+func printSignatureData(w io.Writer, data []byte) error {
+	sd, err := u2f.ParseSignatureData(data)
+	if err != nil {
+		return fmt.Errorf("signature data: %v", err)
+	}
+	fmt.Fprintf(w, "Signature data\n")
+	fmt.Fprintf(w, "  user presence: %#02x (present: %t)\n", sd.Flags, sd.UserPresent())
+	fmt.Fprintf(w, "  counter: %d\n", sd.Counter)
+	fmt.Fprintf(w, "  signature: %x\n", sd.Signature)
+	return nil
+}
+
+func printClientData(w io.Writer, data []byte) error {
+	var cd u2f.ClientData
+	if err := json.Unmarshal(data, &cd); err != nil {
+		return fmt.Errorf("client data: %v", err)
+	}
+	fmt.Fprintf(w, "Client data\n")
+	fmt.Fprintf(w, "  typ: %s\n", cd.Typ)
+	fmt.Fprintf(w, "  challenge: %s\n", cd.Challenge)
+	fmt.Fprintf(w, "  origin: %s\n", cd.Origin)
+	if len(cd.CIDPubKey) > 0 {
+		fmt.Fprintf(w, "  cid_pubkey: %s\n", cd.CIDPubKey)
+	}
+	return nil
+}
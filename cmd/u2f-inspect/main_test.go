@@ -0,0 +1,136 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tstranex/u2f"
+)
+
+// Actual responses from a Yubikey with Chrome, as in the u2f package tests.
+const (
+	appID = "http://localhost:3483"
+
+	registerChallenge = "s4UJ3wkN80p4wLjyI2Guv-_a-s7LV54Ic9PAZvHo_lM"
+	regRespJSON       = "{\"registrationData\":\"BQTD17IP7bZ3Gcd7l5Ao4qqohsUcm0bcXgHLpn0pv2VWNl7SBtNFo0wEoAdMrHlFXGzJgQz_bRZaKXZfHyd3fAo0QJmZkSv9ZbTKz7TVO6jnOcKGrSHb15JDatMMFxHxN5BR56CE3sj10jtGOY7szQIi4RGU6kONIuriAarxuEFJ5IswggIcMIIBBqADAgECAgQk26tAMAsGCSqGSIb3DQEBCzAuMSwwKgYDVQQDEyNZdWJpY28gVTJGIFJvb3QgQ0EgU2VyaWFsIDQ1NzIwMDYzMTAgFw0xNDA4MDEwMDAwMDBaGA8yMDUwMDkwNDAwMDAwMFowKzEpMCcGA1UEAwwgWXViaWNvIFUyRiBFRSBTZXJpYWwgMTM1MDMyNzc4ODgwWTATBgcqhkjOPQIBBggqhkjOPQMBBwNCAAQCsJS-NH1HeUHEd46-xcpN7SpHn6oeb-w5r-veDCBwy1vUvWnJanjjv4dR_rV5G436ysKUAXUcsVe5fAnkORo2oxIwEDAOBgorBgEEAYLECgEBBAAwCwYJKoZIhvcNAQELA4IBAQCjY64OmDrzC7rxLIst81pZvxy7ShsPy2jEhFWEkPaHNFhluNsCacNG5VOITCxWB68OonuQrIzx70MfcqwYnbIcgkkUvxeIpVEaM9B7TI40ZHzp9h4VFqmps26QCkAgYfaapG4SxTK5k_lCPvqqTPmjtlS03d7ykkpUj9WZlVEN1Pf02aTVIZOHPHHJuH6GhT6eLadejwxtKDBTdNTv3V4UlvjDOQYQe9aL1jUNqtLDeBHso8pDvJMLc0CX3vadaI2UVQxM-xip4kuGouXYj0mYmaCbzluBDFNsrzkNyL3elg3zMMrKvAUhoYMjlX_-vKWcqQsgsQ0JtSMcWMJ-umeDMEQCIApTYovLr8citOpIKkyNidCQz7UeSOWNMlPBB-s3r4G9AiAskXkh7iale4QDe6a-675L3xzohYb8Fcvz3gH6dkDLvw\",\"version\":\"U2F_V2\",\"challenge\":\"s4UJ3wkN80p4wLjyI2Guv-_a-s7LV54Ic9PAZvHo_lM\",\"appId\":\"http://localhost:3483\",\"clientData\":\"eyJ0eXAiOiJuYXZpZ2F0b3IuaWQuZmluaXNoRW5yb2xsbWVudCIsImNoYWxsZW5nZSI6InM0VUozd2tOODBwNHdManlJMkd1di1fYS1zN0xWNTRJYzlQQVp2SG9fbE0iLCJvcmlnaW4iOiJodHRwOi8vbG9jYWxob3N0OjM0ODMiLCJjaWRfcHVia2V5IjoiIn0\"}"
+
+	signChallenge = "PzN6SGiUaeypErE3SCHeRlkRxVwfWlGVi35gfq6LsdY"
+	signRespJSON  = "{\"keyHandle\":\"mZmRK_1ltMrPtNU7qOc5woatIdvXkkNq0wwXEfE3kFHnoITeyPXSO0Y5juzNAiLhEZTqQ40i6uIBqvG4QUnkiw\",\"clientData\":\"eyJ0eXAiOiJuYXZpZ2F0b3IuaWQuZ2V0QXNzZXJ0aW9uIiwiY2hhbGxlbmdlIjoiUHpONlNHaVVhZXlwRXJFM1NDSGVSbGtSeFZ3ZldsR1ZpMzVnZnE2THNkWSIsIm9yaWdpbiI6Imh0dHA6Ly9sb2NhbGhvc3Q6MzQ4MyIsImNpZF9wdWJrZXkiOiIifQ\",\"signatureData\":\"AQAAAAYwRAIgBuyafOXoc9Q7fARcs2JbCZdtnMzVCyeJC-J-2Im1IBsCIDxkzmvPX9RCY8uts4wM1y4wEX9LmNH2Mz_VFd-JdyGE\"}"
+)
+
+func run(t *testing.T, input string, opts *options) string {
+	if opts.typ == "" {
+		opts.typ = "auto"
+	}
+	var buf bytes.Buffer
+	if err := inspect(&buf, []byte(input), opts); err != nil {
+		t.Fatalf("inspect error: %v", err)
+	}
+	return buf.String()
+}
+
+func expectLines(t *testing.T, out string, lines ...string) {
+	for _, line := range lines {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing %q in output:\n%s", line, out)
+		}
+	}
+}
+
+func TestInspectRegisterResponse(t *testing.T) {
+	out := run(t, regRespJSON, &options{verify: true, appID: appID, challenge: registerChallenge})
+	expectLines(t, out,
+		"  reserved byte: 0x05",
+		"  key handle: 9999912bfd65b4cacfb4d53ba8e739c286ad21dbd792436ad30c1711f1379051e7a084dec8f5d23b46398eeccd0222e11194ea438d22eae201aaf1b84149e48b (64 bytes)",
+		"    subject: CN=Yubico U2F EE Serial 13503277888",
+		"    issuer: CN=Yubico U2F Root CA Serial 457200631",
+		"  certificate fixup: applied (known malformed certificate)",
+		"  typ: navigator.id.finishEnrollment",
+		"  origin: http://localhost:3483",
+		"  result: OK",
+	)
+
+	out = run(t, regRespJSON, &options{verify: true, appID: appID, challenge: signChallenge})
+	expectLines(t, out, "  result: FAILED: u2f: challenge does not match")
+}
+
+// registrationBlob returns the registration as an application would store
+// it with MarshalBinary.
+func registrationBlob(t *testing.T) []byte {
+	var resp u2f.RegisterResponse
+	if err := json.Unmarshal([]byte(regRespJSON), &resp); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := decodeBase64(resp.RegistrationData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blob
+}
+
+func TestInspectSignResponse(t *testing.T) {
+	blob := registrationBlob(t)
+	regFile := filepath.Join(t.TempDir(), "reg")
+	if err := os.WriteFile(regFile, []byte(hex.EncodeToString(blob)), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := run(t, signRespJSON, &options{verify: true, appID: appID, challenge: signChallenge, regFile: regFile})
+	expectLines(t, out,
+		"  user presence: 0x01 (present: true)",
+		"  counter: 6",
+		"  typ: navigator.id.getAssertion",
+		"  result: OK",
+		"  new counter: 6",
+	)
+
+	out = run(t, signRespJSON, &options{verify: true, appID: appID, challenge: signChallenge, regFile: regFile, counter: 7})
+	expectLines(t, out, "  result: FAILED: u2f: counter too low")
+
+	// The stored registration blob is recognized too.
+	out = run(t, hex.EncodeToString(blob), &options{})
+	expectLines(t, out, "Registration data", "  reserved byte: 0x05")
+
+	// So is the compact encoding of a registration without raw data.
+	var reg u2f.Registration
+	if err := reg.UnmarshalBinary(blob); err != nil {
+		t.Fatal(err)
+	}
+	reg.Raw = nil
+	reg.AttestationCert = nil
+	compact, err := reg.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = run(t, hex.EncodeToString(compact), &options{})
+	expectLines(t, out, "Registration",
+		"  key handle: "+hex.EncodeToString(reg.KeyHandle)+" (64 bytes)",
+		"  fingerprint: "+reg.Fingerprint().String(),
+	)
+}
+
+func TestInspectRawData(t *testing.T) {
+	out := run(t, "AQAAAAYwRAIgBuyafOXoc9Q7fARcs2JbCZdtnMzVCyeJC-J-2Im1IBsCIDxkzmvPX9RCY8uts4wM1y4wEX9LmNH2Mz_VFd-JdyGE", &options{})
+	expectLines(t, out, "Signature data", "  counter: 6")
+
+	// Signature data whose counter starts with 0x04 isn't mistaken for a
+	// compact registration.
+	sigData, _ := base64.RawURLEncoding.DecodeString("AQAAAAYwRAIgBuyafOXoc9Q7fARcs2JbCZdtnMzVCyeJC-J-2Im1IBsCIDxkzmvPX9RCY8uts4wM1y4wEX9LmNH2Mz_VFd-JdyGE")
+	sigData[1] = 0x04
+	out = run(t, hex.EncodeToString(sigData), &options{})
+	expectLines(t, out, "Signature data", "  counter: 67108870")
+
+	out = run(t, "eyJ0eXAiOiJuYXZpZ2F0b3IuaWQuZ2V0QXNzZXJ0aW9uIiwiY2hhbGxlbmdlIjoiUHpONlNHaVVhZXlwRXJFM1NDSGVSbGtSeFZ3ZldsR1ZpMzVnZnE2THNkWSIsIm9yaWdpbiI6Imh0dHA6Ly9sb2NhbGhvc3Q6MzQ4MyIsImNpZF9wdWJrZXkiOiIifQ", &options{})
+	expectLines(t, out, "Client data", "  challenge: "+signChallenge)
+}
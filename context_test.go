@@ -0,0 +1,152 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2f
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type traceKey struct{}
+
+func withTrace(id string) context.Context {
+	return context.WithValue(context.Background(), traceKey{}, id)
+}
+
+func traceID(ctx context.Context) string {
+	id, _ := ctx.Value(traceKey{}).(string)
+	return id
+}
+
+type facetResolverFunc func(ctx context.Context, appID string) ([]string, error)
+
+func (f facetResolverFunc) TrustedFacets(ctx context.Context, appID string) ([]string, error) {
+	return f(ctx, appID)
+}
+
+func TestNewChallengeContext(t *testing.T) {
+	c, err := NewChallengeContext(context.Background(), "https://example.com", StaticFacets{"https://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.AppID != "https://example.com" || !reflect.DeepEqual(c.TrustedFacets, []string{"https://example.com"}) || len(c.Challenge) != 32 {
+		t.Errorf("unexpected challenge: %+v", c)
+	}
+
+	// Without a resolver, the AppID is the only trusted facet.
+	c, err = NewChallengeContext(context.Background(), "https://example.com", nil)
+	if err != nil || !reflect.DeepEqual(c.TrustedFacets, []string{"https://example.com"}) {
+		t.Errorf("unexpected challenge without resolver: %+v, %v", c, err)
+	}
+
+	// The resolver gets the context and AppID.
+	var gotTrace, gotAppID string
+	resolver := facetResolverFunc(func(ctx context.Context, appID string) ([]string, error) {
+		gotTrace, gotAppID = traceID(ctx), appID
+		return []string{"https://www.example.com"}, nil
+	})
+	c, err = NewChallengeContext(withTrace("t1"), "https://example.com", resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotTrace != "t1" || gotAppID != "https://example.com" || !reflect.DeepEqual(c.TrustedFacets, []string{"https://www.example.com"}) {
+		t.Errorf("unexpected resolution: %q %q %v", gotTrace, gotAppID, c.TrustedFacets)
+	}
+
+	fetchErr := errors.New("fetch failed")
+	failing := facetResolverFunc(func(ctx context.Context, appID string) ([]string, error) {
+		return nil, fetchErr
+	})
+	if _, err := NewChallengeContext(context.Background(), "https://example.com", failing); err != fetchErr {
+		t.Errorf("expected resolver error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewChallengeContext(ctx, "https://example.com", StaticFacets{"https://example.com"}); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestContextCanceled(t *testing.T) {
+	var events []*Event
+	config := &Config{
+		SkipAttestationVerify: true,
+		Events:                EventHookFunc(func(e *Event) { events = append(events, e) }),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tc := newTestCredential(t)
+	c, _ := NewChallenge("https://example.com", []string{"https://example.com"})
+	if _, err := RegisterWebAuthnContext(ctx, tc.create(c, "none"), *c, config); err != context.Canceled {
+		t.Errorf("RegisterWebAuthnContext: expected context.Canceled, got %v", err)
+	}
+	if _, err := RegisterContext(ctx, RegisterResponse{}, *c, config); err != context.Canceled {
+		t.Errorf("RegisterContext: expected context.Canceled, got %v", err)
+	}
+
+	reg, err := RegisterWebAuthnContext(context.Background(), tc.create(c, "none"), *c, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.AuthenticateWebAuthnContext(ctx, tc.get(c), *c, 0, config); err != context.Canceled {
+		t.Errorf("AuthenticateWebAuthnContext: expected context.Canceled, got %v", err)
+	}
+	if _, err := reg.AuthenticateContext(ctx, SignResponse{}, *c, 0, config); err != context.Canceled {
+		t.Errorf("AuthenticateContext: expected context.Canceled, got %v", err)
+	}
+
+	// Every ceremony is reported, including the canceled ones.
+	var outcomes []string
+	for _, e := range events {
+		outcomes = append(outcomes, e.Outcome+" "+e.Reason)
+	}
+	want := []string{"failure context canceled", "failure context canceled", "success ", "failure context canceled", "failure context canceled"}
+	if !reflect.DeepEqual(outcomes, want) {
+		t.Errorf("got outcomes %q, want %q", outcomes, want)
+	}
+}
+
+func TestContextEventHook(t *testing.T) {
+	var traces []string
+	var buf bytes.Buffer
+	sink := NewJSONLines(&buf)
+	config := &Config{
+		SkipAttestationVerify: true,
+		TraceID:               traceID,
+		Events: ContextEventHookFunc(func(ctx context.Context, e *Event) {
+			traces = append(traces, traceID(ctx))
+			SendEvent(ctx, sink, e)
+		}),
+	}
+
+	tc := newTestCredential(t)
+	c, _ := NewChallenge("https://example.com", []string{"https://example.com"})
+	reg, err := RegisterWebAuthnContext(withTrace("t1"), tc.create(c, "none"), *c, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.AuthenticateWebAuthnContext(withTrace("t2"), tc.get(c), *c, 0, config); err != nil {
+		t.Fatal(err)
+	}
+	// Without a context, the hook gets a background context.
+	if _, err := reg.AuthenticateWebAuthnWithConfig(tc.get(c), *c, 0, config); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(traces, []string{"t1", "t2", ""}) {
+		t.Errorf("unexpected traces: %q", traces)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if !strings.Contains(lines[0], `"traceId":"t1"`) || !strings.Contains(lines[1], `"traceId":"t2"`) || strings.Contains(lines[2], "traceId") {
+		t.Errorf("unexpected trace IDs in events:\n%s", buf.String())
+	}
+}
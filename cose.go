@@ -0,0 +1,112 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2f
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"math/big"
+
+	"github.com/tstranex/u2f/internal/cbor"
+)
+
+// COSE_Key parameters and values as defined by RFC 8152.
+const (
+	coseKeyKty = 1
+	coseKeyAlg = 3
+	coseKeyCrv = -1
+	coseKeyX   = -2
+	coseKeyY   = -3
+
+	coseKtyEC2   = 2
+	coseCrvP256  = 1
+	coseCoordLen = 32
+)
+
+// MarshalCOSEKey encodes a P-256 public key as a COSE_Key with the ES256
+// algorithm, as used by WebAuthn credential public keys.
+func MarshalCOSEKey(pubKey *ecdsa.PublicKey) ([]byte, error) {
+	if pubKey.Curve != elliptic.P256() || pubKey.X == nil || pubKey.Y == nil ||
+		!pubKey.Curve.IsOnCurve(pubKey.X, pubKey.Y) {
+		return nil, errors.New("u2f: invalid public key")
+	}
+
+	x := make([]byte, coseCoordLen)
+	y := make([]byte, coseCoordLen)
+	pubKey.X.FillBytes(x)
+	pubKey.Y.FillBytes(y)
+
+	return cbor.Marshal(map[interface{}]interface{}{
+		coseKeyKty: coseKtyEC2,
+		coseKeyAlg: coseAlgES256,
+		coseKeyCrv: coseCrvP256,
+		coseKeyX:   x,
+		coseKeyY:   y,
+	})
+}
+
+// ParseCOSEKey decodes a COSE_Key holding a P-256 ECDSA public key.
+func ParseCOSEKey(data []byte) (*ecdsa.PublicKey, error) {
+	v, err := cbor.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return coseKeyFromCBOR(v)
+}
+
+// parseCOSEKeyPrefix decodes the COSE_Key at the start of data, as found in
+// authenticator data, and returns the bytes after it.
+func parseCOSEKeyPrefix(data []byte) (*ecdsa.PublicKey, []byte, error) {
+	v, rest, err := cbor.UnmarshalFirst(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubKey, err := coseKeyFromCBOR(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pubKey, rest, nil
+}
+
+func coseKeyFromCBOR(v interface{}) (*ecdsa.PublicKey, error) {
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("u2f: cose key is not a map")
+	}
+
+	if kty, _ := m[int64(coseKeyKty)].(int64); kty != coseKtyEC2 {
+		return nil, errors.New("u2f: unsupported cose key type")
+	}
+	if alg, ok := m[int64(coseKeyAlg)]; ok && alg != int64(coseAlgES256) {
+		return nil, errors.New("u2f: unsupported cose key algorithm")
+	}
+	if crv, _ := m[int64(coseKeyCrv)].(int64); crv != coseCrvP256 {
+		return nil, errors.New("u2f: unsupported cose key curve")
+	}
+
+	x, _ := m[int64(coseKeyX)].([]byte)
+	y, _ := m[int64(coseKeyY)].([]byte)
+	if len(x) != coseCoordLen || len(y) != coseCoordLen {
+		return nil, errors.New("u2f: invalid cose key coordinates")
+	}
+
+	pubKey := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+	if !pubKey.Curve.IsOnCurve(pubKey.X, pubKey.Y) {
+		return nil, errors.New("u2f: invalid public key")
+	}
+	return pubKey, nil
+}
+
+// COSEKey returns the registration's public key encoded as a COSE_Key, for
+// storing U2F registrations alongside WebAuthn credentials.
+func (r *Registration) COSEKey() ([]byte, error) {
+	return MarshalCOSEKey(&r.PubKey)
+}
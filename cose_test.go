@@ -0,0 +1,92 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2f
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestCOSEKeyRoundTrip(t *testing.T) {
+	regResp, _ := hex.DecodeString(testRegRespHex)
+	reg, _, err := parseRegistration(regResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := reg.COSEKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a5 01 02 03 26 20 01 21 5820 <x> 22 5820 <y>
+	const expected = "a5010203262001215820b174bc49c7ca254b70d2e5c207cee9cf174820ebd77ea3c65508c26da51b657c225820" +
+		"1cc6b952f8621697936482da0a6d3d3826a59095daf6cd7c03e2e60385d2f6d9"
+	if hex.EncodeToString(buf) != expected {
+		t.Errorf("unexpected cose key: %x", buf)
+	}
+
+	pubKey, err := ParseCOSEKey(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pubKey.X.Cmp(reg.PubKey.X) != 0 || pubKey.Y.Cmp(reg.PubKey.Y) != 0 {
+		t.Errorf("public key differs after round trip")
+	}
+}
+
+func TestCOSEKeySmallCoordinates(t *testing.T) {
+	// Coordinates with leading zero bytes must still be 32 bytes long.
+	for i := 0; i < 100; i++ {
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := MarshalCOSEKey(&priv.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubKey, err := ParseCOSEKey(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pubKey.X.Cmp(priv.X) != 0 || pubKey.Y.Cmp(priv.Y) != 0 {
+			t.Fatalf("public key differs after round trip")
+		}
+	}
+}
+
+func TestParseCOSEKeyInvalid(t *testing.T) {
+	tests := []string{
+		// Not a map.
+		"01",
+		// RSA key type.
+		"a30103032620015820" + "00",
+		// EdDSA algorithm.
+		"a501020327200121582060fed4ba255a9d31c961eb74c6356d68c049b8923b61fa6ce669622e60f29fb6225820" +
+			"7903fe1008b8bc99a41ae9e95628bc64f2f1b20c2d7e9f5177a3c294d4462299",
+		// Point not on the curve.
+		"a5010203262001215820" + "0000000000000000000000000000000000000000000000000000000000000001" +
+			"225820" + "0000000000000000000000000000000000000000000000000000000000000002",
+		// Short x coordinate.
+		"a50102032620012141012258200000000000000000000000000000000000000000000000000000000000000002",
+	}
+
+	for _, test := range tests {
+		buf, _ := hex.DecodeString(test)
+		if _, err := ParseCOSEKey(buf); err == nil {
+			t.Errorf("ParseCOSEKey(%s) expected error", test)
+		}
+	}
+
+	if _, err := MarshalCOSEKey(&ecdsa.PublicKey{Curve: elliptic.P256(), X: big.NewInt(1), Y: big.NewInt(2)}); err == nil {
+		t.Errorf("MarshalCOSEKey expected error for point not on the curve")
+	}
+}
@@ -0,0 +1,323 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+/*
+Package ctap1 implements the raw request and response messages exchanged
+with a U2F token, as defined by the FIDO U2F Raw Message Formats
+specification (also known as CTAP1).
+
+Requests are ISO 7816-4 command APDUs and are encoded with either short or
+extended length fields. Responses are response APDUs: the response message
+followed by a status word.
+
+The registration and authentication response messages carried in the
+response data are the ones verified by the u2f package.
+*/
+package ctap1
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Instructions as defined by the FIDO U2F Raw Message Formats specification.
+const (
+	InsRegister     = 0x01
+	InsAuthenticate = 0x02
+	InsVersion      = 0x03
+)
+
+// Control bytes for authentication requests.
+const (
+	// ControlEnforceUserPresence requests a signature, which the token
+	// only produces once the user has confirmed their presence.
+	ControlEnforceUserPresence = 0x03
+
+	// ControlCheckOnly asks whether the key handle was created by the
+	// token for the application. The token answers with
+	// SWConditionsNotSatisfied if it was and SWWrongData otherwise.
+	ControlCheckOnly = 0x07
+
+	// ControlDontEnforceUserPresence requests a signature without
+	// requiring user presence.
+	ControlDontEnforceUserPresence = 0x08
+)
+
+// Status words as defined by the FIDO U2F Raw Message Formats specification.
+const (
+	SWNoError                = 0x9000
+	SWConditionsNotSatisfied = 0x6985
+	SWWrongData              = 0x6a80
+	SWWrongLength            = 0x6700
+	SWClaNotSupported        = 0x6e00
+	SWInsNotSupported        = 0x6d00
+)
+
+// Version is the response to a version request.
+const Version = "U2F_V2"
+
+// StatusError is a status word other than SWNoError.
+type StatusError uint16
+
+func (e StatusError) Error() string {
+	switch e {
+	case SWConditionsNotSatisfied:
+		return "ctap1: conditions not satisfied"
+	case SWWrongData:
+		return "ctap1: wrong data"
+	case SWWrongLength:
+		return "ctap1: wrong length"
+	case SWClaNotSupported:
+		return "ctap1: class not supported"
+	case SWInsNotSupported:
+		return "ctap1: instruction not supported"
+	}
+	return fmt.Sprintf("ctap1: status %04x", uint16(e))
+}
+
+// Command is a command APDU.
+type Command struct {
+	CLA, INS, P1, P2 byte
+	Data             []byte
+
+	// Ne is the maximum number of response bytes expected. Zero means the
+	// Le field is absent.
+	Ne int
+}
+
+const (
+	maxShortLc = 255
+	maxShortNe = 256
+	maxExtLc   = 65535
+	maxExtNe   = 65536
+)
+
+// MarshalShort encodes the command with short length fields.
+func (c *Command) MarshalShort() ([]byte, error) {
+	if len(c.Data) > maxShortLc || c.Ne > maxShortNe || c.Ne < 0 {
+		return nil, errors.New("ctap1: command too long for short encoding")
+	}
+
+	buf := []byte{c.CLA, c.INS, c.P1, c.P2}
+	if len(c.Data) > 0 {
+		buf = append(buf, byte(len(c.Data)))
+		buf = append(buf, c.Data...)
+	}
+	if c.Ne > 0 {
+		// 256 is encoded as zero.
+		buf = append(buf, byte(c.Ne))
+	}
+	return buf, nil
+}
+
+// MarshalExtended encodes the command with extended length fields, as
+// required for U2F messages sent over USB HID.
+func (c *Command) MarshalExtended() ([]byte, error) {
+	if len(c.Data) > maxExtLc || c.Ne > maxExtNe || c.Ne < 0 {
+		return nil, errors.New("ctap1: command too long")
+	}
+
+	buf := []byte{c.CLA, c.INS, c.P1, c.P2}
+	if len(c.Data) > 0 {
+		buf = append(buf, 0, byte(len(c.Data)>>8), byte(len(c.Data)))
+		buf = append(buf, c.Data...)
+	}
+	if c.Ne > 0 {
+		if len(c.Data) == 0 {
+			buf = append(buf, 0)
+		}
+		// 65536 is encoded as zero.
+		buf = append(buf, byte(c.Ne>>8), byte(c.Ne))
+	}
+	return buf, nil
+}
+
+// ParseCommand decodes a command APDU with either short or extended length
+// fields.
+func ParseCommand(buf []byte) (*Command, error) {
+	if len(buf) < 4 {
+		return nil, errors.New("ctap1: command too short")
+	}
+	c := &Command{CLA: buf[0], INS: buf[1], P1: buf[2], P2: buf[3]}
+	body := buf[4:]
+
+	switch {
+	case len(body) == 0:
+		// Case 1: no data, no Le.
+
+	case len(body) == 1:
+		// Case 2 short: Le only.
+		c.Ne = shortNe(body[0])
+
+	case body[0] != 0:
+		// Cases 3 and 4 short.
+		lc := int(body[0])
+		switch len(body) {
+		case 1 + lc:
+		case 1 + lc + 1:
+			c.Ne = shortNe(body[1+lc])
+		default:
+			return nil, errors.New("ctap1: invalid command length")
+		}
+		c.Data = body[1 : 1+lc]
+
+	case len(body) == 3:
+		// Case 2 extended: Le only.
+		c.Ne = extNe(body[1:3])
+
+	default:
+		// Cases 3 and 4 extended.
+		if len(body) < 3 {
+			return nil, errors.New("ctap1: invalid command length")
+		}
+		lc := int(binary.BigEndian.Uint16(body[1:3]))
+		if lc == 0 {
+			return nil, errors.New("ctap1: invalid command length")
+		}
+		switch len(body) {
+		case 3 + lc:
+		case 3 + lc + 2:
+			c.Ne = extNe(body[3+lc:])
+		default:
+			return nil, errors.New("ctap1: invalid command length")
+		}
+		c.Data = body[3 : 3+lc]
+	}
+
+	return c, nil
+}
+
+func shortNe(b byte) int {
+	if b == 0 {
+		return maxShortNe
+	}
+	return int(b)
+}
+
+func extNe(b []byte) int {
+	n := int(binary.BigEndian.Uint16(b))
+	if n == 0 {
+		return maxExtNe
+	}
+	return n
+}
+
+// Response is a response APDU.
+type Response struct {
+	Data []byte
+	SW   uint16
+}
+
+// Marshal encodes the response.
+func (r *Response) Marshal() []byte {
+	buf := make([]byte, 0, len(r.Data)+2)
+	buf = append(buf, r.Data...)
+	return append(buf, byte(r.SW>>8), byte(r.SW))
+}
+
+// Err returns a StatusError unless the status word is SWNoError.
+func (r *Response) Err() error {
+	if r.SW != SWNoError {
+		return StatusError(r.SW)
+	}
+	return nil
+}
+
+// ParseResponse decodes a response APDU.
+func ParseResponse(buf []byte) (*Response, error) {
+	if len(buf) < 2 {
+		return nil, errors.New("ctap1: response too short")
+	}
+	n := len(buf) - 2
+	return &Response{
+		Data: buf[:n],
+		SW:   binary.BigEndian.Uint16(buf[n:]),
+	}, nil
+}
+
+// RegisterRequest is a U2F_REGISTER request message.
+type RegisterRequest struct {
+	// Challenge is the SHA-256 hash of the client data.
+	Challenge [32]byte
+
+	// Application is the SHA-256 hash of the AppID.
+	Application [32]byte
+}
+
+// Command returns the command APDU for the request.
+func (r *RegisterRequest) Command() *Command {
+	data := make([]byte, 0, 64)
+	data = append(data, r.Challenge[:]...)
+	data = append(data, r.Application[:]...)
+	return &Command{INS: InsRegister, Data: data, Ne: maxExtNe}
+}
+
+// ParseRegisterRequest decodes a U2F_REGISTER request message.
+func ParseRegisterRequest(c *Command) (*RegisterRequest, error) {
+	if c.INS != InsRegister {
+		return nil, errors.New("ctap1: not a register request")
+	}
+	if len(c.Data) != 64 {
+		return nil, StatusError(SWWrongLength)
+	}
+	var r RegisterRequest
+	copy(r.Challenge[:], c.Data[:32])
+	copy(r.Application[:], c.Data[32:])
+	return &r, nil
+}
+
+// AuthenticateRequest is a U2F_AUTHENTICATE request message.
+type AuthenticateRequest struct {
+	// Control is one of ControlEnforceUserPresence, ControlCheckOnly or
+	// ControlDontEnforceUserPresence.
+	Control byte
+
+	// Challenge is the SHA-256 hash of the client data.
+	Challenge [32]byte
+
+	// Application is the SHA-256 hash of the AppID.
+	Application [32]byte
+
+	KeyHandle []byte
+}
+
+// Command returns the command APDU for the request.
+func (r *AuthenticateRequest) Command() (*Command, error) {
+	if len(r.KeyHandle) > 255 {
+		return nil, errors.New("ctap1: key handle too long")
+	}
+	data := make([]byte, 0, 65+len(r.KeyHandle))
+	data = append(data, r.Challenge[:]...)
+	data = append(data, r.Application[:]...)
+	data = append(data, byte(len(r.KeyHandle)))
+	data = append(data, r.KeyHandle...)
+	return &Command{INS: InsAuthenticate, P1: r.Control, Data: data, Ne: maxExtNe}, nil
+}
+
+// ParseAuthenticateRequest decodes a U2F_AUTHENTICATE request message.
+func ParseAuthenticateRequest(c *Command) (*AuthenticateRequest, error) {
+	if c.INS != InsAuthenticate {
+		return nil, errors.New("ctap1: not an authenticate request")
+	}
+	switch c.P1 {
+	case ControlEnforceUserPresence, ControlCheckOnly, ControlDontEnforceUserPresence:
+	default:
+		return nil, StatusError(SWWrongData)
+	}
+	if len(c.Data) < 65 || len(c.Data) != 65+int(c.Data[64]) {
+		return nil, StatusError(SWWrongLength)
+	}
+	r := AuthenticateRequest{Control: c.P1}
+	copy(r.Challenge[:], c.Data[:32])
+	copy(r.Application[:], c.Data[32:64])
+	r.KeyHandle = c.Data[65:]
+	return &r, nil
+}
+
+// VersionCommand returns the command APDU for a U2F_VERSION request.
+func VersionCommand() *Command {
+	return &Command{INS: InsVersion, Ne: maxExtNe}
+}
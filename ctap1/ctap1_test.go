@@ -0,0 +1,181 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package ctap1
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestCommandEncoding(t *testing.T) {
+	data := []byte{1, 2, 3}
+	tests := []struct {
+		cmd      Command
+		short    string
+		extended string
+	}{
+		{Command{INS: 3}, "00030000", "00030000"},
+		{Command{INS: 3, Ne: 256}, "0003000000", "0003000000" + "0100"},
+		{Command{INS: 3, Ne: 65536}, "", "0003000000" + "0000"},
+		{Command{INS: 1, P1: 3, Data: data}, "0001030003010203", "00010300000003010203"},
+		{Command{INS: 1, Data: data, Ne: 16}, "000100000301020310", "000100000000030102030010"},
+	}
+
+	for _, test := range tests {
+		short, err := test.cmd.MarshalShort()
+		if test.short == "" {
+			if err == nil {
+				t.Errorf("%+v: expected error for short encoding", test.cmd)
+			}
+		} else if err != nil || hex.EncodeToString(short) != test.short {
+			t.Errorf("%+v: short encoding %x (%v), expected %s", test.cmd, short, err, test.short)
+		}
+
+		extended, err := test.cmd.MarshalExtended()
+		if err != nil || hex.EncodeToString(extended) != test.extended {
+			t.Errorf("%+v: extended encoding %x (%v), expected %s", test.cmd, extended, err, test.extended)
+		}
+
+		for _, enc := range [][]byte{short, extended} {
+			if enc == nil {
+				continue
+			}
+			c, err := ParseCommand(enc)
+			if err != nil {
+				t.Errorf("ParseCommand(%x) error: %v", enc, err)
+				continue
+			}
+			if c.INS != test.cmd.INS || c.P1 != test.cmd.P1 || c.Ne != test.cmd.Ne ||
+				!bytes.Equal(c.Data, test.cmd.Data) {
+				t.Errorf("ParseCommand(%x) = %+v, expected %+v", enc, c, test.cmd)
+			}
+		}
+	}
+}
+
+func TestParseCommandInvalid(t *testing.T) {
+	tests := []string{
+		"000100",
+		"0001000003010203040506",
+		"000100000000",
+		"0001000000000301",
+		"0001000000000301020300",
+	}
+	for _, test := range tests {
+		buf, _ := hex.DecodeString(test)
+		if c, err := ParseCommand(buf); err == nil {
+			t.Errorf("ParseCommand(%s) = %+v, expected error", test, c)
+		}
+	}
+}
+
+func TestRegisterRequest(t *testing.T) {
+	// Example 8.1 in FIDO U2F Raw Message Formats.
+	challenge, _ := hex.DecodeString("4142d21c00d94ffb9d504ada8f99b721f4b191ae4e37ca0140f696b6983cfacb")
+	application, _ := hex.DecodeString("f0e6a6a97042a4f1f1c87f5f7d44315b2d852c2df5c7991cc66241bf7072d1c4")
+
+	var r RegisterRequest
+	copy(r.Challenge[:], challenge)
+	copy(r.Application[:], application)
+
+	buf, err := r.Command().MarshalExtended()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "00010000000040" + hex.EncodeToString(challenge) + hex.EncodeToString(application) + "0000"
+	if hex.EncodeToString(buf) != expected {
+		t.Errorf("unexpected register request: %x", buf)
+	}
+
+	c, err := ParseCommand(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := ParseRegisterRequest(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *r2 != r {
+		t.Errorf("register request differs after round trip")
+	}
+}
+
+func TestAuthenticateRequest(t *testing.T) {
+	r := AuthenticateRequest{
+		Control:   ControlCheckOnly,
+		KeyHandle: bytes.Repeat([]byte{0xaa}, 64),
+	}
+	r.Challenge[0] = 1
+	r.Application[0] = 2
+
+	c, err := r.Command()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := c.MarshalExtended()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hex.EncodeToString(buf), "00020700000081") {
+		t.Errorf("unexpected authenticate request header: %x", buf[:7])
+	}
+
+	c, err = ParseCommand(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := ParseAuthenticateRequest(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r2.Control != r.Control || r2.Challenge != r.Challenge ||
+		r2.Application != r.Application || !bytes.Equal(r2.KeyHandle, r.KeyHandle) {
+		t.Errorf("authenticate request differs after round trip: %+v", r2)
+	}
+
+	c.P1 = 0x01
+	if _, err := ParseAuthenticateRequest(c); err != StatusError(SWWrongData) {
+		t.Errorf("expected SWWrongData for invalid control byte, got %v", err)
+	}
+
+	c.P1 = ControlEnforceUserPresence
+	c.Data = c.Data[:len(c.Data)-1]
+	if _, err := ParseAuthenticateRequest(c); err != StatusError(SWWrongLength) {
+		t.Errorf("expected SWWrongLength for truncated key handle, got %v", err)
+	}
+
+	r.KeyHandle = make([]byte, 256)
+	if _, err := r.Command(); err == nil {
+		t.Errorf("expected error for long key handle")
+	}
+}
+
+func TestResponse(t *testing.T) {
+	resp, err := ParseResponse([]byte("U2F_V2\x90\x00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp.Data) != Version || resp.SW != SWNoError || resp.Err() != nil {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	resp, err = ParseResponse([]byte{0x69, 0x85})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Err() != StatusError(SWConditionsNotSatisfied) {
+		t.Errorf("unexpected error: %v", resp.Err())
+	}
+	if !bytes.Equal(resp.Marshal(), []byte{0x69, 0x85}) {
+		t.Errorf("unexpected encoding: %x", resp.Marshal())
+	}
+
+	if _, err := ParseResponse([]byte{0x90}); err == nil {
+		t.Errorf("expected error for short response")
+	}
+}
@@ -0,0 +1,305 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+/*
+Package ctaphid implements the framing protocol used to talk to U2F tokens
+over USB HID, as defined by the FIDO U2F HID Protocol specification
+(CTAPHID).
+
+Messages are split into 64-byte reports: an initialization packet followed
+by continuation packets. The package is independent of the HID transport:
+it reads and writes whole reports through an io.ReadWriter, where every
+Read and Write call transfers exactly one report. Platform adapters that
+need a report ID byte must add and remove it themselves.
+
+	dev, err := ctaphid.Open(hidDevice)
+	resp, err := dev.Message(apdu)
+*/
+package ctaphid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// PacketSize is the size of a HID report.
+const PacketSize = 64
+
+const (
+	initHeaderLen = 7
+	contHeaderLen = 5
+	initDataLen   = PacketSize - initHeaderLen
+	contDataLen   = PacketSize - contHeaderLen
+	maxSeq        = 0x7f
+)
+
+// MaxMessageSize is the largest payload that fits in one message.
+const MaxMessageSize = initDataLen + (maxSeq+1)*contDataLen
+
+// BroadcastCID is the channel used to allocate channels.
+const BroadcastCID = 0xffffffff
+
+// Commands as defined by the FIDO U2F HID Protocol specification. On the
+// wire, the initialization packet carries the command with TypeInit set.
+const (
+	CmdPing      = 0x01
+	CmdMsg       = 0x03
+	CmdLock      = 0x04
+	CmdInit      = 0x06
+	CmdWink      = 0x08
+	CmdSync      = 0x3c
+	CmdKeepalive = 0x3b
+	CmdError     = 0x3f
+
+	TypeInit = 0x80
+)
+
+// Capability flags reported by CTAPHID_INIT.
+const (
+	CapWink = 0x01
+	CapLock = 0x02
+	CapCBOR = 0x04
+	CapNMSG = 0x08
+)
+
+// Error is an error code received in a CTAPHID_ERROR response.
+type Error byte
+
+// Error codes as defined by the FIDO U2F HID Protocol specification.
+const (
+	ErrInvalidCmd     Error = 0x01
+	ErrInvalidPar     Error = 0x02
+	ErrInvalidLen     Error = 0x03
+	ErrInvalidSeq     Error = 0x04
+	ErrMsgTimeout     Error = 0x05
+	ErrChannelBusy    Error = 0x06
+	ErrLockRequired   Error = 0x0a
+	ErrInvalidChannel Error = 0x0b
+	ErrOther          Error = 0x7f
+)
+
+func (e Error) Error() string {
+	switch e {
+	case ErrInvalidCmd:
+		return "ctaphid: invalid command"
+	case ErrInvalidPar:
+		return "ctaphid: invalid parameter"
+	case ErrInvalidLen:
+		return "ctaphid: invalid length"
+	case ErrInvalidSeq:
+		return "ctaphid: invalid sequence"
+	case ErrMsgTimeout:
+		return "ctaphid: message timeout"
+	case ErrChannelBusy:
+		return "ctaphid: channel busy"
+	case ErrLockRequired:
+		return "ctaphid: lock required"
+	case ErrInvalidChannel:
+		return "ctaphid: invalid channel"
+	}
+	return fmt.Sprintf("ctaphid: error %#02x", byte(e))
+}
+
+// WriteMessage segments a message into packets and writes them to w, one
+// packet per Write call. cmd must not include TypeInit.
+func WriteMessage(w io.Writer, cid uint32, cmd byte, data []byte) error {
+	if len(data) > MaxMessageSize {
+		return errors.New("ctaphid: message too long")
+	}
+
+	pkt := make([]byte, PacketSize)
+	binary.BigEndian.PutUint32(pkt, cid)
+	pkt[4] = TypeInit | cmd
+	binary.BigEndian.PutUint16(pkt[5:], uint16(len(data)))
+	n := copy(pkt[initHeaderLen:], data)
+	data = data[n:]
+	if _, err := w.Write(pkt); err != nil {
+		return err
+	}
+
+	for seq := byte(0); len(data) > 0; seq++ {
+		pkt = make([]byte, PacketSize)
+		binary.BigEndian.PutUint32(pkt, cid)
+		pkt[4] = seq
+		n := copy(pkt[contHeaderLen:], data)
+		data = data[n:]
+		if _, err := w.Write(pkt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadMessage reads packets from r, one per Read call, and reassembles the
+// first message that starts with an initialization packet. Continuation
+// packets on other channels are skipped; a new initialization packet on
+// the same channel before the message is complete is an error, as is a
+// continuation packet out of sequence.
+func ReadMessage(r io.Reader) (cid uint32, cmd byte, data []byte, err error) {
+	pkt := make([]byte, PacketSize)
+
+	for {
+		if _, err := io.ReadFull(r, pkt); err != nil {
+			return 0, 0, nil, err
+		}
+		if pkt[4]&TypeInit != 0 {
+			break
+		}
+		// Stray continuation packet.
+	}
+
+	cid = binary.BigEndian.Uint32(pkt)
+	cmd = pkt[4] &^ TypeInit
+	n := int(binary.BigEndian.Uint16(pkt[5:]))
+	if n > MaxMessageSize {
+		return 0, 0, nil, ErrInvalidLen
+	}
+	data = make([]byte, 0, n)
+	data = append(data, pkt[initHeaderLen:initHeaderLen+minInt(n, initDataLen)]...)
+
+	for seq := byte(0); len(data) < n; {
+		if _, err := io.ReadFull(r, pkt); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, 0, nil, err
+		}
+		if binary.BigEndian.Uint32(pkt) != cid {
+			continue
+		}
+		if pkt[4]&TypeInit != 0 {
+			return 0, 0, nil, ErrInvalidSeq
+		}
+		if pkt[4] != seq {
+			return 0, 0, nil, ErrInvalidSeq
+		}
+		seq++
+		data = append(data, pkt[contHeaderLen:contHeaderLen+minInt(n-len(data), contDataLen)]...)
+	}
+
+	return cid, cmd, data, nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Info describes a token, as reported in the CTAPHID_INIT response.
+type Info struct {
+	ProtocolVersion byte
+	Major           byte
+	Minor           byte
+	Build           byte
+	Capabilities    byte
+}
+
+// Device is a channel to a token. It is not safe for concurrent use.
+type Device struct {
+	rw   io.ReadWriter
+	cid  uint32
+	Info Info
+}
+
+const nonceLen = 8
+
+// Open allocates a channel on the token with the CTAPHID_INIT handshake.
+func Open(rw io.ReadWriter) (*Device, error) {
+	nonce := make([]byte, nonceLen)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	d := &Device{rw: rw, cid: BroadcastCID}
+	resp, err := d.call(CmdInit, nonce, func(resp []byte) bool {
+		// Responses to other applications' handshakes are also
+		// broadcast.
+		return len(resp) >= nonceLen && string(resp[:nonceLen]) == string(nonce)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < nonceLen+9 {
+		return nil, ErrInvalidLen
+	}
+
+	d.cid = binary.BigEndian.Uint32(resp[nonceLen:])
+	d.Info = Info{
+		ProtocolVersion: resp[nonceLen+4],
+		Major:           resp[nonceLen+5],
+		Minor:           resp[nonceLen+6],
+		Build:           resp[nonceLen+7],
+		Capabilities:    resp[nonceLen+8],
+	}
+	if d.cid == 0 || d.cid == BroadcastCID {
+		return nil, ErrInvalidChannel
+	}
+	return d, nil
+}
+
+// CID returns the channel ID allocated to the device.
+func (d *Device) CID() uint32 {
+	return d.cid
+}
+
+// Message sends a raw U2F request message with CTAPHID_MSG and returns
+// the response message.
+func (d *Device) Message(apdu []byte) ([]byte, error) {
+	return d.call(CmdMsg, apdu, nil)
+}
+
+// Ping sends data with CTAPHID_PING and returns the echoed data.
+func (d *Device) Ping(data []byte) ([]byte, error) {
+	resp, err := d.call(CmdPing, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	if string(resp) != string(data) {
+		return nil, errors.New("ctaphid: ping response differs")
+	}
+	return resp, nil
+}
+
+// Wink asks the token to identify itself, typically by blinking a light.
+func (d *Device) Wink() error {
+	_, err := d.call(CmdWink, nil, nil)
+	return err
+}
+
+// call sends a request and waits for the matching response on the
+// device's channel, skipping keepalives and responses rejected by accept.
+func (d *Device) call(cmd byte, data []byte, accept func([]byte) bool) ([]byte, error) {
+	if err := WriteMessage(d.rw, d.cid, cmd, data); err != nil {
+		return nil, err
+	}
+
+	for {
+		cid, respCmd, resp, err := ReadMessage(d.rw)
+		if err != nil {
+			return nil, err
+		}
+		if cid != d.cid || respCmd == CmdKeepalive {
+			continue
+		}
+		if respCmd == CmdError {
+			if len(resp) < 1 {
+				return nil, ErrOther
+			}
+			return nil, Error(resp[0])
+		}
+		if respCmd != cmd {
+			return nil, fmt.Errorf("ctaphid: unexpected response command %#02x", respCmd)
+		}
+		if accept != nil && !accept(resp) {
+			continue
+		}
+		return resp, nil
+	}
+}
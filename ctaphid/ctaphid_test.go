@@ -0,0 +1,200 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package ctaphid
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/tstranex/u2f/ctap1"
+	"github.com/tstranex/u2f/softtoken"
+)
+
+// fakeDevice is an in-memory token that speaks CTAPHID.
+type fakeDevice struct {
+	t       *testing.T
+	token   *softtoken.Token
+	nextCID uint32
+	in      bytes.Buffer
+	out     bytes.Buffer
+
+	// extra packets to send before each response.
+	noise [][]byte
+}
+
+func newFakeDevice(t *testing.T) *fakeDevice {
+	return &fakeDevice{t: t, token: softtoken.NewTest(t), nextCID: 0x01020304}
+}
+
+func (d *fakeDevice) Write(p []byte) (int, error) {
+	if len(p) != PacketSize {
+		d.t.Fatalf("write of %d bytes", len(p))
+	}
+	d.in.Write(p)
+
+	cid, cmd, data, err := ReadMessage(bytes.NewReader(d.in.Bytes()))
+	if err == io.ErrUnexpectedEOF {
+		return len(p), nil
+	}
+	d.in.Reset()
+	if err != nil {
+		d.reply(cid, CmdError, []byte{byte(ErrOther)})
+		return len(p), nil
+	}
+
+	for _, pkt := range d.noise {
+		d.out.Write(pkt)
+	}
+
+	switch cmd {
+	case CmdInit:
+		resp := append([]byte(nil), data...)
+		resp = binary.BigEndian.AppendUint32(resp, d.nextCID)
+		resp = append(resp, 2, 1, 2, 3, CapWink)
+		d.nextCID++
+		d.reply(cid, CmdInit, resp)
+	case CmdPing:
+		d.reply(cid, CmdPing, data)
+	case CmdWink:
+		d.reply(cid, CmdWink, nil)
+	case CmdMsg:
+		d.reply(cid, CmdKeepalive, []byte{1})
+		d.reply(cid, CmdMsg, d.token.HandleAPDU(data))
+	default:
+		d.reply(cid, CmdError, []byte{byte(ErrInvalidCmd)})
+	}
+	return len(p), nil
+}
+
+func (d *fakeDevice) reply(cid uint32, cmd byte, data []byte) {
+	if err := WriteMessage(&d.out, cid, cmd, data); err != nil {
+		d.t.Fatal(err)
+	}
+}
+
+func (d *fakeDevice) Read(p []byte) (int, error) {
+	if d.out.Len() == 0 {
+		return 0, io.EOF
+	}
+	return d.out.Read(p[:PacketSize])
+}
+
+func TestFraming(t *testing.T) {
+	for _, n := range []int{0, 1, initDataLen, initDataLen + 1, 1000, MaxMessageSize} {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(i)
+		}
+
+		var buf bytes.Buffer
+		if err := WriteMessage(&buf, 0x11223344, CmdMsg, data); err != nil {
+			t.Fatal(err)
+		}
+		packets := 1
+		if n > initDataLen {
+			packets += (n - initDataLen + contDataLen - 1) / contDataLen
+		}
+		if buf.Len() != packets*PacketSize {
+			t.Errorf("%d bytes: got %d bytes of packets, expected %d packets", n, buf.Len(), packets)
+		}
+
+		cid, cmd, got, err := ReadMessage(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cid != 0x11223344 || cmd != CmdMsg || !bytes.Equal(got, data) {
+			t.Errorf("%d bytes: message differs after round trip", n)
+		}
+	}
+
+	if err := WriteMessage(io.Discard, 1, CmdMsg, make([]byte, MaxMessageSize+1)); err == nil {
+		t.Errorf("expected error for message too long")
+	}
+}
+
+func TestReadMessageInterleaved(t *testing.T) {
+	var a, b bytes.Buffer
+	WriteMessage(&a, 1, CmdMsg, make([]byte, 200))
+	WriteMessage(&b, 2, CmdMsg, make([]byte, 200))
+
+	// Channel 1's message with channel 2's continuation packets mixed in.
+	var buf bytes.Buffer
+	buf.Write(a.Next(PacketSize))
+	b.Next(PacketSize)
+	for a.Len() > 0 {
+		buf.Write(b.Next(PacketSize))
+		buf.Write(a.Next(PacketSize))
+	}
+
+	cid, _, data, err := ReadMessage(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cid != 1 || len(data) != 200 {
+		t.Errorf("unexpected message on channel %d with %d bytes", cid, len(data))
+	}
+}
+
+func TestReadMessageInvalidSeq(t *testing.T) {
+	var buf bytes.Buffer
+	WriteMessage(&buf, 1, CmdMsg, make([]byte, 200))
+	pkts := buf.Bytes()
+	pkts[2*PacketSize+4] = 5
+
+	if _, _, _, err := ReadMessage(bytes.NewReader(pkts)); err != ErrInvalidSeq {
+		t.Errorf("expected ErrInvalidSeq, got %v", err)
+	}
+
+	if _, _, _, err := ReadMessage(bytes.NewReader(pkts[:PacketSize])); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestDevice(t *testing.T) {
+	fake := newFakeDevice(t)
+
+	// A response to another application's handshake must be skipped.
+	var other bytes.Buffer
+	WriteMessage(&other, BroadcastCID, CmdInit, make([]byte, 17))
+	fake.noise = [][]byte{other.Bytes()}
+
+	dev, err := Open(fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.CID() != 0x01020304 {
+		t.Errorf("unexpected channel: %08x", dev.CID())
+	}
+	if dev.Info.ProtocolVersion != 2 || dev.Info.Capabilities != CapWink {
+		t.Errorf("unexpected info: %+v", dev.Info)
+	}
+	fake.noise = nil
+
+	data := bytes.Repeat([]byte("ping"), 100)
+	got, err := dev.Ping(data)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("ping failed: %v", err)
+	}
+
+	if err := dev.Wink(); err != nil {
+		t.Errorf("wink failed: %v", err)
+	}
+
+	cmd, _ := ctap1.VersionCommand().MarshalExtended()
+	resp, err := dev.Message(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != ctap1.Version+"\x90\x00" {
+		t.Errorf("unexpected version response: %q", resp)
+	}
+
+	if _, err := dev.call(CmdLock, []byte{1}, nil); err != ErrInvalidCmd {
+		t.Errorf("expected ErrInvalidCmd, got %v", err)
+	}
+}
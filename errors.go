@@ -0,0 +1,35 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2f
+
+import "errors"
+
+// Errors returned by the registration and authentication functions, so that
+// callers can tell common failures apart. Other failures, such as malformed
+// responses, have their own messages.
+var (
+	ErrChallengeExpired  = errors.New("u2f: challenge has expired")
+	ErrUntrustedFacet    = errors.New("u2f: untrusted facet id")
+	ErrChallengeMismatch = errors.New("u2f: challenge does not match")
+	ErrInvalidSignature  = errors.New("u2f: invalid signature")
+	ErrUserNotPresent    = errors.New("u2f: user was not present")
+)
+
+// AttestationError is returned when a token's attestation is rejected: the
+// attestation statement is invalid or unsupported, or the attestation
+// certificate is missing or not trusted.
+type AttestationError struct {
+	Err error
+}
+
+func (e *AttestationError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *AttestationError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,225 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2f
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Ceremony is the kind of operation an Event reports.
+type Ceremony string
+
+// Ceremonies.
+const (
+	CeremonyRegister     Ceremony = "register"
+	CeremonyAuthenticate Ceremony = "authenticate"
+)
+
+// Protocols of Events.
+const (
+	// ProtocolU2F is the U2F Javascript API: Register and Authenticate.
+	ProtocolU2F = "u2f"
+
+	// ProtocolWebAuthn is WebAuthn: RegisterWebAuthn and
+	// AuthenticateWebAuthn.
+	ProtocolWebAuthn = "webauthn"
+)
+
+// Outcomes of Events.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event describes the outcome of a registration or authentication, for audit
+// logs. It holds no challenge, client data or signature bytes.
+type Event struct {
+	Ceremony Ceremony `json:"ceremony"`
+	Protocol string   `json:"protocol"`
+
+	// Time is when the verification started, and Duration how long it
+	// took.
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+
+	AppID string `json:"appId"`
+
+	// TraceID is the trace ID of the ceremony's context, as returned by
+	// Config.TraceID.
+	TraceID string `json:"traceId,omitempty"`
+
+	// Origin is the origin reported by the client, if the client data
+	// could be decoded.
+	Origin string `json:"origin,omitempty"`
+
+	// Fingerprint identifies the registration. It is nil for failed
+	// registrations.
+	Fingerprint *Fingerprint `json:"fingerprint,omitempty"`
+
+	// CounterBefore is the stored counter passed to the authentication,
+	// and CounterAfter the counter signed by the token. CounterAfter is
+	// zero if the response's signature wasn't verified, so it is never
+	// chosen by a forger. Both are zero for registrations.
+	CounterBefore uint32 `json:"counterBefore"`
+	CounterAfter  uint32 `json:"counterAfter"`
+
+	// AttestationIssuer is the issuer of the registration's attestation
+	// certificate, which identifies the token vendor, if known.
+	AttestationIssuer string `json:"attestationIssuer,omitempty"`
+
+	Outcome string `json:"outcome"`
+
+	// Reason is the error message of failures, and Err the error itself.
+	Reason string `json:"reason,omitempty"`
+	Err    error  `json:"-"`
+}
+
+// EventHook receives an Event for every registration and authentication
+// made with a Config that has it.
+type EventHook interface {
+	Event(e *Event)
+}
+
+// ContextEventHook is an EventHook that also receives the context of the
+// ceremony, as passed to RegisterContext and the other Context functions,
+// for example for request-scoped values.
+type ContextEventHook interface {
+	EventHook
+	EventContext(ctx context.Context, e *Event)
+}
+
+// EventHookFunc is an EventHook function.
+type EventHookFunc func(e *Event)
+
+// Event calls f(e).
+func (f EventHookFunc) Event(e *Event) {
+	f(e)
+}
+
+// ContextEventHookFunc is a ContextEventHook function.
+type ContextEventHookFunc func(ctx context.Context, e *Event)
+
+// Event calls f with a background context.
+func (f ContextEventHookFunc) Event(e *Event) {
+	f(context.Background(), e)
+}
+
+// EventContext calls f(ctx, e).
+func (f ContextEventHookFunc) EventContext(ctx context.Context, e *Event) {
+	f(ctx, e)
+}
+
+// SendEvent passes e to hook, with ctx if hook is a ContextEventHook. It is
+// for hooks that pass events on to other hooks.
+func SendEvent(ctx context.Context, hook EventHook, e *Event) {
+	if h, ok := hook.(ContextEventHook); ok {
+		h.EventContext(ctx, e)
+	} else {
+		hook.Event(e)
+	}
+}
+
+// newEvent starts the event of a ceremony, or returns nil if the config has
+// no hook.
+func (config *Config) newEvent(ctx context.Context, ceremony Ceremony, protocol string, c Challenge) *Event {
+	if config == nil || config.Events == nil {
+		return nil
+	}
+	e := &Event{
+		Ceremony: ceremony,
+		Protocol: protocol,
+		Time:     time.Now(),
+		AppID:    c.AppID,
+	}
+	if config.TraceID != nil {
+		e.TraceID = config.TraceID(ctx)
+	}
+	return e
+}
+
+// emit completes the event with the outcome and the registration, which may
+// be nil, and sends it to the hook.
+func (config *Config) emit(ctx context.Context, e *Event, reg *Registration, err error) {
+	if e == nil {
+		return
+	}
+	e.Duration = time.Since(e.Time)
+	if reg != nil {
+		f := reg.Fingerprint()
+		e.Fingerprint = &f
+		if reg.AttestationCert != nil {
+			e.AttestationIssuer = reg.AttestationCert.Issuer.String()
+		} else if reg.Attestation != nil {
+			e.AttestationIssuer = reg.Attestation.Issuer
+		}
+	}
+	if err != nil {
+		e.Outcome = OutcomeFailure
+		e.Reason = err.Error()
+		e.Err = err
+	} else {
+		e.Outcome = OutcomeSuccess
+	}
+	SendEvent(ctx, config.Events, e)
+}
+
+// clientDataOrigin returns the origin of base64 encoded client data, or ""
+// if it can't be decoded.
+func clientDataOrigin(clientData string) string {
+	data, err := decodeBase64(clientData)
+	if err != nil {
+		return ""
+	}
+	var cd struct {
+		Origin string `json:"origin"`
+	}
+	if json.Unmarshal(data, &cd) != nil {
+		return ""
+	}
+	return cd.Origin
+}
+
+// JSONLines is an EventHook that writes each event as a line of JSON. The
+// duration is in nanoseconds.
+type JSONLines struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// NewJSONLines returns a JSONLines hook writing to w.
+func NewJSONLines(w io.Writer) *JSONLines {
+	return &JSONLines{w: w}
+}
+
+// Event implements EventHook.
+func (j *JSONLines) Event(e *Event) {
+	line, err := json.Marshal(e)
+	if err == nil {
+		line = append(line, '\n')
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err == nil {
+		_, err = j.w.Write(line)
+	}
+	if err != nil && j.err == nil {
+		j.err = err
+	}
+}
+
+// Err returns the first error encountered writing events, so that callers
+// can detect a failing audit log.
+func (j *JSONLines) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
@@ -0,0 +1,191 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2f
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEvents(t *testing.T) {
+	var events []*Event
+	config := &Config{
+		SkipAttestationVerify: true,
+		Events:                EventHookFunc(func(e *Event) { events = append(events, e) }),
+	}
+
+	tc := newTestCredential(t)
+	c, _ := NewChallenge("https://example.com", []string{"https://example.com"})
+	reg, err := RegisterWebAuthn(tc.create(c, "packed"), *c, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc.counter = 5
+	if _, err := reg.AuthenticateWebAuthnWithConfig(tc.get(c), *c, 3, config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.AuthenticateWebAuthnWithConfig(tc.get(c), *c, 9, config); err != ErrCounterTooLow {
+		t.Fatalf("expected ErrCounterTooLow, got %v", err)
+	}
+	// U2F responses only report a counter that the token signed.
+	if _, err := reg.AuthenticateWithConfig(tc.u2fSign(c, 7, false), *c, 9, config); err != ErrCounterTooLow {
+		t.Fatalf("expected ErrCounterTooLow, got %v", err)
+	}
+	if _, err := reg.AuthenticateWithConfig(tc.u2fSign(c, 1, true), *c, 9, config); err != ErrInvalidSignature {
+		t.Fatalf("expected ErrInvalidSignature, got %v", err)
+	}
+	tc.origin = "https://evil.example.com"
+	if _, err := RegisterWebAuthn(tc.create(c, "packed"), *c, config); err == nil {
+		t.Fatal("expected error for wrong origin")
+	}
+	if _, err := Register(RegisterResponse{}, *c, config); err == nil {
+		t.Fatal("expected error for empty response")
+	}
+	if _, err := reg.AuthenticateWithConfig(SignResponse{}, *c, 0, config); err == nil {
+		t.Fatal("expected error for empty response")
+	}
+
+	// Without a config, nothing is reported.
+	if _, err := reg.AuthenticateWebAuthn(tc.get(c), *c, 0); err == nil {
+		t.Fatal("expected error for wrong origin")
+	}
+
+	f := reg.Fingerprint()
+	want := []Event{
+		{Ceremony: CeremonyRegister, Protocol: ProtocolWebAuthn, Origin: "https://example.com", Fingerprint: &f, Outcome: OutcomeSuccess},
+		{Ceremony: CeremonyAuthenticate, Protocol: ProtocolWebAuthn, Origin: "https://example.com", Fingerprint: &f, CounterBefore: 3, CounterAfter: 5, Outcome: OutcomeSuccess},
+		{Ceremony: CeremonyAuthenticate, Protocol: ProtocolWebAuthn, Origin: "https://example.com", Fingerprint: &f, CounterBefore: 9, CounterAfter: 5, Outcome: OutcomeFailure, Reason: ErrCounterTooLow.Error()},
+		{Ceremony: CeremonyAuthenticate, Protocol: ProtocolU2F, Origin: "https://example.com", Fingerprint: &f, CounterBefore: 9, CounterAfter: 7, Outcome: OutcomeFailure, Reason: ErrCounterTooLow.Error()},
+		{Ceremony: CeremonyAuthenticate, Protocol: ProtocolU2F, Origin: "https://example.com", Fingerprint: &f, CounterBefore: 9, Outcome: OutcomeFailure, Reason: ErrInvalidSignature.Error()},
+		{Ceremony: CeremonyRegister, Protocol: ProtocolWebAuthn, Origin: "https://evil.example.com", Outcome: OutcomeFailure, Reason: "u2f: untrusted facet id"},
+		{Ceremony: CeremonyRegister, Protocol: ProtocolU2F, Outcome: OutcomeFailure},
+		{Ceremony: CeremonyAuthenticate, Protocol: ProtocolU2F, Fingerprint: &f, Outcome: OutcomeFailure, Reason: "u2f: wrong key handle"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d", len(events), len(want))
+	}
+	for i, e := range events {
+		w := want[i]
+		if e.Ceremony != w.Ceremony || e.Protocol != w.Protocol || e.AppID != c.AppID || e.Origin != w.Origin ||
+			(e.Fingerprint == nil) != (w.Fingerprint == nil) || e.Fingerprint != nil && *e.Fingerprint != *w.Fingerprint ||
+			e.CounterBefore != w.CounterBefore || e.CounterAfter != w.CounterAfter || e.Outcome != w.Outcome {
+			t.Errorf("event %d: got %+v, want %+v", i, e, w)
+		}
+		if w.Reason != "" && e.Reason != w.Reason {
+			t.Errorf("event %d: reason %q, want %q", i, e.Reason, w.Reason)
+		}
+		if (e.Outcome == OutcomeFailure) != (e.Err != nil) || e.Err != nil && e.Err.Error() != e.Reason {
+			t.Errorf("event %d: inconsistent error %v and reason %q", i, e.Err, e.Reason)
+		}
+		if e.Time.IsZero() || e.Duration < 0 {
+			t.Errorf("event %d: invalid time %v or duration %v", i, e.Time, e.Duration)
+		}
+	}
+	if events[2].Err != ErrCounterTooLow {
+		t.Errorf("Err is not ErrCounterTooLow: %v", events[2].Err)
+	}
+}
+
+// u2fSign returns a U2F sign response of the credential, signed with
+// another key if forged.
+func (tc *testCredential) u2fSign(c *Challenge, counter uint32, forged bool) SignResponse {
+	key := tc.key
+	if forged {
+		var err error
+		if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			tc.t.Fatal(err)
+		}
+	}
+	clientData, _ := json.Marshal(ClientData{Typ: "navigator.id.getAssertion", Challenge: encodeBase64(c.Challenge), Origin: "https://example.com"})
+	appParam := sha256.Sum256([]byte(c.AppID))
+	challengeParam := sha256.Sum256(clientData)
+	header := []byte{1, byte(counter >> 24), byte(counter >> 16), byte(counter >> 8), byte(counter)}
+	hash := sha256.Sum256(append(append(appParam[:], header...), challengeParam[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	return SignResponse{
+		KeyHandle:     encodeBase64(tc.kh),
+		SignatureData: encodeBase64(append(header, sig...)),
+		ClientData:    encodeBase64(clientData),
+	}
+}
+
+func TestEventAttestationIssuer(t *testing.T) {
+	var got *Event
+	config := &Config{Events: EventHookFunc(func(e *Event) { got = e })}
+	reg := &Registration{Attestation: &AttestationSummary{Issuer: "CN=Example Root"}}
+	e := config.newEvent(context.Background(), CeremonyAuthenticate, ProtocolU2F, Challenge{})
+	config.emit(context.Background(), e, reg, nil)
+	if got == nil || got.AttestationIssuer != "CN=Example Root" {
+		t.Errorf("unexpected event: %+v", got)
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLines(&buf)
+	config := &Config{SkipAttestationVerify: true, Events: sink}
+
+	tc := newTestCredential(t)
+	c, _ := NewChallenge("https://example.com", []string{"https://example.com"})
+	resp := tc.create(c, "packed")
+	reg, err := RegisterWebAuthn(resp, *c, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signResp := tc.get(c)
+	reg.AuthenticateWebAuthnWithConfig(signResp, *c, 0, config)
+	reg.AuthenticateWebAuthnWithConfig(signResp, *c, 1, config)
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines: %q", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		var e map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		if e["fingerprint"] != reg.Fingerprint().String() || e["appId"] != c.AppID {
+			t.Errorf("unexpected event: %s", line)
+		}
+		// Nothing secret or replayable is logged.
+		for _, s := range []string{encodeBase64(c.Challenge), resp.Response.ClientDataJSON, signResp.Response.Signature, signResp.Response.AuthenticatorData} {
+			if strings.Contains(line, s) {
+				t.Errorf("event contains %q: %s", s, line)
+			}
+		}
+	}
+	if !strings.Contains(lines[2], `"outcome":"failure","reason":"u2f: counter too low"`) {
+		t.Errorf("unexpected failure event: %s", lines[2])
+	}
+	if err := sink.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	failing := NewJSONLines(failingWriter{})
+	failing.Event(&Event{})
+	if failing.Err() == nil {
+		t.Errorf("expected write error")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
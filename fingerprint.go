@@ -0,0 +1,90 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2f
+
+import (
+	"crypto/elliptic"
+	"crypto/sha256"
+	"errors"
+)
+
+// Fingerprint is a fixed-size identifier of a registration, suitable as a
+// database key. It is the SHA-256 hash of the uncompressed public key
+// followed by the key handle, so it does not depend on the AppID or on
+// whether the attestation certificate was kept.
+type Fingerprint [32]byte
+
+// Fingerprint returns the registration's fingerprint.
+func (r *Registration) Fingerprint() Fingerprint {
+	var buf []byte
+	if r.PubKey.Curve != nil {
+		buf = elliptic.Marshal(r.PubKey.Curve, r.PubKey.X, r.PubKey.Y)
+	}
+	buf = append(buf, r.KeyHandle...)
+	return sha256.Sum256(buf)
+}
+
+// String returns the fingerprint in unpadded base64url encoding.
+func (f Fingerprint) String() string {
+	return encodeBase64(f[:])
+}
+
+// ParseFingerprint parses the form returned by String.
+func ParseFingerprint(s string) (Fingerprint, error) {
+	var f Fingerprint
+	b, err := decodeBase64(s)
+	if err != nil {
+		return f, err
+	}
+	if len(b) != len(f) {
+		return f, errors.New("u2f: invalid fingerprint length")
+	}
+	copy(f[:], b)
+	return f, nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (f Fingerprint) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (f *Fingerprint) UnmarshalText(text []byte) error {
+	parsed, err := ParseFingerprint(string(text))
+	if err != nil {
+		return err
+	}
+	*f = parsed
+	return nil
+}
+
+// FindRegistration returns the registration that a SignResponse with the
+// key handle was made with, or nil if there is none. Applications can use
+// its fingerprint to look up the counter to pass to Authenticate.
+func FindRegistration(regs []Registration, keyHandle string) *Registration {
+	for i := range regs {
+		if encodeBase64(regs[i].KeyHandle) == keyHandle {
+			return &regs[i]
+		}
+	}
+	return nil
+}
+
+// uniqueRegistrations returns regs without the registrations with the same
+// fingerprint as an earlier one.
+func uniqueRegistrations(regs []Registration) []Registration {
+	seen := make(map[Fingerprint]bool, len(regs))
+	unique := make([]Registration, 0, len(regs))
+	for _, r := range regs {
+		f := r.Fingerprint()
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+		unique = append(unique, r)
+	}
+	return unique
+}
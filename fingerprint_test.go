@@ -0,0 +1,87 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2f
+
+import (
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	regResp, _ := hex.DecodeString(testRegRespHex)
+	reg, _, err := parseRegistration(regResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := reg.Fingerprint()
+	pk := elliptic.Marshal(reg.PubKey.Curve, reg.PubKey.X, reg.PubKey.Y)
+	if f != sha256.Sum256(append(pk, reg.KeyHandle...)) {
+		t.Errorf("unexpected fingerprint %s", f)
+	}
+
+	// The fingerprint doesn't depend on the attestation certificate.
+	stripped := *reg
+	if err := stripped.stripAttestationCert(false); err != nil {
+		t.Fatal(err)
+	}
+	if stripped.Fingerprint() != f {
+		t.Errorf("fingerprint changed when stripping the certificate")
+	}
+
+	if len(f.String()) != 43 {
+		t.Errorf("unexpected printable form %q", f)
+	}
+	parsed, err := ParseFingerprint(f.String())
+	if err != nil || parsed != f {
+		t.Errorf("fingerprint differs after round trip: %v", err)
+	}
+	if _, err := ParseFingerprint(f.String()[:40]); err == nil {
+		t.Errorf("expected error for truncated fingerprint")
+	}
+
+	buf, err := json.Marshal(map[Fingerprint]uint32{f: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != `{"`+f.String()+`":1}` {
+		t.Errorf("unexpected JSON: %s", buf)
+	}
+	var counters map[Fingerprint]uint32
+	if err := json.Unmarshal(buf, &counters); err != nil || counters[f] != 1 {
+		t.Errorf("JSON round trip failed: %v", err)
+	}
+}
+
+func TestFindRegistration(t *testing.T) {
+	regResp, _ := hex.DecodeString(testRegRespHex)
+	reg, _, err := parseRegistration(regResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := *reg
+	other.KeyHandle = []byte("other key handle")
+	regs := []Registration{other, *reg, *reg}
+
+	found := FindRegistration(regs, encodeBase64(reg.KeyHandle))
+	if found != &regs[1] {
+		t.Errorf("found the wrong registration")
+	}
+	if FindRegistration(regs, "unknown") != nil {
+		t.Errorf("found a registration for an unknown key handle")
+	}
+
+	c, _ := NewChallenge("https://example.com", []string{"https://example.com"})
+	if n := len(c.SignRequest(regs).RegisteredKeys); n != 2 {
+		t.Errorf("expected duplicate registrations to be listed once, got %d keys", n)
+	}
+	if n := len(NewWebRegisterRequest(c, regs).RegisteredKeys); n != 2 {
+		t.Errorf("expected duplicate registrations to be listed once, got %d keys", n)
+	}
+}
@@ -0,0 +1,395 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package cbor implements the subset of the Concise Binary Object
+// Representation (RFC 7049) needed for WebAuthn attestation objects and
+// COSE keys.
+//
+// Values are mapped to Go types as follows:
+//
+//	unsigned and negative integers  int64
+//	byte strings                    []byte
+//	text strings                    string
+//	arrays                          []interface{}
+//	maps                            map[interface{}]interface{}
+//	false, true                     bool
+//	null                            nil
+//
+// Map keys must be integers or text strings. Floating point numbers, tags,
+// undefined and indefinite length items are not supported.
+//
+// Encoding is canonical as defined in section 3.9 of RFC 7049: integers and
+// lengths use the shortest form and map keys are sorted by the length of
+// their encoding, then bytewise. Decoding is strict: non-canonical integers,
+// duplicate map keys, invalid UTF-8 and nesting deeper than MaxDepth are
+// rejected.
+package cbor
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sort"
+	"unicode/utf8"
+)
+
+// MaxDepth is the maximum nesting of arrays and maps accepted by the decoder.
+const MaxDepth = 16
+
+// MaxSize is the maximum encoded size accepted by the decoder.
+const MaxSize = 64 * 1024
+
+const (
+	majorUint   = 0
+	majorNegInt = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+const (
+	simpleFalse = 20
+	simpleTrue  = 21
+	simpleNull  = 22
+)
+
+var (
+	errTruncated    = errors.New("cbor: unexpected end of data")
+	errTrailingData = errors.New("cbor: trailing data")
+	errTooDeep      = errors.New("cbor: nesting too deep")
+	errTooLarge     = errors.New("cbor: data too large")
+	errNonCanonical = errors.New("cbor: non-canonical encoding")
+	errUnsupported  = errors.New("cbor: unsupported item")
+)
+
+// Marshal returns the canonical CBOR encoding of v.
+func Marshal(v interface{}) ([]byte, error) {
+	var e encoder
+	if err := e.encode(v); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+// Unmarshal decodes a single CBOR data item. It is an error for data to
+// contain anything after the item.
+func Unmarshal(data []byte) (interface{}, error) {
+	v, rest, err := UnmarshalFirst(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errTrailingData
+	}
+	return v, nil
+}
+
+// UnmarshalFirst decodes the first CBOR data item in data and returns the
+// remaining bytes.
+func UnmarshalFirst(data []byte) (v interface{}, rest []byte, err error) {
+	if len(data) > MaxSize {
+		return nil, nil, errTooLarge
+	}
+	d := decoder{data: data}
+	v, err = d.decode(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, d.data[d.off:], nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) writeHead(major byte, n uint64) {
+	switch {
+	case n < 24:
+		e.buf.WriteByte(major<<5 | byte(n))
+	case n <= math.MaxUint8:
+		e.buf.Write([]byte{major<<5 | 24, byte(n)})
+	case n <= math.MaxUint16:
+		e.buf.Write([]byte{major<<5 | 25, byte(n >> 8), byte(n)})
+	case n <= math.MaxUint32:
+		e.buf.Write([]byte{major<<5 | 26,
+			byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+	default:
+		e.buf.Write([]byte{major<<5 | 27,
+			byte(n >> 56), byte(n >> 48), byte(n >> 40), byte(n >> 32),
+			byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+	}
+}
+
+func (e *encoder) encodeInt(n int64) {
+	if n >= 0 {
+		e.writeHead(majorUint, uint64(n))
+	} else {
+		e.writeHead(majorNegInt, uint64(-(n + 1)))
+	}
+}
+
+func (e *encoder) encode(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		e.buf.WriteByte(majorSimple<<5 | simpleNull)
+	case bool:
+		if v {
+			e.buf.WriteByte(majorSimple<<5 | simpleTrue)
+		} else {
+			e.buf.WriteByte(majorSimple<<5 | simpleFalse)
+		}
+	case int:
+		e.encodeInt(int64(v))
+	case int64:
+		e.encodeInt(v)
+	case uint64:
+		e.writeHead(majorUint, v)
+	case []byte:
+		e.writeHead(majorBytes, uint64(len(v)))
+		e.buf.Write(v)
+	case string:
+		if !utf8.ValidString(v) {
+			return errors.New("cbor: invalid utf-8 in text string")
+		}
+		e.writeHead(majorText, uint64(len(v)))
+		e.buf.WriteString(v)
+	case []interface{}:
+		e.writeHead(majorArray, uint64(len(v)))
+		for _, item := range v {
+			if err := e.encode(item); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		return e.encodeMap(v)
+	default:
+		return errUnsupported
+	}
+	return nil
+}
+
+type mapEntry struct {
+	key   []byte
+	value interface{}
+}
+
+func (e *encoder) encodeMap(m map[interface{}]interface{}) error {
+	entries := make([]mapEntry, 0, len(m))
+	for k, v := range m {
+		switch k.(type) {
+		case int, int64, uint64, string:
+		default:
+			return errors.New("cbor: unsupported map key type")
+		}
+		key, err := Marshal(k)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, mapEntry{key, v})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return keyLess(entries[i].key, entries[j].key)
+	})
+
+	e.writeHead(majorMap, uint64(len(entries)))
+	for i, entry := range entries {
+		if i > 0 && bytes.Equal(entries[i-1].key, entry.key) {
+			return errors.New("cbor: duplicate map key")
+		}
+		e.buf.Write(entry.key)
+		if err := e.encode(entry.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyLess orders encoded map keys canonically: shorter keys first, then
+// bytewise.
+func keyLess(a, b []byte) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return bytes.Compare(a, b) < 0
+}
+
+type decoder struct {
+	data []byte
+	off  int
+}
+
+func (d *decoder) readHead() (major byte, n uint64, err error) {
+	if d.off >= len(d.data) {
+		return 0, 0, errTruncated
+	}
+	b := d.data[d.off]
+	d.off++
+	major = b >> 5
+	info := b & 0x1f
+
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		// Reserved values and indefinite lengths.
+		return 0, 0, errUnsupported
+	}
+
+	if len(d.data)-d.off < size {
+		return 0, 0, errTruncated
+	}
+	for _, c := range d.data[d.off : d.off+size] {
+		n = n<<8 | uint64(c)
+	}
+	d.off += size
+
+	if major != majorSimple {
+		var min uint64
+		switch size {
+		case 1:
+			min = 24
+		case 2:
+			min = math.MaxUint8 + 1
+		case 4:
+			min = math.MaxUint16 + 1
+		case 8:
+			min = math.MaxUint32 + 1
+		}
+		if n < min {
+			return 0, 0, errNonCanonical
+		}
+	}
+	return major, n, nil
+}
+
+func (d *decoder) readBytes(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.off) {
+		return nil, errTruncated
+	}
+	b := d.data[d.off : d.off+int(n)]
+	d.off += int(n)
+	return b, nil
+}
+
+func (d *decoder) decode(depth int) (interface{}, error) {
+	if depth > MaxDepth {
+		return nil, errTooDeep
+	}
+
+	start := d.off
+	major, n, err := d.readHead()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUint:
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: integer overflow")
+		}
+		return int64(n), nil
+
+	case majorNegInt:
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: integer overflow")
+		}
+		return -1 - int64(n), nil
+
+	case majorBytes:
+		b, err := d.readBytes(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+
+	case majorText:
+		b, err := d.readBytes(n)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(b) {
+			return nil, errors.New("cbor: invalid utf-8 in text string")
+		}
+		return string(b), nil
+
+	case majorArray:
+		// Every item takes at least one byte, which bounds the allocation.
+		if n > uint64(len(d.data)-d.off) {
+			return nil, errTruncated
+		}
+		a := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+
+	case majorMap:
+		if n > uint64(len(d.data)-d.off)/2 {
+			return nil, errTruncated
+		}
+		m := make(map[interface{}]interface{}, n)
+		var prevKey []byte
+		for i := uint64(0); i < n; i++ {
+			keyStart := d.off
+			k, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, errors.New("cbor: unsupported map key type")
+			}
+			key := d.data[keyStart:d.off]
+			if prevKey != nil && !keyLess(prevKey, key) {
+				if bytes.Equal(prevKey, key) {
+					return nil, errors.New("cbor: duplicate map key")
+				}
+				return nil, errNonCanonical
+			}
+			prevKey = key
+
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+
+	case majorSimple:
+		if d.off-start != 1 {
+			return nil, errUnsupported
+		}
+		switch n {
+		case simpleFalse:
+			return false, nil
+		case simpleTrue:
+			return true, nil
+		case simpleNull:
+			return nil, nil
+		}
+		return nil, errUnsupported
+	}
+
+	// Tags.
+	return nil, errUnsupported
+}
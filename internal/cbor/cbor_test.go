@@ -0,0 +1,140 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	// Examples from Appendix A of RFC 7049.
+	tests := []struct {
+		v   interface{}
+		hex string
+	}{
+		{0, "00"},
+		{23, "17"},
+		{24, "1818"},
+		{1000, "1903e8"},
+		{1000000, "1a000f4240"},
+		{uint64(18446744073709551615), "1bffffffffffffffff"},
+		{-1, "20"},
+		{-1000, "3903e7"},
+		{false, "f4"},
+		{true, "f5"},
+		{nil, "f6"},
+		{[]byte{1, 2, 3, 4}, "4401020304"},
+		{"IETF", "6449455446"},
+		{"ü", "62c3bc"},
+		{[]interface{}{1, []interface{}{2, 3}}, "8201820203"},
+		{map[interface{}]interface{}{1: 2, 3: 4}, "a201020304"},
+		{map[interface{}]interface{}{"a": 1, "b": []interface{}{2, 3}}, "a26161016162820203"},
+		// Canonical ordering: shorter keys first, then bytewise.
+		{map[interface{}]interface{}{"aa": 0, "b": 0, -1: 0, 10: 0}, "a40a002000616200626161" + "00"},
+	}
+
+	for _, test := range tests {
+		buf, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Marshal(%#v) error: %v", test.v, err)
+			continue
+		}
+		if hex.EncodeToString(buf) != test.hex {
+			t.Errorf("Marshal(%#v) = %x, expected %s", test.v, buf, test.hex)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	v := map[interface{}]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[interface{}]interface{}{},
+		"authData": bytes.Repeat([]byte{0xaa}, 300),
+		int64(-3):  []interface{}{int64(1), "x", nil, true},
+	}
+	buf, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Unmarshal(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("round trip mismatch: %#v vs %#v", got, v)
+	}
+}
+
+func TestUnmarshalFirst(t *testing.T) {
+	buf, _ := hex.DecodeString("a201020304ffee")
+	v, rest, err := UnmarshalFirst(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v, map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}) {
+		t.Errorf("unexpected value: %#v", v)
+	}
+	if hex.EncodeToString(rest) != "ffee" {
+		t.Errorf("unexpected rest: %x", rest)
+	}
+
+	if _, err := Unmarshal(buf); err == nil {
+		t.Errorf("expected trailing data error")
+	}
+}
+
+func TestUnmarshalStrict(t *testing.T) {
+	tests := []string{
+		"",                   // empty
+		"1817",               // non-canonical integer
+		"190017",             // non-canonical integer
+		"1bffffffffffffffff", // overflows int64
+		"5f",                 // indefinite length byte string
+		"9f01ff",             // indefinite length array
+		"c11a514b67b0",       // tag
+		"f93c00",             // float
+		"f7",                 // undefined
+		"4401",               // truncated byte string
+		"62c3",               // truncated text string
+		"62fffe",             // invalid utf-8
+		"a2010203",           // truncated map
+		"a203040102",         // unsorted map keys
+		"a201020103",         // duplicate map key
+		"a1440102030401",     // byte string map key
+		"9a7fffffff",         // huge array length
+		"bb7fffffffffffffff", // huge map length
+	}
+
+	for _, test := range tests {
+		buf, _ := hex.DecodeString(test)
+		if v, err := Unmarshal(buf); err == nil {
+			t.Errorf("Unmarshal(%s) = %#v, expected error", test, v)
+		}
+	}
+}
+
+func TestUnmarshalDepth(t *testing.T) {
+	deep, _ := hex.DecodeString(strings.Repeat("81", MaxDepth) + "00")
+	if _, err := Unmarshal(deep); err != nil {
+		t.Errorf("Unmarshal at max depth error: %v", err)
+	}
+
+	tooDeep, _ := hex.DecodeString(strings.Repeat("81", MaxDepth+1) + "00")
+	if _, err := Unmarshal(tooDeep); err == nil {
+		t.Errorf("expected error for nesting deeper than MaxDepth")
+	}
+}
+
+func TestUnmarshalSize(t *testing.T) {
+	buf, _ := Marshal(make([]byte, MaxSize))
+	if _, err := Unmarshal(buf); err == nil {
+		t.Errorf("expected error for data larger than MaxSize")
+	}
+}
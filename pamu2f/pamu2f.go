@@ -0,0 +1,248 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+/*
+Package pamu2f converts registrations to and from the authfile format of
+pam_u2f, the Linux PAM module for U2F tokens, usually found in
+~/.config/Yubico/u2f_keys.
+
+Each line of an authfile holds a user name followed by the user's
+credentials, separated by colons:
+
+	alice:keyHandle,publicKey,es256,+presence:keyHandle,publicKey,es256,+presence
+
+Since pam_u2f 1.1 the key handle and public key are base64 encoded and
+followed by the COSE algorithm and the authenticator options. Older versions
+only wrote the key handle, base64url encoded, and the uncompressed public
+key, hex encoded. Both forms are parsed; Write uses the form each credential
+was read in.
+
+pam_u2f uses pam://hostname as its default AppID: challenges for
+registrations that are shared with pam_u2f must use the same AppID.
+
+Registrations read from an authfile have no Raw data or attestation
+certificate; MarshalBinary stores them in its compact encoding.
+*/
+package pamu2f
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/tstranex/u2f"
+)
+
+// COSETypeES256 is the only COSE algorithm used by U2F tokens.
+const COSETypeES256 = "es256"
+
+// DefaultOptions are the options pamu2fcfg writes for a credential that
+// requires user presence.
+const DefaultOptions = "+presence"
+
+// Credential is a single registration in an authfile.
+type Credential struct {
+	Registration u2f.Registration
+
+	// Options are the authenticator options, e.g. "+presence". They are
+	// empty in the old format.
+	Options string
+
+	// OldFormat is set for credentials in the format of pam_u2f before 1.1.
+	OldFormat bool
+}
+
+// Entry is a line of an authfile: a user and their credentials.
+type Entry struct {
+	User        string
+	Credentials []Credential
+}
+
+// NewEntry creates an entry in the current format for the user's
+// registrations, with DefaultOptions. Registrations with the same fingerprint
+// are only written once.
+func NewEntry(user string, regs []u2f.Registration) *Entry {
+	e := &Entry{User: user}
+	seen := make(map[u2f.Fingerprint]bool)
+	for _, reg := range regs {
+		f := reg.Fingerprint()
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+		e.Credentials = append(e.Credentials, Credential{
+			Registration: reg,
+			Options:      DefaultOptions,
+		})
+	}
+	return e
+}
+
+// Registrations returns the registrations of the entry's credentials.
+func (e *Entry) Registrations() []u2f.Registration {
+	regs := make([]u2f.Registration, len(e.Credentials))
+	for i, c := range e.Credentials {
+		regs[i] = c.Registration
+	}
+	return regs
+}
+
+// Parse reads an authfile. Blank lines and lines starting with # are
+// skipped.
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		e, err := parseLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("pamu2f: line %d: %v", line, err)
+		}
+		entries = append(entries, *e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ParseLine parses a single line of an authfile.
+func ParseLine(line string) (*Entry, error) {
+	e, err := parseLine(line)
+	if err != nil {
+		return nil, fmt.Errorf("pamu2f: %v", err)
+	}
+	return e, nil
+}
+
+func parseLine(line string) (*Entry, error) {
+	fields := strings.Split(strings.TrimSpace(line), ":")
+	if len(fields) < 2 || fields[0] == "" {
+		return nil, errors.New("missing user name")
+	}
+
+	e := &Entry{User: fields[0]}
+	for _, field := range fields[1:] {
+		c, err := parseCredential(field)
+		if err != nil {
+			return nil, err
+		}
+		e.Credentials = append(e.Credentials, *c)
+	}
+	return e, nil
+}
+
+func parseCredential(field string) (*Credential, error) {
+	parts := strings.Split(field, ",")
+	switch len(parts) {
+	case 2:
+		kh, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[0], "="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key handle: %v", err)
+		}
+		pk, err := hex.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key: %v", err)
+		}
+		x, y := elliptic.Unmarshal(elliptic.P256(), pk)
+		if x == nil {
+			return nil, errors.New("invalid public key")
+		}
+		return newCredential(kh, x, y, "", true), nil
+
+	case 4:
+		if parts[2] != COSETypeES256 {
+			return nil, fmt.Errorf("unsupported COSE type %q", parts[2])
+		}
+		kh, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid key handle: %v", err)
+		}
+		pk, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key: %v", err)
+		}
+		// The public key is the raw x and y coordinates.
+		if len(pk) != 64 {
+			return nil, errors.New("invalid public key")
+		}
+		x := new(big.Int).SetBytes(pk[:32])
+		y := new(big.Int).SetBytes(pk[32:])
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("invalid public key")
+		}
+		return newCredential(kh, x, y, parts[3], false), nil
+	}
+	return nil, errors.New("invalid credential")
+}
+
+func newCredential(kh []byte, x, y *big.Int, options string, oldFormat bool) *Credential {
+	return &Credential{
+		Registration: u2f.Registration{
+			KeyHandle: kh,
+			PubKey:    ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y},
+		},
+		Options:   options,
+		OldFormat: oldFormat,
+	}
+}
+
+// String returns the authfile line of the entry, without a newline.
+func (e *Entry) String() string {
+	s := e.User
+	for _, c := range e.Credentials {
+		s += ":" + c.String()
+	}
+	return s
+}
+
+// String returns the credential as written in an authfile.
+func (c *Credential) String() string {
+	pk := &c.Registration.PubKey
+	if c.OldFormat {
+		return base64.RawURLEncoding.EncodeToString(c.Registration.KeyHandle) + "," +
+			hex.EncodeToString(elliptic.Marshal(pk.Curve, pk.X, pk.Y))
+	}
+
+	raw := make([]byte, 64)
+	pk.X.FillBytes(raw[:32])
+	pk.Y.FillBytes(raw[32:])
+	return base64.StdEncoding.EncodeToString(c.Registration.KeyHandle) + "," +
+		base64.StdEncoding.EncodeToString(raw) + "," +
+		COSETypeES256 + "," + c.Options
+}
+
+// Write writes the entries as an authfile.
+func Write(w io.Writer, entries []Entry) error {
+	for _, e := range entries {
+		if e.User == "" || strings.ContainsAny(e.User, ":\n") {
+			return fmt.Errorf("pamu2f: invalid user name %q", e.User)
+		}
+		if len(e.Credentials) == 0 {
+			continue
+		}
+		for _, c := range e.Credentials {
+			if strings.ContainsAny(c.Options, ",:\n") {
+				return fmt.Errorf("pamu2f: invalid options %q", c.Options)
+			}
+		}
+		if _, err := io.WriteString(w, e.String()+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package pamu2f
+
+import (
+	"bytes"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/softtoken"
+)
+
+const appID = "pam://host.example.com"
+
+func authenticate(t *testing.T, token *softtoken.Token, reg *u2f.Registration) {
+	c, _ := u2f.NewChallenge(appID, []string{appID})
+	resp, err := token.Sign(c.SignRequest([]u2f.Registration{*reg}), appID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.Authenticate(*resp, *c, 0); err != nil {
+		t.Errorf("authentication with imported registration failed: %v", err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	token := softtoken.NewTest(t)
+	reg1 := token.Enrol(t, appID)
+	reg2 := token.Enrol(t, appID)
+
+	alice := NewEntry("alice", []u2f.Registration{*reg1, *reg1})
+	if len(alice.Credentials) != 1 {
+		t.Errorf("expected duplicate registrations to be written once")
+	}
+	bob := NewEntry("bob", []u2f.Registration{*reg2})
+	bob.Credentials[0].OldFormat = true
+	bob.Credentials = append(bob.Credentials, alice.Credentials[0])
+
+	var buf bytes.Buffer
+	if err := Write(&buf, []Entry{*alice, *bob}); err != nil {
+		t.Fatal(err)
+	}
+
+	pk1 := elliptic.Marshal(reg1.PubKey.Curve, reg1.PubKey.X, reg1.PubKey.Y)
+	pk2 := elliptic.Marshal(reg2.PubKey.Curve, reg2.PubKey.X, reg2.PubKey.Y)
+	cred1 := base64.StdEncoding.EncodeToString(reg1.KeyHandle) + "," +
+		base64.StdEncoding.EncodeToString(pk1[1:]) + ",es256,+presence"
+	cred2 := base64.RawURLEncoding.EncodeToString(reg2.KeyHandle) + "," + hex.EncodeToString(pk2)
+	expected := "alice:" + cred1 + "\nbob:" + cred2 + ":" + cred1 + "\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected authfile:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+
+	entries, err := Parse(strings.NewReader("# generated\n\n" + buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].User != "alice" || entries[1].User != "bob" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	regs := entries[1].Registrations()
+	if len(regs) != 2 || !entries[1].Credentials[0].OldFormat || entries[1].Credentials[1].OldFormat {
+		t.Fatalf("unexpected credentials: %+v", entries[1].Credentials)
+	}
+	if entries[1].Credentials[1].Options != DefaultOptions {
+		t.Errorf("unexpected options: %q", entries[1].Credentials[1].Options)
+	}
+	authenticate(t, token, &regs[0])
+	authenticate(t, token, &regs[1])
+
+	var out bytes.Buffer
+	if err := Write(&out, entries); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != expected {
+		t.Errorf("authfile differs after round trip:\n%s", out.String())
+	}
+}
+
+func TestParseLineErrors(t *testing.T) {
+	for _, line := range []string{
+		"alice",
+		":khkh,04",
+		"alice:khkh",
+		"alice:khkh,0401",
+		"alice:a2g=,AAAA,es256,+presence",
+		"alice:a2g=,AAAA,eddsa,+presence",
+		"alice:a2g=,AAAA,es256",
+	} {
+		if _, err := ParseLine(line); err == nil {
+			t.Errorf("%q: expected error", line)
+		}
+	}
+
+	if _, err := Parse(strings.NewReader("\nalice\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected error on line 2, got %v", err)
+	}
+}
+
+func TestWriteInvalid(t *testing.T) {
+	for _, e := range []Entry{
+		{User: "al:ice"},
+		{User: ""},
+		{User: "alice", Credentials: []Credential{{Options: "+presence,+pin"}}},
+	} {
+		if err := Write(&bytes.Buffer{}, []Entry{e}); err == nil {
+			t.Errorf("%+v: expected error", e)
+		}
+	}
+}
@@ -6,6 +6,7 @@
 package u2f
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/sha256"
@@ -19,7 +20,8 @@ import (
 // Registration represents a single enrolment or pairing between an
 // application and a token. This data will typically be stored in a database.
 type Registration struct {
-	// Raw serialized registration data as received from the token.
+	// Raw serialized registration data as received from the token, or the
+	// compact encoding written by MarshalBinary.
 	Raw []byte
 
 	KeyHandle []byte
@@ -27,6 +29,25 @@ type Registration struct {
 
 	// AttestationCert can be nil for Authenticate requests.
 	AttestationCert *x509.Certificate
+
+	// Attestation summarizes the attestation certificate of registrations
+	// made with Config.StripAttestationCert. It is nil otherwise.
+	Attestation *AttestationSummary
+}
+
+// AttestationSummary is what is kept of an attestation certificate after it
+// is stripped from a registration.
+type AttestationSummary struct {
+	// CertDigest is the SHA-256 hash of the DER encoded certificate.
+	CertDigest [32]byte
+
+	// Trusted reports whether the certificate was verified against the
+	// root certificates. It is false if SkipAttestationVerify was set.
+	Trusted bool
+
+	// Issuer is the distinguished name of the certificate's issuer, which
+	// identifies the token vendor.
+	Issuer string
 }
 
 // Config contains configurable options for the package.
@@ -41,18 +62,53 @@ type Config struct {
 	// to verify client attestations. If nil, this defaults to the roots that are
 	// bundled in this library.
 	RootAttestationCertPool *x509.CertPool
+
+	// StripAttestationCert makes Register drop the attestation certificate,
+	// which may identify a batch of tokens, after verifying it. The returned
+	// Registration keeps only an AttestationSummary and its Raw data is
+	// replaced with the compact encoding, so stored registrations contain no
+	// certificate.
+	StripAttestationCert bool
+
+	// Events, if set, receives an Event for every registration and
+	// authentication made with this Config, successful or not.
+	Events EventHook
+
+	// TraceID, if set, returns the trace ID of a ceremony's context, for
+	// its Event.
+	TraceID func(ctx context.Context) string
 }
 
 // Register validates a RegisterResponse message to enrol a new token.
 // An error is returned if any part of the response fails to validate.
 // The returned Registration should be stored by the caller.
 func Register(resp RegisterResponse, c Challenge, config *Config) (*Registration, error) {
+	return RegisterContext(context.Background(), resp, c, config)
+}
+
+// RegisterContext is Register with a context, which is passed to the Events
+// hook. An error is returned if the context is done.
+func RegisterContext(ctx context.Context, resp RegisterResponse, c Challenge, config *Config) (*Registration, error) {
 	if config == nil {
 		config = &Config{}
 	}
 
+	e := config.newEvent(ctx, CeremonyRegister, ProtocolU2F, c)
+	var reg *Registration
+	err := ctx.Err()
+	if err == nil {
+		reg, err = register(resp, c, config)
+	}
+	if e != nil {
+		e.Origin = clientDataOrigin(resp.ClientData)
+		config.emit(ctx, e, reg, err)
+	}
+	return reg, err
+}
+
+func register(resp RegisterResponse, c Challenge, config *Config) (*Registration, error) {
 	if time.Now().Sub(c.Timestamp) > timeout {
-		return nil, errors.New("u2f: challenge has expired")
+		return nil, ErrChallengeExpired
 	}
 
 	regData, err := decodeBase64(resp.RegistrationData)
@@ -70,7 +126,7 @@ func Register(resp RegisterResponse, c Challenge, config *Config) (*Registration
 		return nil, err
 	}
 
-	if err := verifyClientData(clientData, c); err != nil {
+	if err := VerifyClientData(clientData, c); err != nil {
 		return nil, err
 	}
 
@@ -78,13 +134,39 @@ func Register(resp RegisterResponse, c Challenge, config *Config) (*Registration
 		return nil, err
 	}
 
-	if err := verifyRegistrationSignature(*reg, sig, c.AppID, clientData); err != nil {
+	if err := verifyRegistrationSignature(*reg, sig, c.AppID, clientData); err == ErrInvalidSignature {
 		return nil, err
+	} else if err != nil {
+		return nil, &AttestationError{err}
+	}
+
+	if config.StripAttestationCert {
+		if err := reg.stripAttestationCert(!config.SkipAttestationVerify); err != nil {
+			return nil, err
+		}
 	}
 
 	return reg, nil
 }
 
+// stripAttestationCert replaces the attestation certificate with a summary.
+func (r *Registration) stripAttestationCert(trusted bool) error {
+	r.Attestation = &AttestationSummary{
+		CertDigest: sha256.Sum256(r.AttestationCert.Raw),
+		Trusted:    trusted,
+		Issuer:     r.AttestationCert.Issuer.String(),
+	}
+	r.AttestationCert = nil
+	r.Raw = nil
+
+	raw, err := r.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	r.Raw = raw
+	return nil
+}
+
 func parseRegistration(buf []byte) (*Registration, []byte, error) {
 	if len(buf) < 1+65+1+1+1 {
 		return nil, nil, errors.New("u2f: data is too short")
@@ -135,8 +217,59 @@ func parseRegistration(buf []byte) (*Registration, []byte, error) {
 	return &r, sig, nil
 }
 
-// UnmarshalBinary implements encoding.BinaryMarshaler.
+// RegistrationData is the decoded form of a registration response message as
+// defined by the FIDO U2F Raw Message Formats specification.
+type RegistrationData struct {
+	Registration
+
+	// Signature is the DER encoded attestation signature.
+	Signature []byte
+
+	// CertFixed reports whether the attestation certificate is one of the
+	// known malformed certificates and was corrected before parsing.
+	CertFixed bool
+}
+
+// ParseRegistrationData decodes a registration response message, i.e. the
+// decoded RegistrationData field of a RegisterResponse. No signatures or
+// certificates are verified.
+func ParseRegistrationData(data []byte) (*RegistrationData, error) {
+	orig := data
+	data = append([]byte(nil), data...)
+	reg, sig, err := parseRegistration(data)
+	if err != nil {
+		return nil, err
+	}
+
+	certOffset := 1 + 65 + 1 + len(reg.KeyHandle)
+	cert := append([]byte(nil), orig[certOffset:certOffset+len(reg.AttestationCert.Raw)]...)
+	fixed := fixCertIfNeed(cert)
+
+	return &RegistrationData{Registration: *reg, Signature: sig, CertFixed: fixed}, nil
+}
+
+// compactVersion is the first byte of the compact registration encoding. It
+// differs from the reserved byte 0x05 of raw registration data.
+const compactVersion = 0x01
+
+// Flags of the compact registration encoding.
+const (
+	compactHasCert        = 0x01
+	compactHasAttestation = 0x02
+)
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It accepts both raw
+// registration data and the compact encoding written by MarshalBinary.
 func (r *Registration) UnmarshalBinary(data []byte) error {
+	if len(data) > 0 && data[0] == compactVersion {
+		reg, err := parseCompactRegistration(data)
+		if err != nil {
+			return err
+		}
+		*r = *reg
+		return nil
+	}
+
 	reg, _, err := parseRegistration(data)
 	if err != nil {
 		return err
@@ -145,9 +278,136 @@ func (r *Registration) UnmarshalBinary(data []byte) error {
 	return nil
 }
 
-// MarshalBinary implements encoding.BinaryUnmarshaler.
+// MarshalBinary implements encoding.BinaryMarshaler. It returns Raw if set.
+// Otherwise, e.g. for registrations imported from other systems or with Raw
+// cleared to drop the attestation certificate, it encodes the public key, key
+// handle and optional attestation certificate and summary in a compact
+// format:
+//
+//	version (0x01) | public key (65) | key handle length (1) | key handle |
+//	flags (1) | [certificate length (2) | certificate] |
+//	[certificate digest (32) | trusted (1) | issuer length (2) | issuer]
 func (r *Registration) MarshalBinary() ([]byte, error) {
-	return r.Raw, nil
+	if r.Raw != nil {
+		return r.Raw, nil
+	}
+
+	if r.PubKey.Curve != elliptic.P256() || r.PubKey.X == nil {
+		return nil, errors.New("u2f: invalid public key")
+	}
+	if len(r.KeyHandle) == 0 || len(r.KeyHandle) > 255 {
+		return nil, errors.New("u2f: invalid key handle")
+	}
+
+	buf := []byte{compactVersion}
+	buf = append(buf, elliptic.Marshal(r.PubKey.Curve, r.PubKey.X, r.PubKey.Y)...)
+	buf = append(buf, byte(len(r.KeyHandle)))
+	buf = append(buf, r.KeyHandle...)
+
+	var flags byte
+	if r.AttestationCert != nil {
+		flags |= compactHasCert
+	}
+	if r.Attestation != nil {
+		flags |= compactHasAttestation
+	}
+	buf = append(buf, flags)
+
+	if r.AttestationCert != nil {
+		cert := r.AttestationCert.Raw
+		if len(cert) > 0xffff {
+			return nil, errors.New("u2f: attestation certificate is too long")
+		}
+		buf = append(buf, byte(len(cert)>>8), byte(len(cert)))
+		buf = append(buf, cert...)
+	}
+
+	if a := r.Attestation; a != nil {
+		if len(a.Issuer) > 0xffff {
+			return nil, errors.New("u2f: attestation issuer is too long")
+		}
+		buf = append(buf, a.CertDigest[:]...)
+		if a.Trusted {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+		buf = append(buf, byte(len(a.Issuer)>>8), byte(len(a.Issuer)))
+		buf = append(buf, a.Issuer...)
+	}
+	return buf, nil
+}
+
+func parseCompactRegistration(data []byte) (*Registration, error) {
+	buf := data
+	if len(buf) < 1+65+1 {
+		return nil, errors.New("u2f: data is too short")
+	}
+	buf = buf[1:]
+
+	var r Registration
+	x, y := elliptic.Unmarshal(elliptic.P256(), buf[:65])
+	if x == nil {
+		return nil, errors.New("u2f: invalid public key")
+	}
+	r.PubKey.Curve = elliptic.P256()
+	r.PubKey.X = x
+	r.PubKey.Y = y
+	buf = buf[65:]
+
+	khLen := int(buf[0])
+	buf = buf[1:]
+	if khLen == 0 || len(buf) < khLen+1 {
+		return nil, errors.New("u2f: invalid key handle")
+	}
+	r.KeyHandle = append([]byte(nil), buf[:khLen]...)
+	buf = buf[khLen:]
+
+	flags := buf[0]
+	buf = buf[1:]
+	if flags&^(compactHasCert|compactHasAttestation) != 0 {
+		return nil, errors.New("u2f: unknown registration flags")
+	}
+
+	if flags&compactHasCert != 0 {
+		if len(buf) < 2 {
+			return nil, errors.New("u2f: data is too short")
+		}
+		certLen := int(buf[0])<<8 | int(buf[1])
+		buf = buf[2:]
+		if len(buf) < certLen {
+			return nil, errors.New("u2f: data is too short")
+		}
+		cert, err := ParseAttestationCert(buf[:certLen])
+		if err != nil {
+			return nil, err
+		}
+		r.AttestationCert = cert
+		buf = buf[certLen:]
+	}
+
+	if flags&compactHasAttestation != 0 {
+		if len(buf) < 32+1+2 || buf[32] > 1 {
+			return nil, errors.New("u2f: invalid attestation summary")
+		}
+		var a AttestationSummary
+		copy(a.CertDigest[:], buf)
+		a.Trusted = buf[32] == 1
+		issuerLen := int(buf[33])<<8 | int(buf[34])
+		buf = buf[35:]
+		if len(buf) < issuerLen {
+			return nil, errors.New("u2f: data is too short")
+		}
+		a.Issuer = string(buf[:issuerLen])
+		r.Attestation = &a
+		buf = buf[issuerLen:]
+	}
+
+	if len(buf) != 0 {
+		return nil, errors.New("u2f: trailing data")
+	}
+	r.Raw = data
+	return &r, nil
 }
 
 func verifyAttestationCert(r Registration, config *Config) error {
@@ -160,8 +420,10 @@ func verifyAttestationCert(r Registration, config *Config) error {
 	}
 
 	opts := x509.VerifyOptions{Roots: rootCertPool}
-	_, err := r.AttestationCert.Verify(opts)
-	return err
+	if _, err := r.AttestationCert.Verify(opts); err != nil {
+		return &AttestationError{err}
+	}
+	return nil
 }
 
 func verifyRegistrationSignature(
@@ -177,8 +439,23 @@ func verifyRegistrationSignature(
 	pk := elliptic.Marshal(r.PubKey.Curve, r.PubKey.X, r.PubKey.Y)
 	buf = append(buf, pk...)
 
-	return r.AttestationCert.CheckSignature(
-		x509.ECDSAWithSHA256, buf, signature)
+	return checkAttestationSignature(r.AttestationCert, buf, signature)
+}
+
+// checkAttestationSignature verifies an ECDSA signature with SHA-256 made by
+// the key of an attestation certificate. It returns ErrInvalidSignature if the
+// signature doesn't match, and another error if the certificate's key isn't
+// an ECDSA key.
+func checkAttestationSignature(cert *x509.Certificate, signed, signature []byte) error {
+	pubKey, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("u2f: unsupported attestation certificate key")
+	}
+	hash := sha256.Sum256(signed)
+	if !ecdsa.VerifyASN1(pubKey, hash[:], signature) {
+		return ErrInvalidSignature
+	}
+	return nil
 }
 
 func getRegisteredKey(appID string, r Registration) RegisteredKey {
@@ -189,9 +466,20 @@ func getRegisteredKey(appID string, r Registration) RegisteredKey {
 	}
 }
 
+// ParseAttestationCert parses a DER encoded attestation certificate, such as
+// one stored separately from the registration data. Known malformed
+// certificates are corrected as they are when parsing registration data. The
+// certificate is not verified.
+func ParseAttestationCert(der []byte) (*x509.Certificate, error) {
+	der = append([]byte(nil), der...)
+	fixCertIfNeed(der)
+	return x509.ParseCertificate(der)
+}
+
 // fixCertIfNeed fixes broken certificates described in
 // https://github.com/Yubico/php-u2flib-server/blob/master/src/u2flib_server/U2F.php#L84
-func fixCertIfNeed(cert []byte) {
+// It reports whether the certificate was fixed.
+func fixCertIfNeed(cert []byte) bool {
 	h := sha256.Sum256(cert)
 	switch hex.EncodeToString(h[:]) {
 	case
@@ -204,12 +492,15 @@ func fixCertIfNeed(cert []byte) {
 
 		// clear the offending byte.
 		cert[len(cert)-257] = 0
+		return true
 	}
+	return false
 }
 
 // NewWebRegisterRequest creates a request to enrol a new token.
 // regs is the list of the user's existing registration. The browser will
 // refuse to re-register a device if it has an existing registration.
+// Registrations with the same fingerprint are only listed once.
 func NewWebRegisterRequest(c *Challenge, regs []Registration) *WebRegisterRequest {
 	req := RegisterRequest{
 		Version:   u2fVersion,
@@ -221,7 +512,7 @@ func NewWebRegisterRequest(c *Challenge, regs []Registration) *WebRegisterReques
 		RegisterRequests: []RegisterRequest{req},
 	}
 
-	for _, r := range regs {
+	for _, r := range uniqueRegistrations(regs) {
 		rk := getRegisteredKey(c.AppID, r)
 		rr.RegisteredKeys = append(rr.RegisteredKeys, rk)
 	}
@@ -7,8 +7,18 @@ package u2f
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
 	"testing"
 )
 
@@ -98,3 +108,179 @@ func TestSerialize(t *testing.T) {
 		t.Errorf("reg.AttestationCert differs")
 	}
 }
+
+func TestParseRegistrationData(t *testing.T) {
+	regResp, _ := hex.DecodeString(testRegRespHex)
+
+	rd, err := ParseRegistrationData(regResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rd.Raw, regResp) {
+		t.Errorf("rd.Raw differs")
+	}
+	if hex.EncodeToString(rd.Signature) != testRegRespHex[len(testRegRespHex)-len(rd.Signature)*2:] {
+		t.Errorf("unexpected signature: %x", rd.Signature)
+	}
+	if rd.CertFixed {
+		t.Errorf("certificate should not need fixing")
+	}
+
+	if _, err := ParseRegistrationData(regResp[:100]); err == nil {
+		t.Errorf("expected error for truncated data")
+	}
+}
+
+func TestParseAttestationCert(t *testing.T) {
+	regResp, _ := hex.DecodeString(testRegRespHex)
+	reg, _, err := parseRegistration(regResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der := append([]byte(nil), reg.AttestationCert.Raw...)
+
+	cert, err := ParseAttestationCert(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cert.Equal(reg.AttestationCert) {
+		t.Errorf("certificate differs")
+	}
+	if !bytes.Equal(der, reg.AttestationCert.Raw) {
+		t.Errorf("input was modified")
+	}
+
+	if _, err := ParseAttestationCert(der[:100]); err == nil {
+		t.Errorf("expected error for truncated certificate")
+	}
+}
+
+func TestSerializeCompact(t *testing.T) {
+	regResp, _ := hex.DecodeString(testRegRespHex)
+	reg, _, err := parseRegistration(regResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg.Raw = nil
+
+	for _, withCert := range []bool{true, false} {
+		if !withCert {
+			reg.AttestationCert = nil
+		}
+
+		buf, err := reg.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf[0] != compactVersion {
+			t.Errorf("unexpected version byte: %#02x", buf[0])
+		}
+
+		var reg2 Registration
+		if err := reg2.UnmarshalBinary(buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(reg2.Raw, buf) {
+			t.Errorf("reg.Raw differs")
+		}
+		if !bytes.Equal(reg.KeyHandle, reg2.KeyHandle) || !reg.PubKey.Equal(&reg2.PubKey) {
+			t.Errorf("key differs")
+		}
+		if withCert && !reg.AttestationCert.Equal(reg2.AttestationCert) || !withCert && reg2.AttestationCert != nil {
+			t.Errorf("attestation certificate differs")
+		}
+
+		reg2.Raw = nil
+		buf2, _ := reg2.MarshalBinary()
+		if !bytes.Equal(buf, buf2) {
+			t.Errorf("encoding differs after round trip")
+		}
+
+		for i := 1; i < len(buf); i++ {
+			if err := reg2.UnmarshalBinary(buf[:i]); err == nil {
+				t.Errorf("expected error for data truncated to %d bytes", i)
+			}
+		}
+		if err := reg2.UnmarshalBinary(append(buf, 0)); err == nil {
+			t.Errorf("expected error for trailing data")
+		}
+	}
+
+	buf, _ := reg.MarshalBinary()
+	buf[1+65+1+len(reg.KeyHandle)] = 0x80
+	var reg2 Registration
+	if err := reg2.UnmarshalBinary(buf); err == nil {
+		t.Errorf("expected error for unknown flags")
+	}
+
+	if _, err := (&Registration{}).MarshalBinary(); err == nil {
+		t.Errorf("expected error for empty registration")
+	}
+}
+
+// registerResponse returns a registration response attested by a
+// certificate for attKey. If forged, the signature covers other data.
+func registerResponse(t *testing.T, c *Challenge, attKey crypto.Signer, forged bool) RegisterResponse {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "Test Attestation"}}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, attKey.Public(), attKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientData, _ := json.Marshal(ClientData{Typ: "navigator.id.finishEnrollment", Challenge: encodeBase64(c.Challenge), Origin: c.AppID})
+
+	kh := []byte("key handle")
+	pubKey := elliptic.Marshal(elliptic.P256(), key.X, key.Y)
+	appParam := sha256.Sum256([]byte(c.AppID))
+	challengeParam := sha256.Sum256(clientData)
+	signed := []byte{0}
+	signed = append(signed, appParam[:]...)
+	signed = append(signed, challengeParam[:]...)
+	signed = append(signed, kh...)
+	signed = append(signed, pubKey...)
+	if forged {
+		signed[0] = 1
+	}
+	hash := sha256.Sum256(signed)
+	sig, err := attKey.Sign(rand.Reader, hash[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	regData := append([]byte{0x05}, pubKey...)
+	regData = append(regData, byte(len(kh)))
+	regData = append(regData, kh...)
+	regData = append(regData, certDER...)
+	regData = append(regData, sig...)
+	return RegisterResponse{RegistrationData: encodeBase64(regData), ClientData: encodeBase64(clientData)}
+}
+
+func TestRegisterSignatureErrors(t *testing.T) {
+	config := &Config{SkipAttestationVerify: true}
+	c, _ := NewChallenge("https://example.com", []string{"https://example.com"})
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Register(registerResponse(t, c, ecKey, false), *c, config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Register(registerResponse(t, c, ecKey, true), *c, config); err != ErrInvalidSignature {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+
+	// An attestation certificate that can't make ECDSA signatures is an
+	// attestation problem, not a bad signature.
+	var attErr *AttestationError
+	if _, err := Register(registerResponse(t, c, rsaKey, false), *c, config); !errors.As(err, &attErr) {
+		t.Errorf("expected AttestationError, got %v", err)
+	}
+}
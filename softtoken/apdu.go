@@ -0,0 +1,88 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package softtoken
+
+import (
+	"github.com/tstranex/u2f/ctap1"
+)
+
+// HandleAPDU processes a raw U2F request message, as a hardware token
+// would, and returns the response message. UserNotPresent makes the token
+// behave as if it is never touched: requests that enforce user presence
+// fail with SWConditionsNotSatisfied.
+func (t *Token) HandleAPDU(req []byte) []byte {
+	data, sw := t.handleAPDU(req)
+	resp := ctap1.Response{Data: data, SW: sw}
+	return resp.Marshal()
+}
+
+func (t *Token) handleAPDU(req []byte) ([]byte, uint16) {
+	cmd, err := ctap1.ParseCommand(req)
+	if err != nil {
+		return nil, ctap1.SWWrongLength
+	}
+	if cmd.CLA != 0 {
+		return nil, ctap1.SWClaNotSupported
+	}
+
+	switch cmd.INS {
+	case ctap1.InsRegister:
+		r, err := ctap1.ParseRegisterRequest(cmd)
+		if err != nil {
+			return nil, statusWord(err)
+		}
+		if t.UserNotPresent {
+			return nil, ctap1.SWConditionsNotSatisfied
+		}
+		regData, err := t.register(r.Application, r.Challenge)
+		if err != nil {
+			return nil, ctap1.SWWrongData
+		}
+		return regData, ctap1.SWNoError
+
+	case ctap1.InsAuthenticate:
+		r, err := ctap1.ParseAuthenticateRequest(cmd)
+		if err != nil {
+			return nil, statusWord(err)
+		}
+		if !t.hasKey(r.Application, r.KeyHandle) {
+			return nil, ctap1.SWWrongData
+		}
+		switch r.Control {
+		case ctap1.ControlCheckOnly:
+			return nil, ctap1.SWConditionsNotSatisfied
+		case ctap1.ControlEnforceUserPresence:
+			if t.UserNotPresent {
+				return nil, ctap1.SWConditionsNotSatisfied
+			}
+		}
+		sigData, err := t.authenticate(r.Application, r.Challenge, r.KeyHandle)
+		if err != nil {
+			return nil, ctap1.SWWrongData
+		}
+		return sigData, ctap1.SWNoError
+
+	case ctap1.InsVersion:
+		if len(cmd.Data) != 0 {
+			return nil, ctap1.SWWrongLength
+		}
+		return []byte(ctap1.Version), ctap1.SWNoError
+	}
+
+	return nil, ctap1.SWInsNotSupported
+}
+
+func statusWord(err error) uint16 {
+	if sw, ok := err.(ctap1.StatusError); ok {
+		return uint16(sw)
+	}
+	return ctap1.SWWrongData
+}
+
+// Message implements the Device interface of the client package.
+func (t *Token) Message(req []byte) ([]byte, error) {
+	return t.HandleAPDU(req), nil
+}
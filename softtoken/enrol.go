@@ -0,0 +1,55 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package softtoken
+
+import "github.com/tstranex/u2f"
+
+// TB is the part of testing.TB used by the test helpers, such as a
+// *testing.T. It is declared here so that programs importing the package
+// don't link package testing.
+type TB interface {
+	Helper()
+	Fatal(args ...interface{})
+}
+
+// NewTest creates a token with a self-signed attestation certificate, as
+// New(nil) does. It fails the test on error.
+func NewTest(t TB) *Token {
+	t.Helper()
+	token, err := New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// Enrol creates a token with NewTest and registers it for appID with
+// Token.Enrol.
+func Enrol(t TB, appID string) (*Token, *u2f.Registration) {
+	t.Helper()
+	token := NewTest(t)
+	return token, token.Enrol(t, appID)
+}
+
+// Enrol registers the token for appID through the U2F Javascript API, from
+// the origin appID, and returns the verified registration. The attestation
+// certificate is not verified. It fails the test on error.
+func (t *Token) Enrol(tb TB, appID string) *u2f.Registration {
+	tb.Helper()
+	c, err := u2f.NewChallenge(appID, []string{appID})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	resp, err := t.Register(u2f.NewWebRegisterRequest(c, nil), appID)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	reg, err := u2f.Register(*resp, *c, &u2f.Config{SkipAttestationVerify: true})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return reg
+}
@@ -0,0 +1,150 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package softtoken
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"math/big"
+	"sync"
+)
+
+// keyStore creates credential keys and recovers them from key handles.
+type keyStore interface {
+	// newKey creates a key for the application and returns its key handle.
+	newKey(appParam [32]byte) (kh []byte, key *ecdsa.PrivateKey, err error)
+
+	// key returns the key behind a key handle, or nil if the key handle
+	// was not created by this store for the application.
+	key(appParam [32]byte, kh []byte) *ecdsa.PrivateKey
+
+	// clone returns a store that recognizes the same key handles.
+	clone() keyStore
+}
+
+type credential struct {
+	appParam [32]byte
+	key      *ecdsa.PrivateKey
+}
+
+// memoryKeys remembers every key it creates behind a random key handle.
+type memoryKeys struct {
+	mu          sync.Mutex
+	credentials map[string]credential
+}
+
+func newMemoryKeys() *memoryKeys {
+	return &memoryKeys{credentials: make(map[string]credential)}
+}
+
+func (m *memoryKeys) newKey(appParam [32]byte) ([]byte, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	kh := make([]byte, keyHandleLen)
+	if _, err := rand.Read(kh); err != nil {
+		return nil, nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.credentials[string(kh)] = credential{appParam: appParam, key: key}
+	return kh, key, nil
+}
+
+func (m *memoryKeys) key(appParam [32]byte, kh []byte) *ecdsa.PrivateKey {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cred, ok := m.credentials[string(kh)]
+	if !ok || cred.appParam != appParam {
+		return nil
+	}
+	return cred.key
+}
+
+func (m *memoryKeys) clone() keyStore {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := &memoryKeys{credentials: make(map[string]credential, len(m.credentials))}
+	for kh, cred := range m.credentials {
+		c.credentials[kh] = cred
+	}
+	return c
+}
+
+// derivedKeys stores nothing. Like most hardware tokens, it derives each
+// key from a master secret and a random nonce, and the key handle is the
+// nonce followed by a MAC binding it to the application parameter:
+//
+//	kh  = nonce || HMAC-SHA256(secret, "mac" || appParam || nonce)
+//	key = HMAC-SHA256(secret, "key" || i || appParam || nonce)
+//
+// where i is the smallest counter giving a valid P-256 private key.
+type derivedKeys struct {
+	secret []byte
+}
+
+const nonceLen = 32
+
+func (d *derivedKeys) newKey(appParam [32]byte) ([]byte, *ecdsa.PrivateKey, error) {
+	nonce := make([]byte, nonceLen)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	kh := append(nonce, d.mac(appParam, nonce)...)
+	return kh, d.derive(appParam, nonce), nil
+}
+
+func (d *derivedKeys) key(appParam [32]byte, kh []byte) *ecdsa.PrivateKey {
+	if len(kh) != nonceLen+sha256.Size {
+		return nil
+	}
+	nonce, tag := kh[:nonceLen], kh[nonceLen:]
+	if !hmac.Equal(tag, d.mac(appParam, nonce)) {
+		return nil
+	}
+	return d.derive(appParam, nonce)
+}
+
+func (d *derivedKeys) clone() keyStore {
+	return d
+}
+
+func (d *derivedKeys) mac(appParam [32]byte, nonce []byte) []byte {
+	h := hmac.New(sha256.New, d.secret)
+	h.Write([]byte("mac"))
+	h.Write(appParam[:])
+	h.Write(nonce)
+	return h.Sum(nil)
+}
+
+func (d *derivedKeys) derive(appParam [32]byte, nonce []byte) *ecdsa.PrivateKey {
+	curve := elliptic.P256()
+	n := curve.Params().N
+	for i := 0; ; i++ {
+		h := hmac.New(sha256.New, d.secret)
+		h.Write([]byte("key"))
+		h.Write([]byte{byte(i)})
+		h.Write(appParam[:])
+		h.Write(nonce)
+		k := new(big.Int).SetBytes(h.Sum(nil))
+		if k.Sign() == 0 || k.Cmp(n) >= 0 {
+			continue
+		}
+
+		key := &ecdsa.PrivateKey{D: k}
+		key.Curve = curve
+		key.X, key.Y = curve.ScalarBaseMult(k.Bytes())
+		return key
+	}
+}
+
+// minSecretLen is the minimum length of a master secret.
+const minSecretLen = 32
@@ -0,0 +1,390 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+/*
+Package softtoken implements a software U2F token for testing applications
+that use the u2f package.
+
+A Token combines the roles of the browser and the authenticator: it answers
+a WebRegisterRequest or WebSignRequest with the RegisterResponse or
+SignResponse a browser would send back from the given origin. Likewise,
+RegisterWebAuthn and SignWebAuthn answer WebAuthn options as a browser using
+the token through navigator.credentials would.
+
+	token, _ := softtoken.New(nil)
+	c, _ := u2f.NewChallenge(appID, []string{appID})
+	resp, _ := token.Register(u2f.NewWebRegisterRequest(c, nil), appID)
+	reg, err := u2f.Register(*resp, *c, config)
+
+Tests that only need a registered token can call Enrol, which does the same
+and fails the test on error:
+
+	token, reg := softtoken.Enrol(t, appID)
+
+Tokens created with New remember every key they generate. Tokens created
+with NewWithMasterSecret instead derive their keys from a secret and the key
+handle, so they can serve unlimited registrations, for example in load tests.
+
+Tokens can be made to misbehave, to exercise the error paths of the relying
+party: see UserNotPresent, Fault and Clone.
+*/
+package softtoken
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tstranex/u2f"
+)
+
+const u2fVersion = "U2F_V2"
+
+const (
+	typRegister = "navigator.id.finishEnrollment"
+	typSign     = "navigator.id.getAssertion"
+)
+
+const keyHandleLen = 64
+
+// ErrAlreadyRegistered is returned by Register when the token holds a key for
+// one of the request's registered keys.
+var ErrAlreadyRegistered = errors.New("softtoken: token is already registered")
+
+// ErrUnknownKeyHandle is returned by Sign when the token holds none of the
+// request's registered keys.
+var ErrUnknownKeyHandle = errors.New("softtoken: no matching key handle")
+
+// Fault selects a way in which a Token corrupts its responses.
+type Fault int
+
+const (
+	// NoFault produces valid responses.
+	NoFault Fault = iota
+
+	// FaultBadSignature produces well-formed responses with invalid
+	// signatures.
+	FaultBadSignature
+
+	// FaultTruncated cuts the registration or signature data short.
+	FaultTruncated
+
+	// FaultWrongChallenge produces client data for a different challenge.
+	FaultWrongChallenge
+)
+
+// Attestation is an attestation certificate and its private key.
+type Attestation struct {
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+}
+
+// NewAttestation generates a P-256 attestation key and certificate with the
+// given common name. The certificate is signed by parent, or self-signed if
+// parent is nil. Parents can be used as root certificates in
+// u2f.Config.RootAttestationCertPool.
+func NewAttestation(commonName string, parent *Attestation) (*Attestation, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(20 * 365 * 24 * time.Hour),
+		BasicConstraintsValid: true,
+	}
+
+	issuer, issuerKey := template, key
+	if parent != nil {
+		issuer, issuerKey = parent.Cert, parent.Key
+	} else {
+		template.IsCA = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Attestation{Cert: cert, Key: key}, nil
+}
+
+// Token is a software U2F token. It is safe for concurrent use.
+type Token struct {
+	// Attestation signs registrations.
+	Attestation *Attestation
+
+	// Counter is incremented before every authentication. It is shared by
+	// all keys, as on most hardware tokens.
+	Counter uint32
+
+	// UserNotPresent makes the token report that the user was not present
+	// when signing.
+	UserNotPresent bool
+
+	// Fault corrupts the token's responses.
+	Fault Fault
+
+	mu   sync.Mutex
+	keys keyStore
+}
+
+// New creates a token that signs registrations with att. If att is nil, a
+// fresh self-signed attestation certificate is generated.
+func New(att *Attestation) (*Token, error) {
+	if att == nil {
+		var err error
+		att, err = NewAttestation("Soft U2F Token", nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Token{Attestation: att, keys: newMemoryKeys()}, nil
+}
+
+// NewWithMasterSecret creates a token that derives its keys from secret,
+// which must be at least 32 bytes long, instead of remembering them. Such a
+// token can serve any number of registrations, and tokens created with the
+// same secret recognize each other's key handles. If att is nil, a fresh
+// self-signed attestation certificate is generated.
+func NewWithMasterSecret(att *Attestation, secret []byte) (*Token, error) {
+	if len(secret) < minSecretLen {
+		return nil, errors.New("softtoken: master secret is too short")
+	}
+	t, err := New(att)
+	if err != nil {
+		return nil, err
+	}
+	t.keys = &derivedKeys{secret: append([]byte(nil), secret...)}
+	return t, nil
+}
+
+// Clone returns a token holding the same keys and counter, as if the token
+// had been cloned. Using both copies makes their counters diverge.
+func (t *Token) Clone() *Token {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return &Token{
+		Attestation:    t.Attestation,
+		Counter:        t.Counter,
+		UserNotPresent: t.UserNotPresent,
+		Fault:          t.Fault,
+		keys:           t.keys.clone(),
+	}
+}
+
+// Register answers a registration request as a browser at origin would.
+func (t *Token) Register(req *u2f.WebRegisterRequest, origin string) (*u2f.RegisterResponse, error) {
+	var challenge string
+	found := false
+	for _, rr := range req.RegisterRequests {
+		if rr.Version == u2fVersion {
+			challenge = rr.Challenge
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errors.New("softtoken: no supported register request")
+	}
+
+	for _, rk := range req.RegisteredKeys {
+		kh, err := decodeBase64(rk.KeyHandle)
+		if err != nil {
+			return nil, err
+		}
+		if t.hasKey(appParam(req.AppID, rk), kh) {
+			return nil, ErrAlreadyRegistered
+		}
+	}
+
+	clientData, err := t.clientData(typRegister, challenge, origin)
+	if err != nil {
+		return nil, err
+	}
+
+	regData, err := t.register(sha256.Sum256([]byte(req.AppID)), sha256.Sum256(clientData))
+	if err != nil {
+		return nil, err
+	}
+	if t.Fault == FaultTruncated {
+		regData = regData[:len(regData)/2]
+	}
+
+	return &u2f.RegisterResponse{
+		Version:          u2fVersion,
+		RegistrationData: encodeBase64(regData),
+		ClientData:       encodeBase64(clientData),
+	}, nil
+}
+
+// Sign answers an authentication request as a browser at origin would,
+// using the first registered key that the token holds.
+func (t *Token) Sign(req *u2f.WebSignRequest, origin string) (*u2f.SignResponse, error) {
+	for _, rk := range req.RegisteredKeys {
+		kh, err := decodeBase64(rk.KeyHandle)
+		if err != nil {
+			return nil, err
+		}
+		app := appParam(req.AppID, rk)
+		if !t.hasKey(app, kh) {
+			continue
+		}
+
+		clientData, err := t.clientData(typSign, req.Challenge, origin)
+		if err != nil {
+			return nil, err
+		}
+
+		sigData, err := t.authenticate(app, sha256.Sum256(clientData), kh)
+		if err != nil {
+			return nil, err
+		}
+		if t.Fault == FaultTruncated {
+			sigData = sigData[:len(sigData)/2]
+		}
+
+		return &u2f.SignResponse{
+			KeyHandle:     rk.KeyHandle,
+			SignatureData: encodeBase64(sigData),
+			ClientData:    encodeBase64(clientData),
+		}, nil
+	}
+	return nil, ErrUnknownKeyHandle
+}
+
+// register creates a new key and returns the raw registration response
+// message.
+func (t *Token) register(appParam, challengeParam [32]byte) ([]byte, error) {
+	kh, key, err := t.keys.newKey(appParam)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKey := elliptic.Marshal(elliptic.P256(), key.X, key.Y)
+
+	var signed []byte
+	signed = append(signed, 0)
+	signed = append(signed, appParam[:]...)
+	signed = append(signed, challengeParam[:]...)
+	signed = append(signed, kh...)
+	signed = append(signed, pubKey...)
+	sig, err := t.sign(t.Attestation.Key, signed)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf []byte
+	buf = append(buf, 0x05)
+	buf = append(buf, pubKey...)
+	buf = append(buf, byte(len(kh)))
+	buf = append(buf, kh...)
+	buf = append(buf, t.Attestation.Cert.Raw...)
+	buf = append(buf, sig...)
+	return buf, nil
+}
+
+// authenticate increments the counter and returns the raw authentication
+// response message.
+func (t *Token) authenticate(appParam, challengeParam [32]byte, kh []byte) ([]byte, error) {
+	key := t.keys.key(appParam, kh)
+	if key == nil {
+		return nil, ErrUnknownKeyHandle
+	}
+
+	t.mu.Lock()
+	t.Counter++
+	counter := t.Counter
+	t.mu.Unlock()
+
+	var userPresence byte = 1
+	if t.UserNotPresent {
+		userPresence = 0
+	}
+
+	var buf []byte
+	buf = append(buf, userPresence)
+	buf = append(buf, byte(counter>>24), byte(counter>>16), byte(counter>>8), byte(counter))
+
+	var signed []byte
+	signed = append(signed, appParam[:]...)
+	signed = append(signed, buf...)
+	signed = append(signed, challengeParam[:]...)
+	sig, err := t.sign(key, signed)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(buf, sig...), nil
+}
+
+func (t *Token) hasKey(appParam [32]byte, kh []byte) bool {
+	return t.keys.key(appParam, kh) != nil
+}
+
+// sign returns the DER encoded ECDSA signature of the SHA-256 hash of data.
+func (t *Token) sign(key *ecdsa.PrivateKey, data []byte) ([]byte, error) {
+	if t.Fault == FaultBadSignature {
+		data = append([]byte{^data[0]}, data[1:]...)
+	}
+	hash := sha256.Sum256(data)
+	return ecdsa.SignASN1(rand.Reader, key, hash[:])
+}
+
+func (t *Token) clientData(typ, challenge, origin string) ([]byte, error) {
+	if t.Fault == FaultWrongChallenge {
+		c := make([]byte, 32)
+		if _, err := rand.Read(c); err != nil {
+			return nil, err
+		}
+		challenge = encodeBase64(c)
+	}
+	return json.Marshal(u2f.ClientData{
+		Typ:       typ,
+		Challenge: challenge,
+		Origin:    origin,
+		CIDPubKey: json.RawMessage(`""`),
+	})
+}
+
+// appParam returns the application parameter for a registered key, which
+// may override the request's AppID.
+func appParam(appID string, rk u2f.RegisteredKey) [32]byte {
+	if rk.AppID != "" {
+		appID = rk.AppID
+	}
+	return sha256.Sum256([]byte(appID))
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func encodeBase64(buf []byte) string {
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
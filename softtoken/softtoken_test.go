@@ -0,0 +1,321 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package softtoken
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"testing"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/ctap1"
+)
+
+const appID = "https://example.com"
+
+func sign(t *testing.T, token *Token, reg *u2f.Registration, origin string, counter uint32) (uint32, error) {
+	c, err := u2f.NewChallenge(appID, []string{appID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := token.Sign(c.SignRequest([]u2f.Registration{*reg}), origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg.Authenticate(*resp, *c, counter)
+}
+
+func TestRegisterAndSign(t *testing.T) {
+	token := NewTest(t)
+	reg := token.Enrol(t, appID)
+
+	counter, err := sign(t, token, reg, appID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counter != 1 {
+		t.Errorf("unexpected counter: %d", counter)
+	}
+
+	counter, err = sign(t, token, reg, appID, counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counter != 2 {
+		t.Errorf("unexpected counter: %d", counter)
+	}
+}
+
+func TestAttestation(t *testing.T) {
+	root, err := NewAttestation("Soft U2F Root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	att, err := NewAttestation("Soft U2F Batch", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := New(att)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := u2f.NewChallenge(appID, []string{appID})
+	resp, err := token.Register(u2f.NewWebRegisterRequest(c, nil), appID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(root.Cert)
+	reg, err := u2f.Register(*resp, *c, &u2f.Config{RootAttestationCertPool: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.AttestationCert.Subject.CommonName != "Soft U2F Batch" {
+		t.Errorf("unexpected attestation cert: %s", reg.AttestationCert.Subject)
+	}
+
+	if _, err := u2f.Register(*resp, *c, &u2f.Config{RootAttestationCertPool: x509.NewCertPool()}); err == nil {
+		t.Errorf("expected error for untrusted attestation certificate")
+	}
+}
+
+func TestAlreadyRegistered(t *testing.T) {
+	token := NewTest(t)
+	reg := token.Enrol(t, appID)
+
+	c, _ := u2f.NewChallenge(appID, []string{appID})
+	if _, err := token.Register(u2f.NewWebRegisterRequest(c, []u2f.Registration{*reg}), appID); err != ErrAlreadyRegistered {
+		t.Errorf("expected ErrAlreadyRegistered, got %v", err)
+	}
+
+	other := NewTest(t)
+	if _, err := other.Register(u2f.NewWebRegisterRequest(c, []u2f.Registration{*reg}), appID); err != nil {
+		t.Errorf("other token should register: %v", err)
+	}
+}
+
+func TestUnknownKeyHandle(t *testing.T) {
+	reg := NewTest(t).Enrol(t, appID)
+
+	c, _ := u2f.NewChallenge(appID, []string{appID})
+	if _, err := NewTest(t).Sign(c.SignRequest([]u2f.Registration{*reg}), appID); err != ErrUnknownKeyHandle {
+		t.Errorf("expected ErrUnknownKeyHandle, got %v", err)
+	}
+
+	// The key handle is bound to the AppID it was registered for.
+	token := NewTest(t)
+	reg = token.Enrol(t, appID)
+	c, _ = u2f.NewChallenge("https://other.example.com", nil)
+	if _, err := token.Sign(c.SignRequest([]u2f.Registration{*reg}), appID); err != ErrUnknownKeyHandle {
+		t.Errorf("expected ErrUnknownKeyHandle for other AppID, got %v", err)
+	}
+}
+
+func TestWrongOrigin(t *testing.T) {
+	token := NewTest(t)
+	reg := token.Enrol(t, appID)
+	if _, err := sign(t, token, reg, "https://evil.example.com", 0); err == nil {
+		t.Errorf("expected error for wrong origin")
+	}
+}
+
+func TestUserNotPresent(t *testing.T) {
+	token := NewTest(t)
+	reg := token.Enrol(t, appID)
+	token.UserNotPresent = true
+	if _, err := sign(t, token, reg, appID, 0); err == nil {
+		t.Errorf("expected error for user not present")
+	}
+}
+
+func TestClone(t *testing.T) {
+	token := NewTest(t)
+	reg := token.Enrol(t, appID)
+	clone := token.Clone()
+
+	counter, err := sign(t, token, reg, appID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter, err = sign(t, token, reg, appID, counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sign(t, clone, reg, appID, counter); err != u2f.ErrCounterTooLow {
+		t.Errorf("expected ErrCounterTooLow from clone, got %v", err)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	faults := []Fault{FaultBadSignature, FaultTruncated, FaultWrongChallenge}
+
+	for _, fault := range faults {
+		token := NewTest(t)
+		token.Fault = fault
+		c, _ := u2f.NewChallenge(appID, []string{appID})
+		resp, err := token.Register(u2f.NewWebRegisterRequest(c, nil), appID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := u2f.Register(*resp, *c, &u2f.Config{SkipAttestationVerify: true}); err == nil {
+			t.Errorf("fault %d: expected registration error", fault)
+		}
+
+		token.Fault = NoFault
+		reg := token.Enrol(t, appID)
+		token.Fault = fault
+		if _, err := sign(t, token, reg, appID, 0); err == nil {
+			t.Errorf("fault %d: expected authentication error", fault)
+		}
+	}
+}
+
+func TestMasterSecret(t *testing.T) {
+	secret := make([]byte, 32)
+	secret[0] = 1
+	token, err := NewWithMasterSecret(nil, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var regs []*u2f.Registration
+	for i := 0; i < 10; i++ {
+		regs = append(regs, token.Enrol(t, appID))
+	}
+	var counter uint32
+	for _, reg := range regs {
+		if counter, err = sign(t, token, reg, appID, counter); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A token with the same master secret can use the key handles.
+	same, err := NewWithMasterSecret(nil, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sign(t, same, regs[0], appID, 0); err != nil {
+		t.Errorf("token with the same secret should sign: %v", err)
+	}
+
+	// A token with a different master secret cannot.
+	other, err := NewWithMasterSecret(nil, make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := u2f.NewChallenge(appID, []string{appID})
+	if _, err := other.Sign(c.SignRequest([]u2f.Registration{*regs[0]}), appID); err != ErrUnknownKeyHandle {
+		t.Errorf("expected ErrUnknownKeyHandle for other secret, got %v", err)
+	}
+
+	// Key handles are bound to the AppID they were minted for.
+	c, _ = u2f.NewChallenge("https://other.example.com", nil)
+	if _, err := token.Sign(c.SignRequest([]u2f.Registration{*regs[0]}), appID); err != ErrUnknownKeyHandle {
+		t.Errorf("expected ErrUnknownKeyHandle for other AppID, got %v", err)
+	}
+
+	// Tampered key handles are rejected.
+	tampered := *regs[0]
+	tampered.KeyHandle = append([]byte(nil), tampered.KeyHandle...)
+	tampered.KeyHandle[0] ^= 1
+	c, _ = u2f.NewChallenge(appID, []string{appID})
+	if _, err := token.Sign(c.SignRequest([]u2f.Registration{tampered}), appID); err != ErrUnknownKeyHandle {
+		t.Errorf("expected ErrUnknownKeyHandle for tampered key handle, got %v", err)
+	}
+
+	if _, err := NewWithMasterSecret(nil, make([]byte, 16)); err == nil {
+		t.Errorf("expected error for short master secret")
+	}
+}
+
+func exchange(t *testing.T, token *Token, cmd *ctap1.Command) *ctap1.Response {
+	req, err := cmd.MarshalExtended()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ctap1.ParseResponse(token.HandleAPDU(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestHandleAPDU(t *testing.T) {
+	token := NewTest(t)
+
+	resp := exchange(t, token, ctap1.VersionCommand())
+	if resp.Err() != nil || string(resp.Data) != ctap1.Version {
+		t.Errorf("unexpected version response: %+v", resp)
+	}
+
+	c, _ := u2f.NewChallenge(appID, []string{appID})
+	clientData, _ := json.Marshal(u2f.ClientData{
+		Typ:       typRegister,
+		Challenge: encodeBase64(c.Challenge),
+		Origin:    appID,
+	})
+	regReq := ctap1.RegisterRequest{
+		Challenge:   sha256.Sum256(clientData),
+		Application: sha256.Sum256([]byte(appID)),
+	}
+	resp = exchange(t, token, regReq.Command())
+	if resp.Err() != nil {
+		t.Fatal(resp.Err())
+	}
+	reg, err := u2f.Register(u2f.RegisterResponse{
+		RegistrationData: encodeBase64(resp.Data),
+		ClientData:       encodeBase64(clientData),
+	}, *c, &u2f.Config{SkipAttestationVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authReq := ctap1.AuthenticateRequest{
+		Control:     ctap1.ControlCheckOnly,
+		Application: regReq.Application,
+		KeyHandle:   reg.KeyHandle,
+	}
+	cmd, _ := authReq.Command()
+	if resp := exchange(t, token, cmd); resp.SW != ctap1.SWConditionsNotSatisfied {
+		t.Errorf("check-only: unexpected status %04x", resp.SW)
+	}
+
+	authReq.Application = sha256.Sum256([]byte("https://other.example.com"))
+	cmd, _ = authReq.Command()
+	if resp := exchange(t, token, cmd); resp.SW != ctap1.SWWrongData {
+		t.Errorf("check-only other app: unexpected status %04x", resp.SW)
+	}
+
+	token.UserNotPresent = true
+	authReq.Application = regReq.Application
+	authReq.Control = ctap1.ControlEnforceUserPresence
+	cmd, _ = authReq.Command()
+	if resp := exchange(t, token, cmd); resp.SW != ctap1.SWConditionsNotSatisfied {
+		t.Errorf("enforce without presence: unexpected status %04x", resp.SW)
+	}
+
+	authReq.Control = ctap1.ControlDontEnforceUserPresence
+	cmd, _ = authReq.Command()
+	resp = exchange(t, token, cmd)
+	if resp.Err() != nil || len(resp.Data) < 5 || resp.Data[0] != 0 {
+		t.Errorf("dont-enforce: unexpected response %+v", resp)
+	}
+
+	token.UserNotPresent = false
+	authReq.Control = ctap1.ControlEnforceUserPresence
+	cmd, _ = authReq.Command()
+	resp = exchange(t, token, cmd)
+	if resp.Err() != nil || resp.Data[0] != 1 {
+		t.Errorf("enforce: unexpected response %+v", resp)
+	}
+
+	if resp := exchange(t, token, &ctap1.Command{INS: 0x40}); resp.SW != ctap1.SWInsNotSupported {
+		t.Errorf("unknown instruction: unexpected status %04x", resp.SW)
+	}
+}
@@ -0,0 +1,184 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package softtoken
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/internal/cbor"
+)
+
+const publicKeyCredentialType = "public-key"
+
+// webAuthnClientData is the client data of WebAuthn ceremonies.
+type webAuthnClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// RegisterWebAuthn answers navigator.credentials.create() options as a
+// browser at origin would with a U2F token: the response has a "fido-u2f"
+// attestation statement.
+func (t *Token) RegisterWebAuthn(opts *u2f.PublicKeyCredentialCreationOptions, origin string) (*u2f.WebAuthnRegistrationResponse, error) {
+	if opts.RP.ID == "" {
+		return nil, errors.New("softtoken: no relying party id")
+	}
+	rpIDHash := sha256.Sum256([]byte(opts.RP.ID))
+
+	var appIDExclude string
+	if opts.Extensions != nil {
+		appIDExclude = opts.Extensions.AppIDExclude
+	}
+	for _, cred := range opts.ExcludeCredentials {
+		kh, err := decodeBase64(cred.ID)
+		if err != nil {
+			return nil, err
+		}
+		if t.hasKey(rpIDHash, kh) ||
+			appIDExclude != "" && t.hasKey(sha256.Sum256([]byte(appIDExclude)), kh) {
+			return nil, ErrAlreadyRegistered
+		}
+	}
+
+	clientData, err := t.webAuthnClientData("webauthn.create", opts.Challenge, origin)
+	if err != nil {
+		return nil, err
+	}
+	regData, err := t.register(rpIDHash, sha256.Sum256(clientData))
+	if err != nil {
+		return nil, err
+	}
+
+	// Split the U2F registration response message, as browsers do.
+	pubKey := regData[1:66]
+	kh := regData[67 : 67+int(regData[66])]
+	cert := t.Attestation.Cert.Raw
+	sig := regData[67+len(kh)+len(cert):]
+
+	x, y := elliptic.Unmarshal(elliptic.P256(), pubKey)
+	coseKey, err := u2f.MarshalCOSEKey(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y})
+	if err != nil {
+		return nil, err
+	}
+
+	var authData []byte
+	authData = append(authData, rpIDHash[:]...)
+	authData = append(authData, 0x41) // User present and attested credential data.
+	authData = append(authData, 0, 0, 0, 0)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = append(authData, byte(len(kh)>>8), byte(len(kh)))
+	authData = append(authData, kh...)
+	authData = append(authData, coseKey...)
+
+	attObj, err := cbor.Marshal(map[interface{}]interface{}{
+		"fmt":      "fido-u2f",
+		"authData": authData,
+		"attStmt": map[interface{}]interface{}{
+			"sig": sig,
+			"x5c": []interface{}{cert},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if t.Fault == FaultTruncated {
+		attObj = attObj[:len(attObj)/2]
+	}
+
+	return &u2f.WebAuthnRegistrationResponse{
+		ID:    encodeBase64(kh),
+		RawID: encodeBase64(kh),
+		Type:  publicKeyCredentialType,
+		Response: u2f.AuthenticatorAttestationResponse{
+			ClientDataJSON:    encodeBase64(clientData),
+			AttestationObject: encodeBase64(attObj),
+			Transports:        []string{"usb"},
+		},
+	}, nil
+}
+
+// SignWebAuthn answers navigator.credentials.get() options as a browser at
+// origin would with a U2F token, using the first allowed credential that the
+// token holds. Credentials registered with the U2F Javascript API are found
+// through the appid extension.
+func (t *Token) SignWebAuthn(opts *u2f.PublicKeyCredentialRequestOptions, origin string) (*u2f.WebAuthnAuthenticationResponse, error) {
+	if opts.RPID == "" {
+		return nil, errors.New("softtoken: no relying party id")
+	}
+	var appID string
+	if opts.Extensions != nil {
+		appID = opts.Extensions.AppID
+	}
+
+	for _, cred := range opts.AllowCredentials {
+		kh, err := decodeBase64(cred.ID)
+		if err != nil {
+			return nil, err
+		}
+		app := sha256.Sum256([]byte(opts.RPID))
+		usedAppID := false
+		if !t.hasKey(app, kh) {
+			if appID == "" || !t.hasKey(sha256.Sum256([]byte(appID)), kh) {
+				continue
+			}
+			app = sha256.Sum256([]byte(appID))
+			usedAppID = true
+		}
+
+		clientData, err := t.webAuthnClientData("webauthn.get", opts.Challenge, origin)
+		if err != nil {
+			return nil, err
+		}
+		sigData, err := t.authenticate(app, sha256.Sum256(clientData), kh)
+		if err != nil {
+			return nil, err
+		}
+
+		// The U2F signature covers the application parameter, flags,
+		// counter and client data hash, which is also what WebAuthn
+		// assertions are signed over.
+		authData := append(app[:], sigData[:5]...)
+		if t.Fault == FaultTruncated {
+			authData = authData[:len(authData)/2]
+		}
+
+		return &u2f.WebAuthnAuthenticationResponse{
+			ID:    cred.ID,
+			RawID: cred.ID,
+			Type:  publicKeyCredentialType,
+			Response: u2f.AuthenticatorAssertionResponse{
+				ClientDataJSON:    encodeBase64(clientData),
+				AuthenticatorData: encodeBase64(authData),
+				Signature:         encodeBase64(sigData[5:]),
+			},
+			ClientExtensionResults: u2f.AuthenticationExtensionsClientOutputs{AppID: usedAppID},
+		}, nil
+	}
+	return nil, ErrUnknownKeyHandle
+}
+
+func (t *Token) webAuthnClientData(typ, challenge, origin string) ([]byte, error) {
+	if t.Fault == FaultWrongChallenge {
+		c := make([]byte, 32)
+		if _, err := rand.Read(c); err != nil {
+			return nil, err
+		}
+		challenge = encodeBase64(c)
+	}
+	return json.Marshal(webAuthnClientData{
+		Type:      typ,
+		Challenge: challenge,
+		Origin:    origin,
+	})
+}
@@ -0,0 +1,156 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package softtoken
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/tstranex/u2f"
+)
+
+var user = u2f.PublicKeyCredentialUserEntity{ID: "dXNlcg", Name: "user", DisplayName: "User"}
+
+func registerWebAuthn(t *testing.T, token *Token, regs []u2f.Registration, config *u2f.Config) (*u2f.Registration, error) {
+	c, err := u2f.NewChallenge(appID, []string{appID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := u2f.NewWebAuthnCreationOptions(c, user, regs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := token.RegisterWebAuthn(opts, appID)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &u2f.Config{SkipAttestationVerify: true}
+	}
+	return u2f.RegisterWebAuthn(*resp, *c, config)
+}
+
+func signWebAuthn(t *testing.T, token *Token, reg *u2f.Registration, origin string, counter uint32) (uint32, error) {
+	c, err := u2f.NewChallenge(appID, []string{appID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := c.WebAuthnRequestOptions([]u2f.Registration{*reg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := token.SignWebAuthn(opts, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reg.AuthenticateWebAuthn(*resp, *c, counter)
+}
+
+func TestWebAuthn(t *testing.T) {
+	root, err := NewAttestation("Soft U2F Root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	att, err := NewAttestation("Soft U2F Batch", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := New(att)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(root.Cert)
+	reg, err := registerWebAuthn(t, token, nil, &u2f.Config{RootAttestationCertPool: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.AttestationCert.Subject.CommonName != "Soft U2F Batch" {
+		t.Errorf("unexpected attestation cert: %s", reg.AttestationCert.Subject)
+	}
+	if _, err := registerWebAuthn(t, token, nil, &u2f.Config{RootAttestationCertPool: x509.NewCertPool()}); err == nil {
+		t.Errorf("expected error for untrusted attestation certificate")
+	}
+
+	// The registration survives storage.
+	data, err := reg.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored u2f.Registration
+	if err := stored.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	counter, err := signWebAuthn(t, token, &stored, appID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counter != 1 {
+		t.Errorf("unexpected counter: %d", counter)
+	}
+
+	if _, err := registerWebAuthn(t, token, []u2f.Registration{*reg}, nil); err != ErrAlreadyRegistered {
+		t.Errorf("expected ErrAlreadyRegistered, got %v", err)
+	}
+
+	if _, err := signWebAuthn(t, token, reg, "https://evil.example.com", 0); err == nil {
+		t.Errorf("expected error for wrong origin")
+	}
+	if _, err := signWebAuthn(t, token.Clone(), reg, appID, 5); err != u2f.ErrCounterTooLow {
+		t.Errorf("expected ErrCounterTooLow, got %v", err)
+	}
+	token.UserNotPresent = true
+	if _, err := signWebAuthn(t, token, reg, appID, 0); err == nil {
+		t.Errorf("expected error for user not present")
+	}
+}
+
+// TestWebAuthnAppID checks that tokens registered with the U2F Javascript
+// API can be used, and are excluded, through the appid extensions.
+func TestWebAuthnAppID(t *testing.T) {
+	token := NewTest(t)
+	reg := token.Enrol(t, appID)
+
+	if _, err := signWebAuthn(t, token, reg, appID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registerWebAuthn(t, token, []u2f.Registration{*reg}, nil); err != ErrAlreadyRegistered {
+		t.Errorf("expected ErrAlreadyRegistered, got %v", err)
+	}
+
+	// The reverse: WebAuthn registrations can't be used with the U2F
+	// Javascript API, whose application parameter is the AppID.
+	reg2, err := registerWebAuthn(t, token, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := u2f.NewChallenge(appID, []string{appID})
+	if _, err := token.Sign(c.SignRequest([]u2f.Registration{*reg2}), appID); err != ErrUnknownKeyHandle {
+		t.Errorf("expected ErrUnknownKeyHandle, got %v", err)
+	}
+}
+
+func TestWebAuthnFaults(t *testing.T) {
+	for _, fault := range []Fault{FaultBadSignature, FaultTruncated, FaultWrongChallenge} {
+		token := NewTest(t)
+		token.Fault = fault
+		if _, err := registerWebAuthn(t, token, nil, nil); err == nil {
+			t.Errorf("fault %d: expected registration error", fault)
+		}
+
+		token.Fault = NoFault
+		reg, err := registerWebAuthn(t, token, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token.Fault = fault
+		if _, err := signWebAuthn(t, token, reg, appID, 0); err == nil {
+			t.Errorf("fault %d: expected authentication error", fault)
+		}
+	}
+}
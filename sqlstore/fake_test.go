@@ -0,0 +1,274 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package sqlstore
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// fakeDriver is a database/sql driver that executes the statements of the
+// store on in-memory tables. Databases are named by the DSN.
+//
+// The fake only checks the store's behaviour: it recognizes the store's
+// statements by their text and doesn't parse SQL, so it can't catch SQL
+// errors or statements that a database version doesn't support. Changes to
+// the statements need to be tried on the databases listed in the package
+// documentation.
+type fakeDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*fakeDB
+}
+
+var driverFake = &fakeDriver{dbs: make(map[string]*fakeDB)}
+
+func init() {
+	sql.Register("sqlstorefake", driverFake)
+}
+
+type fakeRegistration struct {
+	id           int64
+	user         string
+	fingerprint  []byte
+	keyHandle    []byte
+	registration []byte
+	counter      int64
+	name         string
+	created      int64
+}
+
+type fakeChallenge struct {
+	challenge []byte
+	appID     string
+	facets    string
+	created   int64
+}
+
+type fakeDB struct {
+	mu            sync.Mutex
+	tables        map[string]bool
+	versions      []int64
+	nextID        int64
+	registrations []*fakeRegistration
+	challenges    map[string]fakeChallenge
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	db, ok := d.dbs[name]
+	if !ok {
+		db = &fakeDB{tables: make(map[string]bool), challenges: make(map[string]fakeChallenge)}
+		d.dbs[name] = db
+	}
+	return &fakeConn{db: db}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	n, _, _, err := s.db.execute(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(n), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	_, cols, rows, err := s.db.execute(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{cols: cols, rows: rows}, nil
+}
+
+type fakeRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var (
+	postgresPlaceholder = regexp.MustCompile(`\$[0-9]+`)
+	createTable         = regexp.MustCompile(`^CREATE TABLE (IF NOT EXISTS )?(\w+) `)
+)
+
+// execute runs a statement. Postgres placeholders are accepted too, so that
+// both dialects can be tested.
+func (db *fakeDB) execute(query string, args []driver.Value) (n int64, cols []string, rows [][]driver.Value, err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	query = postgresPlaceholder.ReplaceAllString(query, "?")
+	if m := createTable.FindStringSubmatch(query); m != nil {
+		if db.tables[m[2]] && m[1] == "" {
+			return 0, nil, nil, fmt.Errorf("fake: table %s already exists", m[2])
+		}
+		db.tables[m[2]] = true
+		return 0, nil, nil, nil
+	}
+	if strings.HasPrefix(query, "CREATE INDEX ") {
+		return 0, nil, nil, nil
+	}
+	regCols := []string{"registration", "counter", "name", "created"}
+	regRow := func(r *fakeRegistration) []driver.Value {
+		return []driver.Value{r.registration, r.counter, r.name, r.created}
+	}
+
+	switch query {
+	case selectVersion:
+		var max int64
+		for _, v := range db.versions {
+			if v > max {
+				max = v
+			}
+		}
+		return 0, []string{"version"}, [][]driver.Value{{max}}, nil
+
+	case insertVersion:
+		db.versions = append(db.versions, args[0].(int64))
+		return 1, nil, nil, nil
+
+	case selectRegistrations:
+		for _, r := range db.registrations {
+			if r.user == args[0].(string) {
+				rows = append(rows, regRow(r))
+			}
+		}
+		return 0, regCols, rows, nil
+
+	case selectRegistration:
+		for _, r := range db.registrations {
+			if r.user == args[0].(string) && bytes.Equal(r.keyHandle, args[1].([]byte)) {
+				rows = append(rows, regRow(r))
+			}
+		}
+		return 0, regCols, rows, nil
+
+	case insertRegistration:
+		if db.find(args[0], args[1]) != nil {
+			return 0, nil, nil, nil
+		}
+		db.nextID++
+		db.registrations = append(db.registrations, &fakeRegistration{
+			id:           db.nextID,
+			user:         args[0].(string),
+			fingerprint:  args[1].([]byte),
+			keyHandle:    args[2].([]byte),
+			registration: args[3].([]byte),
+			counter:      args[4].(int64),
+			name:         args[5].(string),
+			created:      args[6].(int64),
+		})
+		return 1, nil, nil, nil
+
+	case updateCounter:
+		if r := db.find(args[1], args[2]); r != nil && r.counter <= args[3].(int64) {
+			r.counter = args[0].(int64)
+			return 1, nil, nil, nil
+		}
+		return 0, nil, nil, nil
+
+	case countRegistration:
+		var count int64
+		if db.find(args[0], args[1]) != nil {
+			count = 1
+		}
+		return 0, []string{"count"}, [][]driver.Value{{count}}, nil
+
+	case deleteRegistration:
+		for i, r := range db.registrations {
+			if r.user == args[0].(string) && bytes.Equal(r.fingerprint, args[1].([]byte)) {
+				db.registrations = append(db.registrations[:i:i], db.registrations[i+1:]...)
+				return 1, nil, nil, nil
+			}
+		}
+		return 0, nil, nil, nil
+
+	case renameRegistration:
+		if r := db.find(args[1], args[2]); r != nil {
+			r.name = args[0].(string)
+			return 1, nil, nil, nil
+		}
+		return 0, nil, nil, nil
+
+	case upsertChallenge:
+		db.challenges[args[0].(string)] = fakeChallenge{
+			challenge: args[1].([]byte),
+			appID:     args[2].(string),
+			facets:    args[3].(string),
+			created:   args[4].(int64),
+		}
+		return 1, nil, nil, nil
+
+	case deleteChallenges:
+		for key, c := range db.challenges {
+			if c.created < args[0].(int64) {
+				delete(db.challenges, key)
+				n++
+			}
+		}
+		return n, nil, nil, nil
+
+	case takeChallenge:
+		cols = []string{"challenge", "app_id", "trusted_facets", "created"}
+		c, ok := db.challenges[args[0].(string)]
+		if !ok {
+			return 0, cols, nil, nil
+		}
+		delete(db.challenges, args[0].(string))
+		return 1, cols, [][]driver.Value{{c.challenge, c.appID, c.facets, c.created}}, nil
+	}
+	return 0, nil, nil, fmt.Errorf("fake: unsupported statement %q", query)
+}
+
+func (db *fakeDB) find(user, fingerprint driver.Value) *fakeRegistration {
+	for _, r := range db.registrations {
+		if r.user == user.(string) && bytes.Equal(r.fingerprint, fingerprint.([]byte)) {
+			return r
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package sqlstore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect selects the SQL variant of a database.
+type Dialect int
+
+const (
+	// SQLite is the dialect of SQLite 3.35 or later.
+	SQLite Dialect = iota
+
+	// Postgres is the dialect of PostgreSQL 9.5 or later.
+	Postgres
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case SQLite:
+		return "sqlite"
+	case Postgres:
+		return "postgres"
+	}
+	return "Dialect(" + strconv.Itoa(int(d)) + ")"
+}
+
+// types returns the replacements of the type placeholders in migrations.
+func (d Dialect) types() *strings.Replacer {
+	if d == Postgres {
+		return strings.NewReplacer("{serial}", "BIGSERIAL PRIMARY KEY", "{blob}", "BYTEA")
+	}
+	return strings.NewReplacer("{serial}", "INTEGER PRIMARY KEY AUTOINCREMENT", "{blob}", "BLOB")
+}
+
+// rebind replaces the ? placeholders of query with the dialect's.
+func (d Dialect) rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// migrations are the statements that create the schema, by version. New
+// versions are appended; released ones must not change.
+//
+// Times are stored as Unix nanoseconds and counters as BIGINT, which holds
+// all uint32 values.
+var migrations = [][]string{
+	1: {
+		`CREATE TABLE u2f_registrations (
+	id {serial},
+	user_id TEXT NOT NULL,
+	fingerprint {blob} NOT NULL,
+	key_handle {blob} NOT NULL,
+	registration {blob} NOT NULL,
+	counter BIGINT NOT NULL,
+	name TEXT NOT NULL,
+	created BIGINT NOT NULL,
+	UNIQUE (user_id, fingerprint)
+)`,
+		`CREATE INDEX u2f_registrations_key_handle ON u2f_registrations (user_id, key_handle)`,
+		`CREATE TABLE u2f_challenges (
+	challenge_key TEXT PRIMARY KEY,
+	challenge {blob} NOT NULL,
+	app_id TEXT NOT NULL,
+	trusted_facets TEXT NOT NULL,
+	created BIGINT NOT NULL
+)`,
+		`CREATE INDEX u2f_challenges_created ON u2f_challenges (created)`,
+	},
+}
+
+const (
+	createVersionTable = `CREATE TABLE IF NOT EXISTS u2f_schema_version (version INTEGER NOT NULL)`
+	selectVersion      = `SELECT COALESCE(MAX(version), 0) FROM u2f_schema_version`
+	insertVersion      = `INSERT INTO u2f_schema_version (version) VALUES (?)`
+)
+
+// Schema returns the SQL script that creates the tables of the latest
+// version, for applications that manage their schema with other tools.
+// Such applications don't call Migrate.
+func (d Dialect) Schema() string {
+	types := d.types()
+	var b strings.Builder
+	for _, stmts := range migrations[1:] {
+		for _, stmt := range stmts {
+			b.WriteString(types.Replace(stmt))
+			b.WriteString(";\n\n")
+		}
+	}
+	return b.String()
+}
+
+// Migrate creates or upgrades the tables of the store. The applied version
+// is recorded in the table u2f_schema_version, so Migrate can be called on
+// every start. Concurrent calls, e.g. by several servers starting at once,
+// are not safe.
+func (s *Store) Migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, createVersionTable); err != nil {
+		return fmt.Errorf("sqlstore: %v", err)
+	}
+	var version int
+	if err := s.db.QueryRowContext(ctx, selectVersion).Scan(&version); err != nil {
+		return fmt.Errorf("sqlstore: %v", err)
+	}
+	if version >= len(migrations) {
+		// Newer servers may have upgraded the schema compatibly.
+		return nil
+	}
+
+	types := s.dialect.types()
+	for v := version + 1; v < len(migrations); v++ {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("sqlstore: %v", err)
+		}
+		for _, stmt := range migrations[v] {
+			if _, err := tx.ExecContext(ctx, types.Replace(stmt)); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("sqlstore: migration %d: %v", v, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, s.dialect.rebind(insertVersion), v); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sqlstore: migration %d: %v", v, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("sqlstore: migration %d: %v", v, err)
+		}
+	}
+	return nil
+}
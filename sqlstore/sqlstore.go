@@ -0,0 +1,239 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+/*
+Package sqlstore stores registrations and challenges in an SQL database
+through database/sql. It supports PostgreSQL 9.5 or later and SQLite 3.35 or
+later; the application imports the driver of its choice. The statements use
+INSERT ... ON CONFLICT, and Take uses DELETE ... RETURNING so that a challenge
+can only be taken once; older versions don't support them.
+
+A Store implements both store.RegistrationStore and store.ChallengeStore:
+
+	db, err := sql.Open("postgres", dsn)
+	...
+	s := sqlstore.New(db, sqlstore.Postgres)
+	if err := s.Migrate(ctx); err != nil {
+		...
+	}
+	h := &u2fhttp.Handler{
+		Challenges:    s,
+		Registrations: s,
+		...
+	}
+
+Registrations are stored in the format of Registration.MarshalBinary, along
+with their fingerprint and key handle for lookups.
+*/
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/store"
+)
+
+const (
+	selectRegistrations = `SELECT registration, counter, name, created FROM u2f_registrations WHERE user_id = ? ORDER BY id`
+	selectRegistration  = `SELECT registration, counter, name, created FROM u2f_registrations WHERE user_id = ? AND key_handle = ? ORDER BY id`
+	insertRegistration  = `INSERT INTO u2f_registrations (user_id, fingerprint, key_handle, registration, counter, name, created) VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (user_id, fingerprint) DO NOTHING`
+	updateCounter       = `UPDATE u2f_registrations SET counter = ? WHERE user_id = ? AND fingerprint = ? AND counter <= ?`
+	countRegistration   = `SELECT COUNT(*) FROM u2f_registrations WHERE user_id = ? AND fingerprint = ?`
+	deleteRegistration  = `DELETE FROM u2f_registrations WHERE user_id = ? AND fingerprint = ?`
+	renameRegistration  = `UPDATE u2f_registrations SET name = ? WHERE user_id = ? AND fingerprint = ?`
+
+	upsertChallenge  = `INSERT INTO u2f_challenges (challenge_key, challenge, app_id, trusted_facets, created) VALUES (?, ?, ?, ?, ?) ON CONFLICT (challenge_key) DO UPDATE SET challenge = excluded.challenge, app_id = excluded.app_id, trusted_facets = excluded.trusted_facets, created = excluded.created`
+	deleteChallenges = `DELETE FROM u2f_challenges WHERE created < ?`
+	takeChallenge    = `DELETE FROM u2f_challenges WHERE challenge_key = ? RETURNING challenge, app_id, trusted_facets, created`
+)
+
+// Store keeps registrations and challenges in a database.
+type Store struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+var (
+	_ store.RegistrationStore = (*Store)(nil)
+	_ store.ChallengeStore    = (*Store)(nil)
+)
+
+// New returns a Store using db, which must be of the dialect. The tables are
+// created by Migrate.
+func New(db *sql.DB, dialect Dialect) *Store {
+	return &Store{db: db, dialect: dialect}
+}
+
+func (s *Store) exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	res, err := s.db.ExecContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// List implements store.RegistrationStore.
+func (s *Store) List(ctx context.Context, user string) ([]store.Record, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.rebind(selectRegistrations), user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recs []store.Record
+	for rows.Next() {
+		rec, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, *rec)
+	}
+	return recs, rows.Err()
+}
+
+// Get implements store.RegistrationStore.
+func (s *Store) Get(ctx context.Context, user string, keyHandle []byte) (*store.Record, error) {
+	rec, err := scanRecord(s.db.QueryRowContext(ctx, s.dialect.rebind(selectRegistration), user, keyHandle))
+	if err == sql.ErrNoRows {
+		return nil, store.ErrNotFound
+	}
+	return rec, err
+}
+
+// Add implements store.RegistrationStore.
+func (s *Store) Add(ctx context.Context, user string, rec store.Record) error {
+	data, err := rec.Registration.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	f := rec.Registration.Fingerprint()
+	n, err := s.exec(ctx, insertRegistration,
+		user, f[:], rec.Registration.KeyHandle, data, int64(rec.Counter), rec.Name, unixNano(rec.Created))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrExists
+	}
+	return nil
+}
+
+// UpdateCounter implements store.RegistrationStore. The counter is compared
+// and set by a single UPDATE statement.
+func (s *Store) UpdateCounter(ctx context.Context, user string, f u2f.Fingerprint, counter uint32) error {
+	n, err := s.exec(ctx, updateCounter, int64(counter), user, f[:], int64(counter))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	// Nothing was updated: find out whether the registration exists.
+	var count int
+	if err := s.db.QueryRowContext(ctx, s.dialect.rebind(countRegistration), user, f[:]).Scan(&count); err != nil {
+		return err
+	}
+	if count == 0 {
+		return store.ErrNotFound
+	}
+	return u2f.ErrCounterTooLow
+}
+
+// Delete implements store.RegistrationStore.
+func (s *Store) Delete(ctx context.Context, user string, f u2f.Fingerprint) error {
+	n, err := s.exec(ctx, deleteRegistration, user, f[:])
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+// Rename implements store.RegistrationStore.
+func (s *Store) Rename(ctx context.Context, user string, f u2f.Fingerprint, name string) error {
+	n, err := s.exec(ctx, renameRegistration, name, user, f[:])
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return store.ErrNotFound
+	}
+	return nil
+}
+
+// Put implements store.ChallengeStore. It replaces any challenge with the
+// same key and deletes expired challenges.
+func (s *Store) Put(ctx context.Context, key string, c *u2f.Challenge) error {
+	facets, err := json.Marshal(c.TrustedFacets)
+	if err != nil {
+		return err
+	}
+	if _, err := s.exec(ctx, deleteChallenges, time.Now().Add(-store.ChallengeLifetime).UnixNano()); err != nil {
+		return err
+	}
+	_, err = s.exec(ctx, upsertChallenge, key, c.Challenge, c.AppID, string(facets), c.Timestamp.UnixNano())
+	return err
+}
+
+// Take implements store.ChallengeStore. The challenge is selected and
+// deleted by a single DELETE ... RETURNING statement, so concurrent calls
+// can't both take it.
+func (s *Store) Take(ctx context.Context, key string) (*u2f.Challenge, error) {
+	var (
+		c       u2f.Challenge
+		facets  string
+		created int64
+	)
+	err := s.db.QueryRowContext(ctx, s.dialect.rebind(takeChallenge), key).Scan(&c.Challenge, &c.AppID, &facets, &created)
+	if err == sql.ErrNoRows {
+		return nil, store.ErrChallengeNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(facets), &c.TrustedFacets); err != nil {
+		return nil, err
+	}
+	c.Timestamp = time.Unix(0, created)
+	return &c, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRecord(row scanner) (*store.Record, error) {
+	var (
+		rec     store.Record
+		data    []byte
+		counter int64
+		created int64
+	)
+	if err := row.Scan(&data, &counter, &rec.Name, &created); err != nil {
+		return nil, err
+	}
+	if err := rec.Registration.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	rec.Counter = uint32(counter)
+	if created != 0 {
+		rec.Created = time.Unix(0, created)
+	}
+	return &rec, nil
+}
+
+// unixNano returns t in Unix nanoseconds, or 0 for the zero time.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
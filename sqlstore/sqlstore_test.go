@@ -0,0 +1,120 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package sqlstore
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/store"
+	"github.com/tstranex/u2f/store/storetest"
+)
+
+var dbCount int64
+
+// newStore returns a migrated store in a new fake database.
+func newStore(t *testing.T, dialect Dialect) *Store {
+	db, err := sql.Open("sqlstorefake", fmt.Sprintf("db%d", atomic.AddInt64(&dbCount, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s := New(db, dialect)
+	if err := s.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	for _, dialect := range []Dialect{SQLite, Postgres} {
+		t.Run(dialect.String(), func(t *testing.T) {
+			storetest.Run(t, func(t *testing.T) store.RegistrationStore {
+				return newStore(t, dialect)
+			})
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	s := newStore(t, SQLite)
+	// The tables are only created once: the fake fails to create existing
+	// tables.
+	if err := s.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var version int
+	if err := s.db.QueryRow(selectVersion).Scan(&version); err != nil || version != len(migrations)-1 {
+		t.Errorf("unexpected version %d, %v", version, err)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := "UPDATE t SET a = ? WHERE b = ? AND c <= ?"
+	if got := SQLite.rebind(query); got != query {
+		t.Errorf("sqlite: %q", got)
+	}
+	if got := Postgres.rebind(query); got != "UPDATE t SET a = $1 WHERE b = $2 AND c <= $3" {
+		t.Errorf("postgres: %q", got)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	for dialect, want := range map[Dialect]string{
+		SQLite:   "id INTEGER PRIMARY KEY AUTOINCREMENT",
+		Postgres: "id BIGSERIAL PRIMARY KEY",
+	} {
+		schema := dialect.Schema()
+		if !strings.Contains(schema, want) || strings.Contains(schema, "{") {
+			t.Errorf("%v: unexpected schema:\n%s", dialect, schema)
+		}
+	}
+}
+
+func TestChallenges(t *testing.T) {
+	ctx := context.Background()
+	s := newStore(t, Postgres)
+
+	c, _ := u2f.NewChallenge("https://example.com", []string{"https://example.com", "https://m.example.com"})
+	if err := s.Put(ctx, "sign:alice", c); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Take(ctx, "sign:alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Challenge, c.Challenge) || got.AppID != c.AppID || !got.Timestamp.Equal(c.Timestamp) ||
+		strings.Join(got.TrustedFacets, " ") != strings.Join(c.TrustedFacets, " ") {
+		t.Errorf("unexpected challenge: %+v", got)
+	}
+	if _, err := s.Take(ctx, "sign:alice"); err != store.ErrChallengeNotFound {
+		t.Errorf("second Take: expected ErrNotFound, got %v", err)
+	}
+
+	// A new challenge replaces the pending one.
+	c2, _ := u2f.NewChallenge("https://example.com", nil)
+	s.Put(ctx, "sign:alice", c)
+	s.Put(ctx, "sign:alice", c2)
+	if got, err := s.Take(ctx, "sign:alice"); err != nil || !bytes.Equal(got.Challenge, c2.Challenge) {
+		t.Errorf("expected the second challenge, got %+v, %v", got, err)
+	}
+
+	// Expired challenges are deleted.
+	old, _ := u2f.NewChallenge("https://example.com", nil)
+	old.Timestamp = time.Now().Add(-time.Hour)
+	s.Put(ctx, "sign:bob", old)
+	s.Put(ctx, "sign:alice", c)
+	if _, err := s.Take(ctx, "sign:bob"); err != store.ErrChallengeNotFound {
+		t.Errorf("expired challenge: expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package sshsk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	sshsigMagic   = "SSHSIG"
+	sshsigVersion = 1
+
+	armorBegin = "-----BEGIN SSH SIGNATURE-----"
+	armorEnd   = "-----END SSH SIGNATURE-----"
+)
+
+// SSHSig is a signature of a message as made by ssh-keygen -Y sign, in the
+// format defined by the OpenSSH PROTOCOL.sshsig document.
+type SSHSig struct {
+	PublicKey *PublicKey
+
+	// Namespace is the domain of the signature, e.g. "git" or "file", so
+	// that signatures can't be reused across purposes.
+	Namespace string
+
+	// HashAlgorithm is the hash of the message that was signed, "sha256"
+	// or "sha512".
+	HashAlgorithm string
+
+	Signature *Signature
+}
+
+// ParseSSHSig parses an SSHSIG signature, either armored as written by
+// ssh-keygen or as the raw blob.
+func ParseSSHSig(data []byte) (*SSHSig, error) {
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte(armorBegin)) {
+		if !bytes.HasSuffix(trimmed, []byte(armorEnd)) {
+			return nil, errors.New("sshsk: invalid armor")
+		}
+		body := trimmed[len(armorBegin) : len(trimmed)-len(armorEnd)]
+		blob, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(body), nil)))
+		if err != nil {
+			return nil, fmt.Errorf("sshsk: %v", err)
+		}
+		data = blob
+	}
+
+	if !bytes.HasPrefix(data, []byte(sshsigMagic)) || len(data) < len(sshsigMagic)+4 {
+		return nil, errors.New("sshsk: not an SSHSIG signature")
+	}
+	data = data[len(sshsigMagic):]
+	if v := binary.BigEndian.Uint32(data); v != sshsigVersion {
+		return nil, fmt.Errorf("sshsk: unsupported SSHSIG version %d", v)
+	}
+	data = data[4:]
+
+	var fields [5][]byte
+	for i := range fields {
+		var ok bool
+		if fields[i], data, ok = readString(data); !ok {
+			return nil, errors.New("sshsk: data is too short")
+		}
+	}
+	if len(data) != 0 {
+		return nil, errors.New("sshsk: trailing data")
+	}
+
+	pk, err := ParsePublicKey(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	sig, err := ParseSignature(fields[4])
+	if err != nil {
+		return nil, err
+	}
+	return &SSHSig{
+		PublicKey:     pk,
+		Namespace:     string(fields[1]),
+		HashAlgorithm: string(fields[3]),
+		Signature:     sig,
+	}, nil
+}
+
+// Marshal returns the raw SSHSIG blob.
+func (s *SSHSig) Marshal() ([]byte, error) {
+	sig, err := s.Signature.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	b := []byte(sshsigMagic)
+	b = binary.BigEndian.AppendUint32(b, sshsigVersion)
+	b = appendString(b, s.PublicKey.Marshal())
+	b = appendString(b, []byte(s.Namespace))
+	b = appendString(b, nil)
+	b = appendString(b, []byte(s.HashAlgorithm))
+	b = appendString(b, sig)
+	return b, nil
+}
+
+// Armor returns the signature armored as written by ssh-keygen.
+func (s *SSHSig) Armor() ([]byte, error) {
+	blob, err := s.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	enc := base64.StdEncoding.EncodeToString(blob)
+
+	var b bytes.Buffer
+	b.WriteString(armorBegin + "\n")
+	for len(enc) > 70 {
+		b.WriteString(enc[:70] + "\n")
+		enc = enc[70:]
+	}
+	b.WriteString(enc + "\n")
+	b.WriteString(armorEnd + "\n")
+	return b.Bytes(), nil
+}
+
+// SignedData returns the data signed by the token for the message: the
+// SSHSIG preamble, namespace and hash of the message.
+func (s *SSHSig) SignedData(message []byte) ([]byte, error) {
+	var h []byte
+	switch s.HashAlgorithm {
+	case "sha256":
+		sum := sha256.Sum256(message)
+		h = sum[:]
+	case "sha512":
+		sum := sha512.Sum512(message)
+		h = sum[:]
+	default:
+		return nil, fmt.Errorf("sshsk: unsupported hash algorithm %q", s.HashAlgorithm)
+	}
+
+	b := []byte(sshsigMagic)
+	b = appendString(b, []byte(s.Namespace))
+	b = appendString(b, nil)
+	b = appendString(b, []byte(s.HashAlgorithm))
+	b = appendString(b, h)
+	return b, nil
+}
+
+// Verify checks that the signature is a signature of message in the
+// namespace by the signature's public key. The caller must check that the
+// public key is one of the allowed signers. opts may be nil.
+func (s *SSHSig) Verify(message []byte, namespace string, opts *VerifyOptions) error {
+	if s.Namespace != namespace {
+		return fmt.Errorf("sshsk: signature is for namespace %q", s.Namespace)
+	}
+	data, err := s.SignedData(message)
+	if err != nil {
+		return err
+	}
+	return s.PublicKey.Verify(data, s.Signature, opts)
+}
@@ -0,0 +1,299 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+/*
+Package sshsk verifies signatures made with OpenSSH security key keys of type
+sk-ecdsa-sha2-nistp256@openssh.com, as defined by the OpenSSH PROTOCOL.u2f and
+PROTOCOL.sshsig documents.
+
+These keys are U2F registrations: the token signs the SHA-256 hash of the
+key's application, by default "ssh:", in place of the AppID and the SHA-256
+hash of the signed message in place of the client data. Signatures are
+therefore checked with u2f.SignatureData.Verify.
+
+To verify a signature made with ssh-keygen -Y sign, e.g. by git:
+
+	sig, err := sshsk.ParseSSHSig(armored)
+	if err != nil {
+		// Not a security key signature.
+	}
+	if !sig.PublicKey.Equal(allowedKey) {
+		// Unknown signer.
+	}
+	err = sig.Verify(message, "git", &sshsk.VerifyOptions{Counter: lastCounter})
+*/
+package sshsk
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/tstranex/u2f"
+)
+
+// KeyType is the OpenSSH name of the key type.
+const KeyType = "sk-ecdsa-sha2-nistp256@openssh.com"
+
+// DefaultApplication is the application OpenSSH uses unless told otherwise.
+const DefaultApplication = "ssh:"
+
+const curveName = "nistp256"
+
+// ErrUserNotPresent is returned by Verify for signatures made without the
+// user touching the token, unless VerifyOptions.AllowNoTouch is set.
+var ErrUserNotPresent = errors.New("sshsk: user was not present")
+
+// PublicKey is a security key public key.
+type PublicKey struct {
+	Key ecdsa.PublicKey
+
+	// Application is the application the key was created for, which takes
+	// the place of the U2F AppID.
+	Application string
+}
+
+// ParsePublicKey parses a public key in the SSH wire format.
+func ParsePublicKey(data []byte) (*PublicKey, error) {
+	typ, data, ok := readString(data)
+	if !ok || string(typ) != KeyType {
+		return nil, errors.New("sshsk: not a " + KeyType + " key")
+	}
+	curve, data, ok := readString(data)
+	if !ok || string(curve) != curveName {
+		return nil, errors.New("sshsk: invalid curve")
+	}
+	q, data, ok := readString(data)
+	if !ok {
+		return nil, errors.New("sshsk: data is too short")
+	}
+	application, data, ok := readString(data)
+	if !ok {
+		return nil, errors.New("sshsk: data is too short")
+	}
+	if len(data) != 0 {
+		return nil, errors.New("sshsk: trailing data")
+	}
+
+	x, y := elliptic.Unmarshal(elliptic.P256(), q)
+	if x == nil {
+		return nil, errors.New("sshsk: invalid public key")
+	}
+	return &PublicKey{
+		Key:         ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y},
+		Application: string(application),
+	}, nil
+}
+
+// NewPublicKey returns the SSH public key of a registration made for the
+// application, e.g. with the client package using the application as AppID.
+func NewPublicKey(reg *u2f.Registration, application string) *PublicKey {
+	return &PublicKey{Key: reg.PubKey, Application: application}
+}
+
+// Marshal returns the public key in the SSH wire format.
+func (k *PublicKey) Marshal() []byte {
+	var b []byte
+	b = appendString(b, []byte(KeyType))
+	b = appendString(b, []byte(curveName))
+	b = appendString(b, elliptic.Marshal(k.Key.Curve, k.Key.X, k.Key.Y))
+	b = appendString(b, []byte(k.Application))
+	return b
+}
+
+// Equal reports whether k and other are the same key for the same
+// application.
+func (k *PublicKey) Equal(other *PublicKey) bool {
+	return other != nil && k.Key.Equal(&other.Key) && k.Application == other.Application
+}
+
+// ParseAuthorizedKey parses a public key in the format of the OpenSSH
+// authorized_keys file, e.g. "sk-ecdsa-sha2-nistp256@openssh.com AAAA...
+// comment". The options before the key type, if any, are returned split at
+// the commas between them, e.g. no-touch-required.
+func ParseAuthorizedKey(line []byte) (key *PublicKey, comment string, options []string, err error) {
+	fields := strings.Fields(string(line))
+	for i, field := range fields {
+		if field != KeyType {
+			continue
+		}
+		if i+1 >= len(fields) {
+			break
+		}
+		data, err := base64.StdEncoding.DecodeString(fields[i+1])
+		if err != nil {
+			return nil, "", nil, fmt.Errorf("sshsk: %v", err)
+		}
+		key, err := ParsePublicKey(data)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		if i > 0 {
+			options = splitOptions(strings.Join(fields[:i], " "))
+		}
+		return key, strings.Join(fields[i+2:], " "), options, nil
+	}
+	return nil, "", nil, errors.New("sshsk: no " + KeyType + " key found")
+}
+
+// splitOptions splits authorized_keys options at the commas outside double
+// quotes.
+func splitOptions(s string) []string {
+	var options []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				options = append(options, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(options, s[start:])
+}
+
+// MarshalAuthorizedKey returns the public key in the format of the OpenSSH
+// authorized_keys file, with a trailing newline.
+func (k *PublicKey) MarshalAuthorizedKey() []byte {
+	return []byte(KeyType + " " + base64.StdEncoding.EncodeToString(k.Marshal()) + "\n")
+}
+
+// Signature is a security key signature. The embedded SignatureData holds
+// the flags, counter and DER encoded signature as produced by the token.
+type Signature struct {
+	u2f.SignatureData
+}
+
+// ParseSignature parses a signature in the SSH wire format.
+func ParseSignature(data []byte) (*Signature, error) {
+	typ, data, ok := readString(data)
+	if !ok || string(typ) != KeyType {
+		return nil, errors.New("sshsk: not a " + KeyType + " signature")
+	}
+	blob, data, ok := readString(data)
+	if !ok || len(data) != 5 {
+		return nil, errors.New("sshsk: invalid signature length")
+	}
+
+	var sig struct{ R, S *big.Int }
+	var rest []byte
+	if sig.R, rest, ok = readMPInt(blob); !ok {
+		return nil, errors.New("sshsk: invalid signature")
+	}
+	if sig.S, rest, ok = readMPInt(rest); !ok || len(rest) != 0 {
+		return nil, errors.New("sshsk: invalid signature")
+	}
+	der, err := asn1.Marshal(sig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Signature{u2f.SignatureData{
+		Flags:     data[0],
+		Counter:   binary.BigEndian.Uint32(data[1:]),
+		Signature: der,
+	}}, nil
+}
+
+// Marshal returns the signature in the SSH wire format.
+func (s *Signature) Marshal() ([]byte, error) {
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(s.Signature, &sig); err != nil {
+		return nil, err
+	}
+	var blob []byte
+	blob = appendMPInt(blob, sig.R)
+	blob = appendMPInt(blob, sig.S)
+
+	var b []byte
+	b = appendString(b, []byte(KeyType))
+	b = appendString(b, blob)
+	b = append(b, s.Flags)
+	b = binary.BigEndian.AppendUint32(b, s.Counter)
+	return b, nil
+}
+
+// VerifyOptions control the checks made by Verify besides the signature.
+type VerifyOptions struct {
+	// AllowNoTouch accepts signatures made without user presence, as the
+	// no-touch-required option does in OpenSSH.
+	AllowNoTouch bool
+
+	// Counter is the last counter seen for the key. Signatures with a
+	// lower counter fail with u2f.ErrCounterTooLow.
+	Counter uint32
+}
+
+// Verify checks that sig is a signature of message by the key. By default
+// the user must have been present. opts may be nil.
+func (k *PublicKey) Verify(message []byte, sig *Signature, opts *VerifyOptions) error {
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+
+	appParam := sha256.Sum256([]byte(k.Application))
+	challengeParam := sha256.Sum256(message)
+	if err := sig.SignatureData.Verify(&k.Key, appParam, challengeParam); err != nil {
+		return err
+	}
+
+	if !sig.UserPresent() && !opts.AllowNoTouch {
+		return ErrUserNotPresent
+	}
+	if sig.Counter < opts.Counter {
+		return u2f.ErrCounterTooLow
+	}
+	return nil
+}
+
+func readString(b []byte) (s, rest []byte, ok bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint64(n) > uint64(len(b)-4) {
+		return nil, nil, false
+	}
+	return b[4 : 4+n], b[4+n:], true
+}
+
+func appendString(b, s []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// readMPInt reads a non-negative mpint.
+func readMPInt(b []byte) (*big.Int, []byte, bool) {
+	s, rest, ok := readString(b)
+	if !ok || len(s) > 0 && s[0]&0x80 != 0 {
+		return nil, nil, false
+	}
+	// Superfluous leading zero bytes are not allowed.
+	if len(s) > 1 && s[0] == 0 && s[1]&0x80 == 0 {
+		return nil, nil, false
+	}
+	return new(big.Int).SetBytes(s), rest, true
+}
+
+func appendMPInt(b []byte, n *big.Int) []byte {
+	buf := n.Bytes()
+	if len(buf) > 0 && buf[0]&0x80 != 0 {
+		buf = append([]byte{0}, buf...)
+	}
+	return appendString(b, buf)
+}
@@ -0,0 +1,217 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package sshsk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/ctap1"
+	"github.com/tstranex/u2f/softtoken"
+)
+
+// skKey is a security key backed by a software token, used as OpenSSH
+// uses a U2F token.
+type skKey struct {
+	t     *testing.T
+	token *softtoken.Token
+	kh    []byte
+	pub   *PublicKey
+}
+
+func newKey(t *testing.T) *skKey {
+	k := &skKey{t: t, token: softtoken.NewTest(t)}
+
+	r := ctap1.RegisterRequest{Application: sha256.Sum256([]byte(DefaultApplication))}
+	resp := k.exchange(r.Command())
+	rd, err := u2f.ParseRegistrationData(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.kh = rd.KeyHandle
+	k.pub = NewPublicKey(&rd.Registration, DefaultApplication)
+	return k
+}
+
+func (k *skKey) exchange(cmd *ctap1.Command) []byte {
+	req, err := cmd.MarshalExtended()
+	if err != nil {
+		k.t.Fatal(err)
+	}
+	resp, err := ctap1.ParseResponse(k.token.HandleAPDU(req))
+	if err != nil {
+		k.t.Fatal(err)
+	}
+	if err := resp.Err(); err != nil {
+		k.t.Fatal(err)
+	}
+	return resp.Data
+}
+
+func (k *skKey) sign(data []byte) *Signature {
+	control := byte(ctap1.ControlEnforceUserPresence)
+	if k.token.UserNotPresent {
+		control = ctap1.ControlDontEnforceUserPresence
+	}
+	r := ctap1.AuthenticateRequest{
+		Control:     control,
+		Challenge:   sha256.Sum256(data),
+		Application: sha256.Sum256([]byte(DefaultApplication)),
+		KeyHandle:   k.kh,
+	}
+	cmd, err := r.Command()
+	if err != nil {
+		k.t.Fatal(err)
+	}
+	sd, err := u2f.ParseSignatureData(k.exchange(cmd))
+	if err != nil {
+		k.t.Fatal(err)
+	}
+
+	// Round trip through the wire format.
+	sig := &Signature{*sd}
+	wire, err := sig.Marshal()
+	if err != nil {
+		k.t.Fatal(err)
+	}
+	sig, err = ParseSignature(wire)
+	if err != nil {
+		k.t.Fatal(err)
+	}
+	return sig
+}
+
+func TestPublicKey(t *testing.T) {
+	k := newKey(t)
+
+	pub, err := ParsePublicKey(k.pub.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pub.Equal(k.pub) || pub.Application != DefaultApplication {
+		t.Errorf("public key differs after round trip")
+	}
+
+	line := k.pub.MarshalAuthorizedKey()
+	line = append([]byte(`no-touch-required,command="echo a,b" `), bytes.TrimSpace(line)...)
+	line = append(line, " alice@host"...)
+	pub, comment, options, err := ParseAuthorizedKey(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pub.Equal(k.pub) || comment != "alice@host" {
+		t.Errorf("unexpected key or comment %q", comment)
+	}
+	if len(options) != 2 || options[0] != "no-touch-required" || options[1] != `command="echo a,b"` {
+		t.Errorf("unexpected options: %q", options)
+	}
+
+	if _, _, _, err := ParseAuthorizedKey([]byte("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5 bob")); err == nil {
+		t.Errorf("expected error for other key type")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	k := newKey(t)
+	message := []byte("session data")
+
+	k.token.Counter = 41
+	sig := k.sign(message)
+	if err := k.pub.Verify(message, sig, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.pub.Verify(message, sig, &VerifyOptions{Counter: 42}); err != nil {
+		t.Errorf("unexpected error for current counter: %v", err)
+	}
+	if err := k.pub.Verify(message, sig, &VerifyOptions{Counter: 43}); err != u2f.ErrCounterTooLow {
+		t.Errorf("expected ErrCounterTooLow, got %v", err)
+	}
+	if err := k.pub.Verify([]byte("other data"), sig, nil); err == nil {
+		t.Errorf("expected error for other message")
+	}
+
+	other := *k.pub
+	other.Application = "ssh:other"
+	if err := other.Verify(message, sig, nil); err == nil {
+		t.Errorf("expected error for other application")
+	}
+
+	k.token.UserNotPresent = true
+	sig = k.sign(message)
+	if err := k.pub.Verify(message, sig, nil); err != ErrUserNotPresent {
+		t.Errorf("expected ErrUserNotPresent, got %v", err)
+	}
+	if err := k.pub.Verify(message, sig, &VerifyOptions{AllowNoTouch: true}); err != nil {
+		t.Errorf("unexpected error with AllowNoTouch: %v", err)
+	}
+}
+
+func TestParseSignatureErrors(t *testing.T) {
+	k := newKey(t)
+	wire, err := k.sign([]byte("data")).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < len(wire); i++ {
+		if _, err := ParseSignature(wire[:i]); err == nil {
+			t.Errorf("expected error for signature truncated to %d bytes", i)
+		}
+	}
+	if _, err := ParseSignature(append(wire, 0)); err == nil {
+		t.Errorf("expected error for trailing data")
+	}
+}
+
+func TestSSHSig(t *testing.T) {
+	k := newKey(t)
+	message := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n")
+
+	for _, hash := range []string{"sha256", "sha512"} {
+		s := &SSHSig{PublicKey: k.pub, Namespace: "git", HashAlgorithm: hash}
+		data, err := s.SignedData(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Signature = k.sign(data)
+
+		armored, err := s.Armor()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(armored, []byte(armorBegin+"\n")) {
+			t.Errorf("unexpected armor:\n%s", armored)
+		}
+		parsed, err := ParseSSHSig(armored)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !parsed.PublicKey.Equal(k.pub) || parsed.HashAlgorithm != hash {
+			t.Errorf("%s: signature differs after round trip", hash)
+		}
+
+		if err := parsed.Verify(message, "git", nil); err != nil {
+			t.Errorf("%s: %v", hash, err)
+		}
+		if err := parsed.Verify(message, "file", nil); err == nil {
+			t.Errorf("%s: expected error for other namespace", hash)
+		}
+		if err := parsed.Verify(append(message, '!'), "git", nil); err == nil {
+			t.Errorf("%s: expected error for other message", hash)
+		}
+	}
+
+	blob, _ := (&SSHSig{PublicKey: k.pub, Namespace: "git", HashAlgorithm: "md5", Signature: k.sign(nil)}).Marshal()
+	parsed, err := ParseSSHSig(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parsed.Verify(message, "git", nil); err == nil {
+		t.Errorf("expected error for unsupported hash algorithm")
+	}
+}
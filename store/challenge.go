@@ -0,0 +1,72 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/tstranex/u2f"
+)
+
+// ErrChallengeNotFound is returned by ChallengeStore.Take for missing
+// challenges.
+var ErrChallengeNotFound = errors.New("store: challenge not found")
+
+// ChallengeLifetime is how long challenges need to be kept. It matches the
+// expiry enforced by the u2f package.
+const ChallengeLifetime = 5 * time.Minute
+
+// ChallengeStore keeps challenges between the begin and finish requests of
+// a ceremony. Keys are opaque strings derived from the user ID.
+// Implementations must be safe for concurrent use.
+type ChallengeStore interface {
+	// Put stores the challenge for the key, replacing any other.
+	Put(ctx context.Context, key string, c *u2f.Challenge) error
+
+	// Take returns and deletes the challenge for the key. It returns
+	// ErrChallengeNotFound if there is none.
+	Take(ctx context.Context, key string) (*u2f.Challenge, error)
+}
+
+// MemoryChallenges is a ChallengeStore that keeps challenges in memory, for
+// servers that run as a single process.
+type MemoryChallenges struct {
+	mu         sync.Mutex
+	challenges map[string]*u2f.Challenge
+}
+
+// NewMemoryChallenges creates an empty MemoryChallenges store.
+func NewMemoryChallenges() *MemoryChallenges {
+	return &MemoryChallenges{challenges: make(map[string]*u2f.Challenge)}
+}
+
+// Put implements ChallengeStore. It also drops expired challenges.
+func (s *MemoryChallenges) Put(ctx context.Context, key string, c *u2f.Challenge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, old := range s.challenges {
+		if time.Since(old.Timestamp) > ChallengeLifetime {
+			delete(s.challenges, k)
+		}
+	}
+	s.challenges[key] = c
+	return nil
+}
+
+// Take implements ChallengeStore.
+func (s *MemoryChallenges) Take(ctx context.Context, key string) (*u2f.Challenge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.challenges[key]
+	if !ok {
+		return nil, ErrChallengeNotFound
+	}
+	delete(s.challenges, key)
+	return c, nil
+}
@@ -0,0 +1,210 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tstranex/u2f"
+)
+
+// fileVersion is the version of the file format.
+const fileVersion = 1
+
+// File is a RegistrationStore that keeps all records in a JSON file. The
+// records are cached in memory and the whole file is rewritten on every
+// change: it suits small deployments with one server process, which must be
+// the only writer of the file.
+//
+// Changes are crash-safe. The new contents are written to a temporary file
+// in the same directory, synced to disk and renamed over the old file, so
+// the file always holds either the old or the new records.
+type File struct {
+	path  string
+	mu    sync.Mutex
+	users map[string][]Record
+}
+
+type fileContents struct {
+	Version int                     `json:"version"`
+	Users   map[string][]fileRecord `json:"users"`
+}
+
+type fileRecord struct {
+	// Registration is the output of Registration.MarshalBinary.
+	Registration []byte    `json:"registration"`
+	Counter      uint32    `json:"counter"`
+	Name         string    `json:"name,omitempty"`
+	Created      time.Time `json:"created"`
+}
+
+// OpenFile opens the store in the file at path. The file is created on the
+// first change if it doesn't exist.
+func OpenFile(path string) (*File, error) {
+	s := &File{path: path, users: make(map[string][]Record)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var contents fileContents
+	if err := json.Unmarshal(data, &contents); err != nil {
+		return nil, fmt.Errorf("store: %s: %v", path, err)
+	}
+	if contents.Version != fileVersion {
+		return nil, fmt.Errorf("store: %s: unsupported version %d", path, contents.Version)
+	}
+	for user, frecs := range contents.Users {
+		recs := make([]Record, len(frecs))
+		for i, frec := range frecs {
+			if err := recs[i].Registration.UnmarshalBinary(frec.Registration); err != nil {
+				return nil, fmt.Errorf("store: %s: registration %d of user %q: %v", path, i, user, err)
+			}
+			recs[i].Counter = frec.Counter
+			recs[i].Name = frec.Name
+			recs[i].Created = frec.Created
+		}
+		s.users[user] = recs
+	}
+	return s, nil
+}
+
+// List implements RegistrationStore.
+func (s *File) List(ctx context.Context, user string) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Record(nil), s.users[user]...), nil
+}
+
+// Get implements RegistrationStore.
+func (s *File) Get(ctx context.Context, user string, keyHandle []byte) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return getRecord(s.users[user], keyHandle)
+}
+
+// Add implements RegistrationStore.
+func (s *File) Add(ctx context.Context, user string, rec Record) error {
+	return s.update(user, func(recs []Record) ([]Record, error) {
+		return addRecord(recs, rec)
+	})
+}
+
+// UpdateCounter implements RegistrationStore.
+func (s *File) UpdateCounter(ctx context.Context, user string, f u2f.Fingerprint, counter uint32) error {
+	return s.update(user, func(recs []Record) ([]Record, error) {
+		return recs, updateCounter(recs, f, counter)
+	})
+}
+
+// Delete implements RegistrationStore.
+func (s *File) Delete(ctx context.Context, user string, f u2f.Fingerprint) error {
+	return s.update(user, func(recs []Record) ([]Record, error) {
+		return deleteRecord(recs, f)
+	})
+}
+
+// Rename implements RegistrationStore.
+func (s *File) Rename(ctx context.Context, user string, f u2f.Fingerprint, name string) error {
+	return s.update(user, func(recs []Record) ([]Record, error) {
+		return recs, renameRecord(recs, f, name)
+	})
+}
+
+// update applies fn to a copy of the user's records and writes the result.
+// The cached records are only replaced once the file has been written.
+func (s *File) update(user string, fn func(recs []Record) ([]Record, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	recs, err := fn(append([]Record(nil), s.users[user]...))
+	if err != nil {
+		return err
+	}
+	users := make(map[string][]Record, len(s.users)+1)
+	for u, r := range s.users {
+		users[u] = r
+	}
+	if len(recs) == 0 {
+		delete(users, user)
+	} else {
+		users[user] = recs
+	}
+
+	if err := s.write(users); err != nil {
+		return err
+	}
+	s.users = users
+	return nil
+}
+
+func (s *File) write(users map[string][]Record) error {
+	contents := fileContents{Version: fileVersion, Users: make(map[string][]fileRecord, len(users))}
+	for user, recs := range users {
+		frecs := make([]fileRecord, len(recs))
+		for i, rec := range recs {
+			data, err := rec.Registration.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			frecs[i] = fileRecord{Registration: data, Counter: rec.Counter, Name: rec.Name, Created: rec.Created}
+		}
+		contents.Users[user] = frecs
+	}
+	data, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, append(data, '\n'))
+}
+
+// writeFileAtomic replaces the file at path with data, such that a crash
+// leaves either the old or the new contents.
+func writeFileAtomic(path string, data []byte) (err error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, "."+base+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+
+	// Sync the directory so that the rename itself is durable. Not all
+	// platforms support syncing directories, so errors are ignored.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/tstranex/u2f"
+)
+
+// Memory is a RegistrationStore that keeps records in memory, for tests and
+// demos.
+type Memory struct {
+	mu    sync.Mutex
+	users map[string][]Record
+}
+
+// NewMemory creates an empty Memory store.
+func NewMemory() *Memory {
+	return &Memory{users: make(map[string][]Record)}
+}
+
+// List implements RegistrationStore.
+func (s *Memory) List(ctx context.Context, user string) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Record(nil), s.users[user]...), nil
+}
+
+// Get implements RegistrationStore.
+func (s *Memory) Get(ctx context.Context, user string, keyHandle []byte) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return getRecord(s.users[user], keyHandle)
+}
+
+// Add implements RegistrationStore.
+func (s *Memory) Add(ctx context.Context, user string, rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	recs, err := addRecord(s.users[user], rec)
+	if err != nil {
+		return err
+	}
+	s.users[user] = recs
+	return nil
+}
+
+// UpdateCounter implements RegistrationStore.
+func (s *Memory) UpdateCounter(ctx context.Context, user string, f u2f.Fingerprint, counter uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return updateCounter(s.users[user], f, counter)
+}
+
+// Delete implements RegistrationStore.
+func (s *Memory) Delete(ctx context.Context, user string, f u2f.Fingerprint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	recs, err := deleteRecord(s.users[user], f)
+	if err != nil {
+		return err
+	}
+	if len(recs) == 0 {
+		delete(s.users, user)
+	} else {
+		s.users[user] = recs
+	}
+	return nil
+}
+
+// Rename implements RegistrationStore.
+func (s *Memory) Rename(ctx context.Context, user string, f u2f.Fingerprint, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return renameRecord(s.users[user], f, name)
+}
+
+// The helpers below implement the operations on a user's records, which they
+// may modify in place.
+
+func getRecord(recs []Record, keyHandle []byte) (*Record, error) {
+	for i := range recs {
+		if bytes.Equal(recs[i].Registration.KeyHandle, keyHandle) {
+			rec := recs[i]
+			return &rec, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func findRecord(recs []Record, f u2f.Fingerprint) int {
+	for i := range recs {
+		if recs[i].Registration.Fingerprint() == f {
+			return i
+		}
+	}
+	return -1
+}
+
+func addRecord(recs []Record, rec Record) ([]Record, error) {
+	if findRecord(recs, rec.Registration.Fingerprint()) >= 0 {
+		return nil, ErrExists
+	}
+	return append(recs[:len(recs):len(recs)], rec), nil
+}
+
+func updateCounter(recs []Record, f u2f.Fingerprint, counter uint32) error {
+	i := findRecord(recs, f)
+	if i < 0 {
+		return ErrNotFound
+	}
+	if counter < recs[i].Counter {
+		return u2f.ErrCounterTooLow
+	}
+	recs[i].Counter = counter
+	return nil
+}
+
+func deleteRecord(recs []Record, f u2f.Fingerprint) ([]Record, error) {
+	i := findRecord(recs, f)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	out := make([]Record, 0, len(recs)-1)
+	out = append(out, recs[:i]...)
+	return append(out, recs[i+1:]...), nil
+}
+
+func renameRecord(recs []Record, f u2f.Fingerprint, name string) error {
+	i := findRecord(recs, f)
+	if i < 0 {
+		return ErrNotFound
+	}
+	recs[i].Name = name
+	return nil
+}
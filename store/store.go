@@ -0,0 +1,79 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+/*
+Package store defines the storage of users' U2F registrations and of pending
+challenges, and provides in-memory and JSON file implementations.
+
+Registrations are identified by their fingerprint within a user's records.
+Implementations for other backends can be checked with the conformance tests
+in package storetest.
+*/
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tstranex/u2f"
+)
+
+// ErrNotFound is returned for unknown registrations.
+var ErrNotFound = errors.New("store: registration not found")
+
+// ErrExists is returned by Add when the user already has a registration
+// with the same fingerprint.
+var ErrExists = errors.New("store: registration already exists")
+
+// Record is a stored registration.
+type Record struct {
+	Registration u2f.Registration
+
+	// Counter is the last counter returned by Authenticate.
+	Counter uint32
+
+	// Name is a label chosen by the user, e.g. "Blue key".
+	Name string
+
+	Created time.Time
+}
+
+// RegistrationStore stores users' registrations. Implementations must be
+// safe for concurrent use.
+type RegistrationStore interface {
+	// List returns the user's records in the order they were added. It
+	// returns no records, and no error, for unknown users.
+	List(ctx context.Context, user string) ([]Record, error)
+
+	// Get returns the user's record with the key handle.
+	Get(ctx context.Context, user string, keyHandle []byte) (*Record, error)
+
+	// Add stores a new record for the user. It returns ErrExists if the
+	// user has a record with the same fingerprint.
+	Add(ctx context.Context, user string, rec Record) error
+
+	// UpdateCounter stores the counter of the user's record with the
+	// fingerprint. The check and update are atomic: if the stored counter
+	// is higher, e.g. because a concurrent authentication stored it first,
+	// it returns u2f.ErrCounterTooLow.
+	UpdateCounter(ctx context.Context, user string, f u2f.Fingerprint, counter uint32) error
+
+	// Delete removes the user's record with the fingerprint.
+	Delete(ctx context.Context, user string, f u2f.Fingerprint) error
+
+	// Rename sets the name of the user's record with the fingerprint.
+	Rename(ctx context.Context, user string, f u2f.Fingerprint, name string) error
+}
+
+// Registrations returns the registrations of the records, e.g. to pass to
+// u2f.NewWebRegisterRequest.
+func Registrations(recs []Record) []u2f.Registration {
+	regs := make([]u2f.Registration, len(recs))
+	for i, rec := range recs {
+		regs[i] = rec.Registration
+	}
+	return regs
+}
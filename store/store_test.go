@@ -0,0 +1,164 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package store_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/store"
+	"github.com/tstranex/u2f/store/storetest"
+)
+
+func TestMemory(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.RegistrationStore {
+		return store.NewMemory()
+	})
+}
+
+func TestFile(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.RegistrationStore {
+		s, err := store.OpenFile(filepath.Join(t.TempDir(), "registrations.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func newRecord(t *testing.T) store.Record {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store.Record{
+		Registration: u2f.Registration{KeyHandle: []byte("key handle"), PubKey: key.PublicKey},
+		Created:      time.Now(),
+	}
+}
+
+func TestFileReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "registrations.json")
+	s, err := store.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := newRecord(t)
+	if err := s.Add(ctx, "alice", rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateCounter(ctx, "alice", rec.Registration.Fingerprint(), 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rename(ctx, "alice", rec.Registration.Fingerprint(), "Blue key"); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = store.OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get(ctx, "alice", rec.Registration.KeyHandle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Registration.Fingerprint() != rec.Registration.Fingerprint() || got.Counter != 3 ||
+		got.Name != "Blue key" || !got.Created.Equal(rec.Created) {
+		t.Errorf("unexpected record after reopening: %+v", got)
+	}
+
+	// Only the store file is left in the directory.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("unexpected files in directory: %v", entries)
+	}
+}
+
+func TestFileWriteError(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "dir")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.OpenFile(filepath.Join(dir, "registrations.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := newRecord(t)
+	if err := s.Add(ctx, "alice", rec); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed write leaves the records unchanged.
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateCounter(ctx, "alice", rec.Registration.Fingerprint(), 3); err == nil {
+		t.Fatal("expected write error")
+	}
+	if err := s.Add(ctx, "bob", newRecord(t)); err == nil {
+		t.Fatal("expected write error")
+	}
+	got, err := s.Get(ctx, "alice", rec.Registration.KeyHandle)
+	if err != nil || got.Counter != 0 {
+		t.Errorf("record changed by failed write: %+v, %v", got, err)
+	}
+	if recs, _ := s.List(ctx, "bob"); len(recs) != 0 {
+		t.Errorf("record added by failed write")
+	}
+}
+
+func TestOpenFileInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, contents := range map[string]string{
+		"garbage":      "{",
+		"version":      `{"version": 2, "users": {}}`,
+		"registration": `{"version": 1, "users": {"alice": [{"registration": "AQI="}]}}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.OpenFile(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestMemoryChallenges(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryChallenges()
+
+	c, _ := u2f.NewChallenge("https://example.com", nil)
+	old, _ := u2f.NewChallenge("https://example.com", nil)
+	old.Timestamp = time.Now().Add(-time.Hour)
+	s.Put(ctx, "sign:bob", old)
+	if err := s.Put(ctx, "sign:alice", c); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Take(ctx, "sign:alice"); err != nil || got != c {
+		t.Errorf("unexpected challenge %+v, %v", got, err)
+	}
+	if _, err := s.Take(ctx, "sign:alice"); err != store.ErrChallengeNotFound {
+		t.Errorf("second Take: expected ErrChallengeNotFound, got %v", err)
+	}
+	// Expired challenges are dropped.
+	if _, err := s.Take(ctx, "sign:bob"); err != store.ErrChallengeNotFound {
+		t.Errorf("expired challenge: expected ErrChallengeNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,284 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+/*
+Package storetest provides conformance tests for implementations of
+store.RegistrationStore.
+
+A backend runs them from its own tests with a function that returns a new,
+empty store:
+
+	func TestConformance(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) store.RegistrationStore {
+			return newTestDB(t)
+		})
+	}
+*/
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/store"
+)
+
+// Run runs the conformance tests as subtests of t. newStore is called for
+// each subtest and must return an empty store.
+func Run(t *testing.T, newStore func(t *testing.T) store.RegistrationStore) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.RegistrationStore)
+	}{
+		{"List", testList},
+		{"Get", testGet},
+		{"AddExisting", testAddExisting},
+		{"UpdateCounter", testUpdateCounter},
+		{"ConcurrentUpdateCounter", testConcurrentUpdateCounter},
+		{"Delete", testDelete},
+		{"Rename", testRename},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, newStore(t))
+		})
+	}
+}
+
+// newRecord returns a record with a new, random registration.
+func newRecord(t *testing.T, name string) store.Record {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kh := make([]byte, 64)
+	if _, err := rand.Read(kh); err != nil {
+		t.Fatal(err)
+	}
+	// Backends may store times with a lower precision, e.g. seconds.
+	created := time.Now().UTC().Truncate(time.Second)
+	return store.Record{
+		Registration: u2f.Registration{KeyHandle: kh, PubKey: key.PublicKey},
+		Name:         name,
+		Created:      created,
+	}
+}
+
+func add(t *testing.T, s store.RegistrationStore, user string, recs ...store.Record) {
+	for _, rec := range recs {
+		if err := s.Add(context.Background(), user, rec); err != nil {
+			t.Fatalf("Add(%q, %q): %v", user, rec.Name, err)
+		}
+	}
+}
+
+func list(t *testing.T, s store.RegistrationStore, user string) []store.Record {
+	recs, err := s.List(context.Background(), user)
+	if err != nil {
+		t.Fatalf("List(%q): %v", user, err)
+	}
+	return recs
+}
+
+// checkRecord reports whether got is the record want.
+func checkRecord(t *testing.T, got, want store.Record) {
+	t.Helper()
+	if got.Registration.Fingerprint() != want.Registration.Fingerprint() {
+		t.Errorf("got registration %v, want %v", got.Registration.Fingerprint(), want.Registration.Fingerprint())
+	}
+	if !bytes.Equal(got.Registration.KeyHandle, want.Registration.KeyHandle) {
+		t.Errorf("%q: key handle differs", want.Name)
+	}
+	if got.Counter != want.Counter {
+		t.Errorf("%q: got counter %d, want %d", want.Name, got.Counter, want.Counter)
+	}
+	if got.Name != want.Name {
+		t.Errorf("got name %q, want %q", got.Name, want.Name)
+	}
+	if !got.Created.Equal(want.Created) {
+		t.Errorf("%q: got creation time %v, want %v", want.Name, got.Created, want.Created)
+	}
+}
+
+func checkRecords(t *testing.T, got, want []store.Record) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d records, want %d", len(got), len(want))
+	}
+	for i := range want {
+		checkRecord(t, got[i], want[i])
+	}
+}
+
+func testList(t *testing.T, s store.RegistrationStore) {
+	if recs := list(t, s, "alice"); len(recs) != 0 {
+		t.Errorf("unknown user has %d records", len(recs))
+	}
+
+	a1, a2, b1 := newRecord(t, "a1"), newRecord(t, "a2"), newRecord(t, "b1")
+	add(t, s, "alice", a1, a2)
+	add(t, s, "bob", b1)
+	checkRecords(t, list(t, s, "alice"), []store.Record{a1, a2})
+	checkRecords(t, list(t, s, "bob"), []store.Record{b1})
+
+	// The returned records are copies.
+	recs := list(t, s, "alice")
+	recs[0].Name = "changed"
+	checkRecords(t, list(t, s, "alice"), []store.Record{a1, a2})
+}
+
+func testGet(t *testing.T, s store.RegistrationStore) {
+	ctx := context.Background()
+	a1, a2, b1 := newRecord(t, "a1"), newRecord(t, "a2"), newRecord(t, "b1")
+	add(t, s, "alice", a1, a2)
+	add(t, s, "bob", b1)
+
+	for _, want := range []store.Record{a1, a2} {
+		rec, err := s.Get(ctx, "alice", want.Registration.KeyHandle)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", want.Name, err)
+		}
+		checkRecord(t, *rec, want)
+	}
+
+	// The key handle must belong to the user.
+	if _, err := s.Get(ctx, "alice", b1.Registration.KeyHandle); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get of other user's key handle: expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.Get(ctx, "carol", a1.Registration.KeyHandle); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get for unknown user: expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.Get(ctx, "alice", []byte("unknown")); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get of unknown key handle: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testAddExisting(t *testing.T, s store.RegistrationStore) {
+	a1 := newRecord(t, "a1")
+	add(t, s, "alice", a1)
+
+	dup := a1
+	dup.Name = "dup"
+	dup.Counter = 5
+	if err := s.Add(context.Background(), "alice", dup); !errors.Is(err, store.ErrExists) {
+		t.Errorf("expected ErrExists, got %v", err)
+	}
+	checkRecords(t, list(t, s, "alice"), []store.Record{a1})
+}
+
+func testUpdateCounter(t *testing.T, s store.RegistrationStore) {
+	ctx := context.Background()
+	a1, a2 := newRecord(t, "a1"), newRecord(t, "a2")
+	add(t, s, "alice", a1, a2)
+	f := a1.Registration.Fingerprint()
+
+	for _, counter := range []uint32{5, 5, 7} {
+		if err := s.UpdateCounter(ctx, "alice", f, counter); err != nil {
+			t.Fatalf("UpdateCounter(%d): %v", counter, err)
+		}
+	}
+	if err := s.UpdateCounter(ctx, "alice", f, 6); !errors.Is(err, u2f.ErrCounterTooLow) {
+		t.Errorf("lower counter: expected ErrCounterTooLow, got %v", err)
+	}
+	a1.Counter = 7
+	checkRecords(t, list(t, s, "alice"), []store.Record{a1, a2})
+
+	if err := s.UpdateCounter(ctx, "bob", f, 8); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("other user: expected ErrNotFound, got %v", err)
+	}
+	if err := s.UpdateCounter(ctx, "alice", u2f.Fingerprint{}, 8); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("unknown fingerprint: expected ErrNotFound, got %v", err)
+	}
+}
+
+// testConcurrentUpdateCounter checks that the counter check and update are
+// atomic: the highest counter must win, whatever the order of the updates.
+func testConcurrentUpdateCounter(t *testing.T, s store.RegistrationStore) {
+	a1 := newRecord(t, "a1")
+	add(t, s, "alice", a1)
+	f := a1.Registration.Fingerprint()
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 1; i <= n; i++ {
+		wg.Add(1)
+		go func(counter uint32) {
+			defer wg.Done()
+			err := s.UpdateCounter(context.Background(), "alice", f, counter)
+			if err != nil && !errors.Is(err, u2f.ErrCounterTooLow) {
+				errs <- fmt.Errorf("UpdateCounter(%d): %v", counter, err)
+			}
+		}(uint32(i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	a1.Counter = n
+	checkRecords(t, list(t, s, "alice"), []store.Record{a1})
+}
+
+func testDelete(t *testing.T, s store.RegistrationStore) {
+	ctx := context.Background()
+	a1, a2, a3 := newRecord(t, "a1"), newRecord(t, "a2"), newRecord(t, "a3")
+	add(t, s, "alice", a1, a2, a3)
+
+	if err := s.Delete(ctx, "bob", a2.Registration.Fingerprint()); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("other user: expected ErrNotFound, got %v", err)
+	}
+	if err := s.Delete(ctx, "alice", a2.Registration.Fingerprint()); err != nil {
+		t.Fatal(err)
+	}
+	checkRecords(t, list(t, s, "alice"), []store.Record{a1, a3})
+	if err := s.Delete(ctx, "alice", a2.Registration.Fingerprint()); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("second delete: expected ErrNotFound, got %v", err)
+	}
+	if _, err := s.Get(ctx, "alice", a2.Registration.KeyHandle); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get of deleted record: expected ErrNotFound, got %v", err)
+	}
+
+	// A deleted registration can be added again.
+	add(t, s, "alice", a2)
+	checkRecords(t, list(t, s, "alice"), []store.Record{a1, a3, a2})
+
+	for _, rec := range []store.Record{a1, a2, a3} {
+		if err := s.Delete(ctx, "alice", rec.Registration.Fingerprint()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkRecords(t, list(t, s, "alice"), nil)
+}
+
+func testRename(t *testing.T, s store.RegistrationStore) {
+	ctx := context.Background()
+	a1, a2 := newRecord(t, "a1"), newRecord(t, "a2")
+	add(t, s, "alice", a1, a2)
+
+	if err := s.Rename(ctx, "alice", a2.Registration.Fingerprint(), "Blue key"); err != nil {
+		t.Fatal(err)
+	}
+	a2.Name = "Blue key"
+	checkRecords(t, list(t, s, "alice"), []store.Record{a1, a2})
+
+	if err := s.Rename(ctx, "bob", a2.Registration.Fingerprint(), "x"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("other user: expected ErrNotFound, got %v", err)
+	}
+	if err := s.Rename(ctx, "alice", u2f.Fingerprint{}, "x"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("unknown fingerprint: expected ErrNotFound, got %v", err)
+	}
+}
@@ -6,6 +6,8 @@
 package u2f
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"testing"
 	"time"
@@ -61,4 +63,36 @@ func TestFull(t *testing.T) {
 	if err == nil {
 		t.Errorf("Expected error due to decreasing counter")
 	}
+
+	// Registrations without the attestation certificate work too.
+	stripped, err := Register(regResp, registerChallenge, &Config{StripAttestationCert: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stripped.AttestationCert != nil || stripped.Attestation == nil {
+		t.Fatalf("attestation certificate was not stripped")
+	}
+	if stripped.Attestation.CertDigest != sha256.Sum256(reg.AttestationCert.Raw) ||
+		!stripped.Attestation.Trusted ||
+		stripped.Attestation.Issuer != "CN=Yubico U2F Root CA Serial 457200631" {
+		t.Errorf("Wrong attestation summary: %+v", stripped.Attestation)
+	}
+	if bytes.Contains(stripped.Raw, reg.AttestationCert.Raw) {
+		t.Errorf("Raw contains the attestation certificate")
+	}
+
+	buf, err := stripped.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored Registration
+	if err := restored.UnmarshalBinary(buf); err != nil {
+		t.Fatal(err)
+	}
+	if *restored.Attestation != *stripped.Attestation {
+		t.Errorf("Attestation summary differs after round trip")
+	}
+	if _, err := restored.Authenticate(signResp, authChallenge, 0); err != nil {
+		t.Error(err)
+	}
 }
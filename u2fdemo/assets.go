@@ -0,0 +1,33 @@
+// FIDO U2F Go Library
+// Copyright 2015 The FIDO U2F Go Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"embed"
+	"net/http"
+)
+
+// static holds the demo page and its assets, so that the demo works without
+// outside resources.
+//
+//go:embed static
+var static embed.FS
+
+var staticHandler = http.FileServer(http.FS(static))
+
+func indexHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	page, err := static.ReadFile("static/index.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
@@ -0,0 +1,189 @@
+// FIDO U2F Go Library
+// Copyright 2015 The FIDO U2F Go Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tstranex/u2f"
+)
+
+// Attestation policies.
+const (
+	// attestationSkip accepts any token. Browsers only return attestation
+	// certificates when asked to, so this is the default.
+	attestationSkip = "skip"
+
+	// attestationVerify only accepts tokens whose attestation certificate
+	// chains to a trusted root.
+	attestationVerify = "verify"
+)
+
+// config is the demo's configuration. It is read from an optional JSON
+// file, whose values command-line flags override.
+type config struct {
+	AppID         string   `json:"appId"`
+	TrustedFacets []string `json:"trustedFacets"`
+	Addr          string   `json:"addr"`
+
+	// CertFile and KeyFile hold the server's TLS certificate and key.
+	// Without them, a self-signed certificate for localhost is generated
+	// at startup.
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+
+	// Attestation is the attestation policy, "skip" or "verify".
+	// AttestationRoots is a PEM file of the trusted root certificates,
+	// replacing those bundled with the library. StripAttestation drops
+	// attestation certificates from stored registrations.
+	Attestation      string `json:"attestation"`
+	AttestationRoots string `json:"attestationRoots"`
+	StripAttestation bool   `json:"stripAttestation"`
+
+	// Registrations is the file where the registered tokens are kept.
+	Registrations string `json:"registrations"`
+}
+
+func defaultConfig() *config {
+	return &config{
+		AppID:         "https://localhost:3483",
+		Addr:          ":3483",
+		Attestation:   attestationSkip,
+		Registrations: "u2fdemo-registrations.json",
+	}
+}
+
+// stringList is a flag.Value for comma-separated lists.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = nil
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+func (c *config) flagSet(output io.Writer) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("u2fdemo", flag.ContinueOnError)
+	fs.SetOutput(output)
+	configFile := fs.String("config", "", "JSON `file` to read the configuration from; flags override its values")
+	fs.StringVar(&c.AppID, "appid", c.AppID, "the AppID, which is also the origin of the demo page")
+	fs.Var((*stringList)(&c.TrustedFacets), "facets", "comma-separated trusted facets (default: the AppID)")
+	fs.StringVar(&c.Addr, "addr", c.Addr, "the `address` to listen on")
+	fs.StringVar(&c.CertFile, "cert", c.CertFile, "TLS certificate `file` (default: a generated self-signed certificate)")
+	fs.StringVar(&c.KeyFile, "key", c.KeyFile, "TLS key `file`")
+	fs.StringVar(&c.Attestation, "attestation", c.Attestation, `attestation policy, "skip" or "verify"`)
+	fs.StringVar(&c.AttestationRoots, "attestation-roots", c.AttestationRoots, "PEM `file` of trusted attestation roots (default: the library's roots)")
+	fs.BoolVar(&c.StripAttestation, "strip-attestation", c.StripAttestation, "drop attestation certificates from stored registrations")
+	fs.StringVar(&c.Registrations, "registrations", c.Registrations, "the `file` where registered tokens are kept")
+	return fs, configFile
+}
+
+// parseConfig reads the configuration from the command-line arguments and
+// the configuration file they name.
+func parseConfig(args []string, output io.Writer) (*config, error) {
+	// The flags are parsed twice: first to find the configuration file,
+	// then over the file's values.
+	fs, configFile := defaultConfig().flagSet(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		// Report the error with the usage message.
+		fs, _ = defaultConfig().flagSet(output)
+		return nil, fs.Parse(args)
+	}
+
+	c := defaultConfig()
+	if *configFile != "" {
+		f, err := os.Open(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		dec := json.NewDecoder(f)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(c); err != nil {
+			return nil, fmt.Errorf("%s: %v", *configFile, err)
+		}
+	}
+	fs, _ = c.flagSet(output)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %q", fs.Args())
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *config) validate() error {
+	if c.AppID == "" {
+		return errors.New("no AppID")
+	}
+	if len(c.TrustedFacets) == 0 {
+		c.TrustedFacets = []string{c.AppID}
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("the TLS certificate and key must be given together")
+	}
+	switch c.Attestation {
+	case attestationSkip, attestationVerify:
+	default:
+		return fmt.Errorf("unknown attestation policy %q", c.Attestation)
+	}
+	if c.AttestationRoots != "" && c.Attestation != attestationVerify {
+		return errors.New("attestation roots are only used with the verify policy")
+	}
+	if c.Registrations == "" {
+		return errors.New("no registrations file")
+	}
+	return nil
+}
+
+// u2fConfig returns the library configuration for the attestation policy.
+func (c *config) u2fConfig() (*u2f.Config, error) {
+	uc := &u2f.Config{
+		SkipAttestationVerify: c.Attestation == attestationSkip,
+		StripAttestationCert:  c.StripAttestation,
+	}
+	if c.AttestationRoots != "" {
+		data, err := os.ReadFile(c.AttestationRoots)
+		if err != nil {
+			return nil, err
+		}
+		uc.RootAttestationCertPool = x509.NewCertPool()
+		if !uc.RootAttestationCertPool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s: no certificates found", c.AttestationRoots)
+		}
+	}
+	return uc, nil
+}
+
+// certificate returns the server's TLS certificate, loading it from the
+// configured files or generating a self-signed one.
+func (c *config) certificate() (tls.Certificate, error) {
+	if c.CertFile != "" {
+		return tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	}
+	return selfSignedCertificate([]string{"localhost", "127.0.0.1", "::1"})
+}
@@ -0,0 +1,116 @@
+// FIDO U2F Go Library
+// Copyright 2015 The FIDO U2F Go Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseConfig(t *testing.T) {
+	c, err := parseConfig(nil, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := defaultConfig()
+	want.TrustedFacets = []string{want.AppID}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("defaults: got %+v, want %+v", c, want)
+	}
+
+	// Flags override the configuration file.
+	file := writeFile(t, "config.json", `{
+		"appId": "https://u2f.example.com",
+		"addr": ":443",
+		"attestation": "verify",
+		"registrations": "/var/lib/u2fdemo.json"
+	}`)
+	c, err = parseConfig([]string{"-config", file, "-addr", ":8443", "-facets", "https://u2f.example.com, https://www.example.com"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = &config{
+		AppID:         "https://u2f.example.com",
+		TrustedFacets: []string{"https://u2f.example.com", "https://www.example.com"},
+		Addr:          ":8443",
+		Attestation:   attestationVerify,
+		Registrations: "/var/lib/u2fdemo.json",
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+
+	for name, args := range map[string][]string{
+		"unknown flag":       {"-port", "80"},
+		"arguments":          {"extra"},
+		"empty AppID":        {"-appid", ""},
+		"cert without key":   {"-cert", "cert.pem"},
+		"unknown policy":     {"-attestation", "maybe"},
+		"roots without need": {"-attestation-roots", "roots.pem"},
+		"missing file":       {"-config", filepath.Join(t.TempDir(), "missing.json")},
+		"unknown field":      {"-config", writeFile(t, "bad.json", `{"port": 80}`)},
+	} {
+		if _, err := parseConfig(args, io.Discard); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestU2FConfig(t *testing.T) {
+	c := defaultConfig()
+	uc, err := c.u2fConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !uc.SkipAttestationVerify || uc.RootAttestationCertPool != nil {
+		t.Errorf("unexpected config for the skip policy: %+v", uc)
+	}
+
+	cert, err := selfSignedCertificate([]string{"Test Root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Attestation = attestationVerify
+	c.AttestationRoots = writeFile(t, "roots.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})))
+	if uc, err = c.u2fConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if uc.SkipAttestationVerify || uc.RootAttestationCertPool == nil {
+		t.Errorf("unexpected config for the verify policy: %+v", uc)
+	}
+
+	c.AttestationRoots = writeFile(t, "empty.pem", "")
+	if _, err := c.u2fConfig(); err == nil {
+		t.Errorf("expected error for roots file without certificates")
+	}
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	cert, err := defaultConfig().certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.Leaf)
+	for _, host := range []string{"localhost", "127.0.0.1", "::1"} {
+		if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: host, Roots: roots}); err != nil {
+			t.Errorf("%s: %v", host, err)
+		}
+	}
+}
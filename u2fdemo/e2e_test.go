@@ -0,0 +1,477 @@
+// FIDO U2F Go Library
+// Copyright 2015 The FIDO U2F Go Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/softtoken"
+	"github.com/tstranex/u2f/store"
+)
+
+// demo is a running demo server. Its AppID is the test server's URL, as it
+// would be for a deployment.
+type demo struct {
+	t      *testing.T
+	server *server
+	https  *httptest.Server
+	appID  string
+}
+
+func newDemo(t *testing.T) *demo {
+	registrations, err := store.OpenFile(filepath.Join(t.TempDir(), "registrations.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	https := httptest.NewUnstartedServer(nil)
+	https.StartTLS()
+	t.Cleanup(https.Close)
+
+	d := &demo{t: t, https: https, appID: https.URL}
+	d.server = newServer(d.appID, []string{d.appID}, &u2f.Config{SkipAttestationVerify: true}, registrations)
+	https.Config.Handler = d.server
+	return d
+}
+
+// expireChallenges makes the pending challenges of all sessions too old.
+func (d *demo) expireChallenges() {
+	d.server.sessions.mu.Lock()
+	defer d.server.sessions.mu.Unlock()
+	for _, sess := range d.server.sessions.sessions {
+		for _, c := range sess.challenges {
+			c.Timestamp = c.Timestamp.Add(-time.Hour)
+		}
+	}
+}
+
+// browser is a client with its own cookies, logged in as a user. Its tokens
+// answer with its origin.
+type browser struct {
+	t      *testing.T
+	demo   *demo
+	client *http.Client
+	origin string
+}
+
+func (d *demo) login(user string) *browser {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		d.t.Fatal(err)
+	}
+	// The test server's client is shared, so copy it for the cookie jar.
+	client := *d.https.Client()
+	client.Jar = jar
+	b := &browser{t: d.t, demo: d, client: &client, origin: d.appID}
+	if status, msg := b.post("/login", map[string]string{"username": user}, nil); status != http.StatusOK {
+		d.t.Fatalf("login: %d %s", status, msg)
+	}
+	return b
+}
+
+func (b *browser) do(req *http.Request, v interface{}) (int, string) {
+	resp, err := b.client.Do(req)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct{ Error string }
+		json.NewDecoder(resp.Body).Decode(&e)
+		return resp.StatusCode, e.Error
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			b.t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, ""
+}
+
+// post sends body as JSON to path and decodes the response into v. It
+// returns the status code and, for errors, the error message.
+func (b *browser) post(path string, body, v interface{}) (int, string) {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, b.demo.https.URL+path, bytes.NewReader(buf))
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return b.do(req, v)
+}
+
+func (b *browser) get(path string, v interface{}) (int, string) {
+	req, err := http.NewRequest(http.MethodGet, b.demo.https.URL+path, nil)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	return b.do(req, v)
+}
+
+// begin starts a ceremony, failing the test if that doesn't work.
+func (b *browser) begin(path string, v interface{}) {
+	if status, msg := b.post(path, nil, v); status != http.StatusOK {
+		b.t.Fatalf("%s: %d %s", path, status, msg)
+	}
+}
+
+func (b *browser) registerU2F(token *softtoken.Token) (int, string) {
+	var req u2f.WebRegisterRequest
+	b.begin("/u2f/register/begin", &req)
+	resp, err := token.Register(&req, b.origin)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	return b.post("/u2f/register/finish", resp, nil)
+}
+
+func (b *browser) registerWebAuthn(token *softtoken.Token) (int, string) {
+	var opts u2f.PublicKeyCredentialCreationOptions
+	b.begin("/u2f/webauthn/register/begin", &opts)
+	resp, err := token.RegisterWebAuthn(&opts, b.origin)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	return b.post("/u2f/webauthn/register/finish", resp, nil)
+}
+
+// signU2F returns the token's response as well, for replaying it.
+func (b *browser) signU2F(token *softtoken.Token) (*u2f.SignResponse, int, string) {
+	var req u2f.WebSignRequest
+	b.begin("/u2f/sign/begin", &req)
+	resp, err := token.Sign(&req, b.origin)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	status, msg := b.post("/u2f/sign/finish", resp, nil)
+	return resp, status, msg
+}
+
+func (b *browser) signWebAuthn(token *softtoken.Token) (*u2f.WebAuthnAuthenticationResponse, int, string) {
+	var opts u2f.PublicKeyCredentialRequestOptions
+	b.begin("/u2f/webauthn/sign/begin", &opts)
+	resp, err := token.SignWebAuthn(&opts, b.origin)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	status, msg := b.post("/u2f/webauthn/sign/finish", resp, nil)
+	return resp, status, msg
+}
+
+func (b *browser) authenticated() bool {
+	var info struct{ Authenticated bool }
+	if status, msg := b.get("/session", &info); status != http.StatusOK {
+		b.t.Fatalf("session: %d %s", status, msg)
+	}
+	return info.Authenticated
+}
+
+func (b *browser) tokens() []token {
+	var tokens []token
+	if status, msg := b.get("/tokens", &tokens); status != http.StatusOK {
+		b.t.Fatalf("tokens: %d %s", status, msg)
+	}
+	return tokens
+}
+
+// ok fails the test unless a ceremony succeeded.
+func ok(t *testing.T, what string, status int, msg string) {
+	t.Helper()
+	if status != http.StatusOK {
+		t.Fatalf("%s: %d %s", what, status, msg)
+	}
+}
+
+func TestRegisterAndSign(t *testing.T) {
+	d := newDemo(t)
+	alice := d.login("alice")
+
+	if alice.authenticated() {
+		t.Errorf("authenticated before signing")
+	}
+	if status, msg := alice.post("/u2f/webauthn/sign/begin", nil, nil); status != http.StatusBadRequest {
+		t.Errorf("sign without tokens: %d %s", status, msg)
+	}
+
+	u2fToken, webAuthnToken := softtoken.NewTest(t), softtoken.NewTest(t)
+	status, msg := alice.registerU2F(u2fToken)
+	ok(t, "register with U2F", status, msg)
+	status, msg = alice.registerWebAuthn(webAuthnToken)
+	ok(t, "register with WebAuthn", status, msg)
+
+	_, status, msg = alice.signU2F(u2fToken)
+	ok(t, "sign with U2F", status, msg)
+	if !alice.authenticated() {
+		t.Errorf("not authenticated after signing")
+	}
+
+	// A token registered with the U2F Javascript API also signs with
+	// WebAuthn, through the appid extension.
+	_, status, msg = alice.signWebAuthn(u2fToken)
+	ok(t, "sign U2F token with WebAuthn", status, msg)
+	_, status, msg = alice.signWebAuthn(webAuthnToken)
+	ok(t, "sign with WebAuthn", status, msg)
+
+	counters := map[u2f.Fingerprint]uint32{}
+	for _, tok := range alice.tokens() {
+		counters[tok.Fingerprint] = tok.Counter
+	}
+	if len(counters) != 2 {
+		t.Fatalf("unexpected tokens: %v", counters)
+	}
+	for _, c := range []uint32{1, 2} {
+		found := false
+		for _, counter := range counters {
+			found = found || counter == c
+		}
+		if !found {
+			t.Errorf("no token with counter %d: %v", c, counters)
+		}
+	}
+
+	// Registering a token twice is prevented by the exclusion lists.
+	var opts u2f.PublicKeyCredentialCreationOptions
+	alice.begin("/u2f/webauthn/register/begin", &opts)
+	for _, tok := range []*softtoken.Token{u2fToken, webAuthnToken} {
+		if _, err := tok.RegisterWebAuthn(&opts, alice.origin); err != softtoken.ErrAlreadyRegistered {
+			t.Errorf("expected ErrAlreadyRegistered, got %v", err)
+		}
+	}
+
+	// Logging out ends the session and its pending challenges.
+	if status, msg := alice.post("/logout", nil, nil); status != http.StatusOK {
+		t.Fatalf("logout: %d %s", status, msg)
+	}
+	if status, _ := alice.post("/u2f/webauthn/register/begin", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("ceremony after logout: %d", status)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	d := newDemo(t)
+	alice := d.login("alice")
+	token := softtoken.NewTest(t)
+	if status, msg := alice.registerU2F(token); status != http.StatusOK {
+		t.Fatalf("register: %d %s", status, msg)
+	}
+
+	u2fResp, status, msg := alice.signU2F(token)
+	ok(t, "sign with U2F", status, msg)
+	webAuthnResp, status, msg := alice.signWebAuthn(token)
+	ok(t, "sign with WebAuthn", status, msg)
+
+	// The challenges have been used up.
+	if status, msg := alice.post("/u2f/sign/finish", u2fResp, nil); status != http.StatusBadRequest || msg != "no pending challenge" {
+		t.Errorf("U2F replay: %d %s", status, msg)
+	}
+	if status, msg := alice.post("/u2f/webauthn/sign/finish", webAuthnResp, nil); status != http.StatusBadRequest || msg != "no pending challenge" {
+		t.Errorf("WebAuthn replay: %d %s", status, msg)
+	}
+
+	// Responses don't answer new challenges either.
+	alice.begin("/u2f/sign/begin", nil)
+	if status, _ := alice.post("/u2f/sign/finish", u2fResp, nil); status != http.StatusUnauthorized {
+		t.Errorf("U2F replay with new challenge: %d", status)
+	}
+	alice.begin("/u2f/webauthn/sign/begin", nil)
+	if status, _ := alice.post("/u2f/webauthn/sign/finish", webAuthnResp, nil); status != http.StatusUnauthorized {
+		t.Errorf("WebAuthn replay with new challenge: %d", status)
+	}
+
+	// Nor does a response from another session, even of the same user.
+	other := d.login("alice")
+	other.begin("/u2f/webauthn/sign/begin", nil)
+	var opts u2f.PublicKeyCredentialRequestOptions
+	alice.begin("/u2f/webauthn/sign/begin", &opts)
+	resp, err := token.SignWebAuthn(&opts, alice.origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := other.post("/u2f/webauthn/sign/finish", resp, nil); status != http.StatusUnauthorized {
+		t.Errorf("response from another session: %d", status)
+	}
+	if other.authenticated() {
+		t.Errorf("other session authenticated")
+	}
+}
+
+func TestCounterRegression(t *testing.T) {
+	d := newDemo(t)
+	alice := d.login("alice")
+	token := softtoken.NewTest(t)
+	if status, msg := alice.registerU2F(token); status != http.StatusOK {
+		t.Fatalf("register: %d %s", status, msg)
+	}
+
+	clone := token.Clone()
+	token.Counter = 10
+	_, status, msg := alice.signWebAuthn(token)
+	ok(t, "sign", status, msg)
+
+	// The clone's counter is behind the original's, whichever API it
+	// signs with.
+	mallory := d.login("alice")
+	if _, status, msg := mallory.signU2F(clone); status != http.StatusUnauthorized || msg != u2f.ErrCounterTooLow.Error() {
+		t.Errorf("U2F sign with clone: %d %s", status, msg)
+	}
+	if _, status, msg := mallory.signWebAuthn(clone); status != http.StatusUnauthorized || msg != u2f.ErrCounterTooLow.Error() {
+		t.Errorf("WebAuthn sign with clone: %d %s", status, msg)
+	}
+	if mallory.authenticated() {
+		t.Errorf("clone authenticated the session")
+	}
+	if tokens := alice.tokens(); len(tokens) != 1 || tokens[0].Counter != 11 {
+		t.Errorf("unexpected tokens: %+v", tokens)
+	}
+}
+
+func TestWrongOrigin(t *testing.T) {
+	d := newDemo(t)
+	alice := d.login("alice")
+	token := softtoken.NewTest(t)
+	if status, msg := alice.registerU2F(token); status != http.StatusOK {
+		t.Fatalf("register: %d %s", status, msg)
+	}
+
+	alice.origin = "https://evil.example.com"
+	if status, _ := alice.registerU2F(softtoken.NewTest(t)); status != http.StatusBadRequest {
+		t.Errorf("U2F registration: %d", status)
+	}
+	if status, _ := alice.registerWebAuthn(softtoken.NewTest(t)); status != http.StatusBadRequest {
+		t.Errorf("WebAuthn registration: %d", status)
+	}
+	if _, status, _ := alice.signU2F(token); status != http.StatusUnauthorized {
+		t.Errorf("U2F authentication: %d", status)
+	}
+	if _, status, _ := alice.signWebAuthn(token); status != http.StatusUnauthorized {
+		t.Errorf("WebAuthn authentication: %d", status)
+	}
+	if alice.authenticated() || len(alice.tokens()) != 1 {
+		t.Errorf("wrong origin changed the session or tokens")
+	}
+}
+
+func TestExpiredChallenge(t *testing.T) {
+	d := newDemo(t)
+	alice := d.login("alice")
+	token := softtoken.NewTest(t)
+
+	var opts u2f.PublicKeyCredentialCreationOptions
+	alice.begin("/u2f/webauthn/register/begin", &opts)
+	regResp, err := token.RegisterWebAuthn(&opts, alice.origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.expireChallenges()
+	if status, msg := alice.post("/u2f/webauthn/register/finish", regResp, nil); status != http.StatusBadRequest {
+		t.Errorf("registration: %d %s", status, msg)
+	}
+	if len(alice.tokens()) != 0 {
+		t.Errorf("token registered with expired challenge")
+	}
+
+	if status, msg := alice.registerWebAuthn(token); status != http.StatusOK {
+		t.Fatalf("register: %d %s", status, msg)
+	}
+	var req u2f.PublicKeyCredentialRequestOptions
+	alice.begin("/u2f/webauthn/sign/begin", &req)
+	signResp, err := token.SignWebAuthn(&req, alice.origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.expireChallenges()
+	if status, msg := alice.post("/u2f/webauthn/sign/finish", signResp, nil); status != http.StatusUnauthorized {
+		t.Errorf("authentication: %d %s", status, msg)
+	}
+	if alice.authenticated() {
+		t.Errorf("authenticated with expired challenge")
+	}
+}
+
+func TestMultiKeyUsers(t *testing.T) {
+	d := newDemo(t)
+	alice, bob := d.login("alice"), d.login("bob")
+	aliceTokens := []*softtoken.Token{softtoken.NewTest(t), softtoken.NewTest(t)}
+	bobTokens := []*softtoken.Token{softtoken.NewTest(t), softtoken.NewTest(t)}
+	// Alice registers a key with each API, Bob both with the U2F
+	// Javascript API.
+	if status, msg := alice.registerU2F(aliceTokens[0]); status != http.StatusOK {
+		t.Fatalf("register alice: %d %s", status, msg)
+	}
+	if status, msg := alice.registerWebAuthn(aliceTokens[1]); status != http.StatusOK {
+		t.Fatalf("register alice: %d %s", status, msg)
+	}
+	for _, tok := range bobTokens {
+		if status, msg := bob.registerU2F(tok); status != http.StatusOK {
+			t.Fatalf("register bob: %d %s", status, msg)
+		}
+	}
+
+	// Each key works for its user.
+	for _, tok := range aliceTokens {
+		_, status, msg := alice.signWebAuthn(tok)
+		ok(t, "alice", status, msg)
+	}
+	for _, tok := range bobTokens {
+		_, status, msg := bob.signU2F(tok)
+		ok(t, "bob", status, msg)
+	}
+
+	// Bob's keys aren't offered to Alice, and Alice can't finish with
+	// them anyway.
+	var opts u2f.PublicKeyCredentialRequestOptions
+	alice.begin("/u2f/webauthn/sign/begin", &opts)
+	if _, err := bobTokens[0].SignWebAuthn(&opts, alice.origin); err != softtoken.ErrUnknownKeyHandle {
+		t.Errorf("expected ErrUnknownKeyHandle, got %v", err)
+	}
+	bob.begin("/u2f/webauthn/sign/begin", &opts)
+	resp, err := bobTokens[0].SignWebAuthn(&opts, alice.origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice.begin("/u2f/webauthn/sign/begin", nil)
+	if status, msg := alice.post("/u2f/webauthn/sign/finish", resp, nil); status != http.StatusBadRequest || msg != "unknown key handle" {
+		t.Errorf("sign with another user's key: %d %s", status, msg)
+	}
+
+	// Renaming and deleting one key leaves the other.
+	tokens := alice.tokens()
+	if len(tokens) != 2 {
+		t.Fatalf("unexpected tokens: %+v", tokens)
+	}
+	if status, msg := alice.post("/tokens/rename", map[string]interface{}{"fingerprint": tokens[1].Fingerprint, "name": "backup"}, nil); status != http.StatusOK {
+		t.Fatalf("rename: %d %s", status, msg)
+	}
+	if status, msg := alice.post("/tokens/delete", map[string]interface{}{"fingerprint": tokens[0].Fingerprint}, nil); status != http.StatusOK {
+		t.Fatalf("delete: %d %s", status, msg)
+	}
+	if status, _ := bob.post("/tokens/delete", map[string]interface{}{"fingerprint": tokens[1].Fingerprint}, nil); status != http.StatusNotFound {
+		t.Errorf("bob deleted alice's token: %d", status)
+	}
+	if tokens := alice.tokens(); len(tokens) != 1 || tokens[0].Name != "backup" {
+		t.Errorf("unexpected tokens: %+v", tokens)
+	}
+
+	alice.begin("/u2f/webauthn/sign/begin", &opts)
+	if _, err := aliceTokens[0].SignWebAuthn(&opts, alice.origin); err != softtoken.ErrUnknownKeyHandle {
+		t.Errorf("deleted key: expected ErrUnknownKeyHandle, got %v", err)
+	}
+	_, status, msg := alice.signWebAuthn(aliceTokens[1])
+	ok(t, "remaining key", status, msg)
+	if len(bob.tokens()) != 2 {
+		t.Errorf("bob's tokens changed")
+	}
+}
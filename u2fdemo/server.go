@@ -0,0 +1,212 @@
+// FIDO U2F Go Library
+// Copyright 2015 The FIDO U2F Go Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/store"
+	"github.com/tstranex/u2f/u2fhttp"
+)
+
+// server serves the demo:
+//
+//	GET  /               the demo page
+//	GET  /static/...     the page's scripts and style sheet
+//	POST /login          starts a session for {"username": ...}
+//	POST /logout         ends the session
+//	GET  /session        the session's user and authentication state
+//	GET  /tokens         the user's registered tokens
+//	POST /tokens/rename  renames the token {"fingerprint": ..., "name": ...}
+//	POST /tokens/delete  deletes the token {"fingerprint": ...}
+//	POST /u2f/...        the ceremonies, served by u2fhttp.Handler
+type server struct {
+	sessions      *sessionStore
+	registrations store.RegistrationStore
+	mux           *http.ServeMux
+}
+
+func newServer(appID string, trustedFacets []string, config *u2f.Config, registrations store.RegistrationStore) *server {
+	s := &server{
+		sessions:      newSessionStore(),
+		registrations: registrations,
+		mux:           http.NewServeMux(),
+	}
+	u2fHandler := &u2fhttp.Handler{
+		AppID:         appID,
+		TrustedFacets: trustedFacets,
+		Config:        config,
+		Users:         s.sessions,
+		Challenges:    s.sessions,
+		Registrations: registrations,
+		Authenticated: func(w http.ResponseWriter, r *http.Request, user string, rec *store.Record) {
+			log.Printf("%s authenticated with %s, counter %d", user, rec.Registration.Fingerprint(), rec.Counter)
+			s.sessions.markAuthenticated(r)
+		},
+	}
+
+	s.mux.HandleFunc("/", indexHandler)
+	s.mux.Handle("/static/", staticHandler)
+	s.mux.HandleFunc("/login", s.post(s.login))
+	s.mux.HandleFunc("/logout", s.post(s.loggedIn(s.logout)))
+	s.mux.HandleFunc("/session", s.loggedIn(s.sessionInfo))
+	s.mux.HandleFunc("/tokens", s.loggedIn(s.listTokens))
+	s.mux.HandleFunc("/tokens/rename", s.post(s.loggedIn(s.renameToken)))
+	s.mux.HandleFunc("/tokens/delete", s.post(s.loggedIn(s.deleteToken)))
+	s.mux.Handle("/u2f/", http.StripPrefix("/u2f", u2fHandler))
+	return s
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.sessions.withSession(s.mux).ServeHTTP(w, r)
+}
+
+func (s *server) post(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (s *server) loggedIn(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if sessionFromContext(r.Context()) == nil {
+			writeError(w, http.StatusUnauthorized, "not logged in")
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (s *server) login(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	// The demo has no passwords: the username is the first factor.
+	username := strings.TrimSpace(req.Username)
+	if username == "" || len(username) > 64 {
+		writeError(w, http.StatusBadRequest, "invalid username")
+		return
+	}
+	if err := s.sessions.start(w, username); err != nil {
+		log.Printf("session error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	log.Printf("%s logged in", username)
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (s *server) logout(w http.ResponseWriter, r *http.Request) {
+	s.sessions.end(w, sessionFromContext(r.Context()))
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func (s *server) sessionInfo(w http.ResponseWriter, r *http.Request) {
+	sess := sessionFromContext(r.Context())
+	s.sessions.mu.Lock()
+	info := struct {
+		Username      string `json:"username"`
+		Authenticated bool   `json:"authenticated"`
+	}{sess.user, sess.authenticated}
+	s.sessions.mu.Unlock()
+	writeJSON(w, http.StatusOK, info)
+}
+
+type token struct {
+	Fingerprint u2f.Fingerprint `json:"fingerprint"`
+	Name        string          `json:"name"`
+	Counter     uint32          `json:"counter"`
+	Created     time.Time       `json:"created"`
+}
+
+func (s *server) listTokens(w http.ResponseWriter, r *http.Request) {
+	recs, err := s.registrations.List(r.Context(), sessionFromContext(r.Context()).user)
+	if err != nil {
+		log.Printf("store error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	tokens := make([]token, len(recs))
+	for i, rec := range recs {
+		tokens[i] = token{
+			Fingerprint: rec.Registration.Fingerprint(),
+			Name:        rec.Name,
+			Counter:     rec.Counter,
+			Created:     rec.Created,
+		}
+	}
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+func (s *server) renameToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Fingerprint u2f.Fingerprint `json:"fingerprint"`
+		Name        string          `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	user := sessionFromContext(r.Context()).user
+	s.storeResult(w, s.registrations.Rename(r.Context(), user, req.Fingerprint, strings.TrimSpace(req.Name)))
+}
+
+// deleteToken deletes a token. A real application would require the
+// session to be authenticated with a token first, except for the last one.
+func (s *server) deleteToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Fingerprint u2f.Fingerprint `json:"fingerprint"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	user := sessionFromContext(r.Context()).user
+	err := s.registrations.Delete(r.Context(), user, req.Fingerprint)
+	if err == nil {
+		log.Printf("%s deleted %s", user, req.Fingerprint)
+	}
+	s.storeResult(w, err)
+}
+
+func (s *server) storeResult(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, struct{}{})
+	case err == store.ErrNotFound:
+		writeError(w, http.StatusNotFound, "unknown token")
+	default:
+		log.Printf("store error: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{message})
+}
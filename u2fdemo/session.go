@@ -0,0 +1,166 @@
+// FIDO U2F Go Library
+// Copyright 2015 The FIDO U2F Go Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/store"
+)
+
+const (
+	sessionCookie   = "u2fdemo_session"
+	sessionLifetime = 12 * time.Hour
+)
+
+// session is the state of a browser. Sessions are kept in memory, so users
+// have to log in again when the demo restarts; their tokens are persisted.
+type session struct {
+	id      string
+	expires time.Time
+
+	// user is empty until the user logs in.
+	user string
+
+	// authenticated is set once the user has signed with a registered
+	// token. A real application would only grant access at this point.
+	authenticated bool
+
+	// challenges are the pending challenges, so that ceremonies in
+	// different browsers don't interfere, even for the same user.
+	challenges map[string]*u2f.Challenge
+}
+
+// sessionStore keeps the sessions. It is also the store.ChallengeStore of
+// the demo, storing challenges in the session of the request.
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]*session)}
+}
+
+type sessionKey struct{}
+
+// withSession adds the session of the request, if any, to its context.
+func (s *sessionStore) withSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			s.mu.Lock()
+			sess := s.sessions[cookie.Value]
+			if sess != nil && time.Now().After(sess.expires) {
+				delete(s.sessions, sess.id)
+				sess = nil
+			}
+			s.mu.Unlock()
+			if sess != nil {
+				r = r.WithContext(context.WithValue(r.Context(), sessionKey{}, sess))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func sessionFromContext(ctx context.Context) *session {
+	sess, _ := ctx.Value(sessionKey{}).(*session)
+	return sess
+}
+
+// start creates a session for the user and sets its cookie.
+func (s *sessionStore) start(w http.ResponseWriter, user string) error {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	sess := &session{
+		id:         base64.RawURLEncoding.EncodeToString(buf),
+		expires:    time.Now().Add(sessionLifetime),
+		user:       user,
+		challenges: make(map[string]*u2f.Challenge),
+	}
+
+	s.mu.Lock()
+	for id, old := range s.sessions {
+		if time.Now().After(old.expires) {
+			delete(s.sessions, id)
+		}
+	}
+	s.sessions[sess.id] = sess
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    sess.id,
+		Path:     "/",
+		Expires:  sess.expires,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nil
+}
+
+// end deletes the session and its cookie.
+func (s *sessionStore) end(w http.ResponseWriter, sess *session) {
+	s.mu.Lock()
+	delete(s.sessions, sess.id)
+	s.mu.Unlock()
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+}
+
+// User implements u2fhttp.UserResolver.
+func (s *sessionStore) User(r *http.Request) (string, error) {
+	sess := sessionFromContext(r.Context())
+	if sess == nil {
+		return "", errors.New("not logged in")
+	}
+	return sess.user, nil
+}
+
+// markAuthenticated is the u2fhttp.Handler's Authenticated callback.
+func (s *sessionStore) markAuthenticated(r *http.Request) {
+	sess := sessionFromContext(r.Context())
+	s.mu.Lock()
+	sess.authenticated = true
+	s.mu.Unlock()
+}
+
+// Put implements store.ChallengeStore.
+func (s *sessionStore) Put(ctx context.Context, key string, c *u2f.Challenge) error {
+	sess := sessionFromContext(ctx)
+	if sess == nil {
+		return errors.New("u2fdemo: no session")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess.challenges[key] = c
+	return nil
+}
+
+// Take implements store.ChallengeStore.
+func (s *sessionStore) Take(ctx context.Context, key string) (*u2f.Challenge, error) {
+	sess := sessionFromContext(ctx)
+	if sess == nil {
+		return nil, store.ErrChallengeNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := sess.challenges[key]
+	if !ok {
+		return nil, store.ErrChallengeNotFound
+	}
+	delete(sess.challenges, key)
+	return c, nil
+}
@@ -0,0 +1,248 @@
+// FIDO U2F Go Library Demo
+//
+// Tokens are registered and used with the WebAuthn API. Tokens registered
+// with the U2F Javascript API are still found through the appid extension.
+// Browsers without WebAuthn fall back to the U2F Javascript API, if they
+// have it.
+
+'use strict';
+
+var useWebAuthn = !!(window.PublicKeyCredential && navigator.credentials);
+
+function $(id) {
+  return document.getElementById(id);
+}
+
+function showStatus(msg, isError) {
+  $('status').textContent = msg;
+  $('status').className = isError ? 'error' : '';
+}
+
+function fail(err) {
+  console.log(err);
+  showStatus(err.message || String(err), true);
+}
+
+// request calls the server and resolves to the decoded JSON response.
+function request(method, path, data) {
+  var opts = {method: method, credentials: 'same-origin'};
+  if (method === 'POST') {
+    opts.headers = {'Content-Type': 'application/json'};
+    opts.body = JSON.stringify(data || {});
+  }
+  return fetch(path, opts).then(function(resp) {
+    return resp.json().then(function(body) {
+      if (!resp.ok) {
+        throw new Error('Server error ' + resp.status + ': ' + body.error);
+      }
+      return body;
+    });
+  });
+}
+
+function post(path, data) {
+  return request('POST', path, data);
+}
+
+// The Go endpoints encode binary values as unpadded base64url strings.
+
+function decodeBase64(s) {
+  s = s.replace(/-/g, '+').replace(/_/g, '/');
+  while (s.length % 4) {
+    s += '=';
+  }
+  var bin = atob(s);
+  var buf = new Uint8Array(bin.length);
+  for (var i = 0; i < bin.length; i++) {
+    buf[i] = bin.charCodeAt(i);
+  }
+  return buf.buffer;
+}
+
+function encodeBase64(buf) {
+  var bytes = new Uint8Array(buf);
+  var bin = '';
+  for (var i = 0; i < bytes.length; i++) {
+    bin += String.fromCharCode(bytes[i]);
+  }
+  return btoa(bin).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+function decodeDescriptors(creds) {
+  return (creds || []).map(function(c) {
+    return {type: c.type, id: decodeBase64(c.id), transports: c.transports};
+  });
+}
+
+function registerWebAuthn() {
+  return post('/u2f/webauthn/register/begin').then(function(opts) {
+    console.log(opts);
+    opts.challenge = decodeBase64(opts.challenge);
+    opts.user.id = decodeBase64(opts.user.id);
+    opts.excludeCredentials = decodeDescriptors(opts.excludeCredentials);
+    return navigator.credentials.create({publicKey: opts});
+  }).then(function(cred) {
+    var resp = cred.response;
+    return post('/u2f/webauthn/register/finish', {
+      id: cred.id,
+      rawId: encodeBase64(cred.rawId),
+      type: cred.type,
+      response: {
+        clientDataJSON: encodeBase64(resp.clientDataJSON),
+        attestationObject: encodeBase64(resp.attestationObject),
+        transports: resp.getTransports ? resp.getTransports() : []
+      },
+      clientExtensionResults: cred.getClientExtensionResults()
+    });
+  });
+}
+
+function signWebAuthn() {
+  return post('/u2f/webauthn/sign/begin').then(function(opts) {
+    console.log(opts);
+    opts.challenge = decodeBase64(opts.challenge);
+    opts.allowCredentials = decodeDescriptors(opts.allowCredentials);
+    return navigator.credentials.get({publicKey: opts});
+  }).then(function(cred) {
+    var resp = cred.response;
+    return post('/u2f/webauthn/sign/finish', {
+      id: cred.id,
+      rawId: encodeBase64(cred.rawId),
+      type: cred.type,
+      response: {
+        clientDataJSON: encodeBase64(resp.clientDataJSON),
+        authenticatorData: encodeBase64(resp.authenticatorData),
+        signature: encodeBase64(resp.signature),
+        userHandle: resp.userHandle ? encodeBase64(resp.userHandle) : undefined
+      },
+      clientExtensionResults: cred.getClientExtensionResults()
+    });
+  });
+}
+
+// u2fCall wraps a call of the callback based U2F Javascript API.
+function u2fCall(call) {
+  return new Promise(function(resolve, reject) {
+    call(function(resp) {
+      console.log(resp);
+      if (resp.errorCode) {
+        reject(new Error('U2F error code ' + resp.errorCode +
+            (resp.errorMessage ? ': ' + resp.errorMessage : '')));
+      } else {
+        resolve(resp);
+      }
+    });
+  });
+}
+
+function registerU2F() {
+  return post('/u2f/register/begin').then(function(req) {
+    console.log(req);
+    return u2fCall(function(callback) {
+      u2f.register(req.appId, req.registerRequests, req.registeredKeys, callback, 30);
+    });
+  }).then(function(resp) {
+    return post('/u2f/register/finish', resp);
+  });
+}
+
+function signU2F() {
+  return post('/u2f/sign/begin').then(function(req) {
+    console.log(req);
+    return u2fCall(function(callback) {
+      u2f.sign(req.appId, req.challenge, req.registeredKeys, callback, 30);
+    });
+  }).then(function(resp) {
+    return post('/u2f/sign/finish', resp);
+  });
+}
+
+function refresh() {
+  return request('GET', '/session').then(function(sess) {
+    $('login').hidden = true;
+    $('user').hidden = false;
+    $('name').textContent = sess.username;
+    $('state').textContent = sess.authenticated ?
+        'authenticated with a token' : 'not authenticated with a token';
+    return request('GET', '/tokens').then(showTokens);
+  }, function() {
+    $('user').hidden = true;
+    $('login').hidden = false;
+  });
+}
+
+function button(label, onclick) {
+  var b = document.createElement('button');
+  b.textContent = label;
+  b.onclick = onclick;
+  return b;
+}
+
+function cell(row, content) {
+  var td = row.insertCell();
+  if (typeof content === 'string') {
+    td.textContent = content;
+  } else {
+    td.appendChild(content);
+  }
+  return td;
+}
+
+function showTokens(tokens) {
+  var tbody = $('tokens');
+  tbody.textContent = '';
+  tokens.forEach(function(t) {
+    var row = tbody.insertRow();
+    cell(row, t.name || '(unnamed)');
+    var code = document.createElement('code');
+    code.textContent = t.fingerprint;
+    cell(row, code);
+    cell(row, String(t.counter));
+    cell(row, new Date(t.created).toLocaleString());
+    var actions = cell(row, button('Rename', function() { rename(t); }));
+    actions.appendChild(button('Delete', function() { remove(t); }));
+  });
+}
+
+function rename(t) {
+  var name = prompt('Name of the token', t.name);
+  if (name !== null) {
+    post('/tokens/rename', {fingerprint: t.fingerprint, name: name}).then(refresh).catch(fail);
+  }
+}
+
+function remove(t) {
+  if (confirm('Delete token ' + (t.name || t.fingerprint) + '?')) {
+    post('/tokens/delete', {fingerprint: t.fingerprint}).then(refresh).catch(fail);
+  }
+}
+
+function ceremony(webAuthn, legacy) {
+  return function() {
+    var run = useWebAuthn ? webAuthn : legacy;
+    if (!useWebAuthn && !window.u2f) {
+      fail(new Error('This browser supports neither WebAuthn nor the U2F Javascript API.'));
+      return;
+    }
+    showStatus('Touch your token.');
+    run().then(function(result) {
+      console.log(result);
+      showStatus('Success.');
+      return refresh();
+    }).catch(fail);
+  };
+}
+
+$('login').onsubmit = function(e) {
+  e.preventDefault();
+  post('/login', {username: $('username').value}).then(refresh).catch(fail);
+};
+$('logout').onclick = function() {
+  post('/logout').then(refresh).catch(fail);
+};
+$('register').onclick = ceremony(registerWebAuthn, registerU2F);
+$('sign').onclick = ceremony(signWebAuthn, signU2F);
+$('api').textContent = useWebAuthn ? 'WebAuthn' :
+    window.u2f ? 'the U2F Javascript API' : 'no supported API';
+
+refresh();
@@ -0,0 +1,413 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+/*
+Package u2fhttp implements the server side of the U2F registration and
+authentication ceremonies as an http.Handler.
+
+The Handler serves endpoints for the U2F Javascript API and for WebAuthn,
+which all take POST requests and respond with JSON:
+
+	/register/begin           returns a u2f.WebRegisterRequest
+	/register/finish          takes a u2f.RegisterResponse
+	/sign/begin               returns a u2f.WebSignRequest
+	/sign/finish              takes a u2f.SignResponse
+	/webauthn/register/begin  returns u2f.PublicKeyCredentialCreationOptions
+	/webauthn/register/finish takes a u2f.WebAuthnRegistrationResponse
+	/webauthn/sign/begin      returns u2f.PublicKeyCredentialRequestOptions
+	/webauthn/sign/finish     takes a u2f.WebAuthnAuthenticationResponse
+
+Tokens registered with either API can be used with both, as far as browsers
+allow: WebAuthn authentications use the appid extension for tokens
+registered with the U2F Javascript API.
+
+Errors are reported with a status code and a body of the form
+{"error": "message"}.
+
+The application provides the user identification, which usually relies on a
+session established by the first authentication factor, and storage for
+challenges and registrations, e.g. one of package store:
+
+	h := &u2fhttp.Handler{
+		AppID:         "https://example.com",
+		Users:         u2fhttp.UserResolverFunc(userFromSession),
+		Challenges:    store.NewMemoryChallenges(),
+		Registrations: registrationStore,
+		Authenticated: markSessionAuthenticated,
+	}
+	http.Handle("/u2f/", http.StripPrefix("/u2f", h))
+*/
+package u2fhttp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/store"
+)
+
+// DefaultMaxBodySize is the default limit of request bodies.
+const DefaultMaxBodySize = 64 << 10
+
+// Handler serves the registration and authentication endpoints.
+type Handler struct {
+	// AppID is the U2F AppID of the application.
+	AppID string
+
+	// TrustedFacets are the accepted origins. They default to the AppID.
+	TrustedFacets []string
+
+	// Facets, if set, looks up the accepted origins for each challenge
+	// instead of TrustedFacets.
+	Facets u2f.FacetResolver
+
+	// Config is passed to the registration and authentication functions
+	// of package u2f, so that its Events hook sees every ceremony. They
+	// get the request's context, which the hook receives if it is a
+	// u2f.ContextEventHook.
+	Config *u2f.Config
+
+	Users         UserResolver
+	Challenges    store.ChallengeStore
+	Registrations store.RegistrationStore
+
+	// Authenticated, if set, is called after a successful authentication,
+	// before the response is written, e.g. to mark the session as fully
+	// authenticated.
+	Authenticated func(w http.ResponseWriter, r *http.Request, user string, rec *store.Record)
+
+	// MaxBodySize limits the size of request bodies. It defaults to
+	// DefaultMaxBodySize.
+	MaxBodySize int64
+
+	// ErrorLog logs internal errors, e.g. of the stores. If nil, the log
+	// package's standard logger is used.
+	ErrorLog *log.Logger
+}
+
+// httpError is an error with the status code to respond with.
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+func errorf(status int, message string) error {
+	return &httpError{status: status, message: message}
+}
+
+// RegisterResult is the response to a successful registration.
+type RegisterResult struct {
+	Fingerprint u2f.Fingerprint `json:"fingerprint"`
+}
+
+// SignResult is the response to a successful authentication.
+type SignResult struct {
+	Fingerprint u2f.Fingerprint `json:"fingerprint"`
+	Counter     uint32          `json:"counter"`
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var handle func(w http.ResponseWriter, r *http.Request, user string) (interface{}, error)
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/register/begin":
+		handle = h.registerBegin
+	case "/register/finish":
+		handle = h.registerFinish
+	case "/sign/begin":
+		handle = h.signBegin
+	case "/sign/finish":
+		handle = h.signFinish
+	case "/webauthn/register/begin":
+		handle = h.webAuthnRegisterBegin
+	case "/webauthn/register/finish":
+		handle = h.webAuthnRegisterFinish
+	case "/webauthn/sign/begin":
+		handle = h.webAuthnSignBegin
+	case "/webauthn/sign/finish":
+		handle = h.webAuthnSignFinish
+	default:
+		h.writeError(w, errorf(http.StatusNotFound, "not found"))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		h.writeError(w, errorf(http.StatusMethodNotAllowed, "method not allowed"))
+		return
+	}
+
+	maxBodySize := h.MaxBodySize
+	if maxBodySize == 0 {
+		maxBodySize = DefaultMaxBodySize
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+
+	user, err := h.Users.User(r)
+	if err != nil {
+		h.writeError(w, errorf(http.StatusUnauthorized, "unauthorized"))
+		return
+	}
+
+	resp, err := handle(w, r, user)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) registerBegin(w http.ResponseWriter, r *http.Request, user string) (interface{}, error) {
+	c, regs, err := h.beginRegister(r, user)
+	if err != nil {
+		return nil, err
+	}
+	return u2f.NewWebRegisterRequest(c, regs), nil
+}
+
+func (h *Handler) registerFinish(w http.ResponseWriter, r *http.Request, user string) (interface{}, error) {
+	var resp u2f.RegisterResponse
+	if err := decodeJSON(r, &resp); err != nil {
+		return nil, err
+	}
+	return h.finishRegister(r, user, func(c u2f.Challenge) (*u2f.Registration, error) {
+		return u2f.RegisterContext(r.Context(), resp, c, h.Config)
+	})
+}
+
+func (h *Handler) signBegin(w http.ResponseWriter, r *http.Request, user string) (interface{}, error) {
+	c, regs, err := h.beginSign(r, user)
+	if err != nil {
+		return nil, err
+	}
+	return c.SignRequest(regs), nil
+}
+
+func (h *Handler) signFinish(w http.ResponseWriter, r *http.Request, user string) (interface{}, error) {
+	var resp u2f.SignResponse
+	if err := decodeJSON(r, &resp); err != nil {
+		return nil, err
+	}
+	return h.finishSign(w, r, user, resp.KeyHandle, func(reg *u2f.Registration, c u2f.Challenge, counter uint32) (uint32, error) {
+		return reg.AuthenticateContext(r.Context(), resp, c, counter, h.Config)
+	})
+}
+
+func (h *Handler) webAuthnRegisterBegin(w http.ResponseWriter, r *http.Request, user string) (interface{}, error) {
+	c, regs, err := h.beginRegister(r, user)
+	if err != nil {
+		return nil, err
+	}
+	// The user handle identifies the user without revealing the user ID
+	// to the authenticator.
+	userHandle := sha256.Sum256([]byte(user))
+	entity := u2f.PublicKeyCredentialUserEntity{
+		ID:          base64.RawURLEncoding.EncodeToString(userHandle[:]),
+		Name:        user,
+		DisplayName: user,
+	}
+	return u2f.NewWebAuthnCreationOptions(c, entity, regs)
+}
+
+func (h *Handler) webAuthnRegisterFinish(w http.ResponseWriter, r *http.Request, user string) (interface{}, error) {
+	var resp u2f.WebAuthnRegistrationResponse
+	if err := decodeJSON(r, &resp); err != nil {
+		return nil, err
+	}
+	return h.finishRegister(r, user, func(c u2f.Challenge) (*u2f.Registration, error) {
+		return u2f.RegisterWebAuthnContext(r.Context(), resp, c, h.Config)
+	})
+}
+
+func (h *Handler) webAuthnSignBegin(w http.ResponseWriter, r *http.Request, user string) (interface{}, error) {
+	c, regs, err := h.beginSign(r, user)
+	if err != nil {
+		return nil, err
+	}
+	return c.WebAuthnRequestOptions(regs)
+}
+
+func (h *Handler) webAuthnSignFinish(w http.ResponseWriter, r *http.Request, user string) (interface{}, error) {
+	var resp u2f.WebAuthnAuthenticationResponse
+	if err := decodeJSON(r, &resp); err != nil {
+		return nil, err
+	}
+	return h.finishSign(w, r, user, resp.KeyHandle(), func(reg *u2f.Registration, c u2f.Challenge, counter uint32) (uint32, error) {
+		return reg.AuthenticateWebAuthnContext(r.Context(), resp, c, counter, h.Config)
+	})
+}
+
+// beginRegister stores a new registration challenge and returns it with the
+// user's registrations.
+func (h *Handler) beginRegister(r *http.Request, user string) (*u2f.Challenge, []u2f.Registration, error) {
+	recs, err := h.Registrations.List(r.Context(), user)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := u2f.NewChallengeContext(r.Context(), h.AppID, h.facets())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := h.Challenges.Put(r.Context(), registerKey(user), c); err != nil {
+		return nil, nil, err
+	}
+	return c, store.Registrations(recs), nil
+}
+
+// finishRegister verifies a registration response with register and stores
+// the registration.
+func (h *Handler) finishRegister(r *http.Request, user string, register func(c u2f.Challenge) (*u2f.Registration, error)) (interface{}, error) {
+	c, err := h.takeChallenge(r, registerKey(user))
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := register(*c)
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, err.Error())
+	}
+
+	rec := store.Record{Registration: *reg, Created: time.Now()}
+	err = h.Registrations.Add(r.Context(), user, rec)
+	if err == store.ErrExists {
+		return nil, errorf(http.StatusConflict, "token is already registered")
+	} else if err != nil {
+		return nil, err
+	}
+	return &RegisterResult{Fingerprint: reg.Fingerprint()}, nil
+}
+
+// beginSign stores a new authentication challenge and returns it with the
+// user's registrations.
+func (h *Handler) beginSign(r *http.Request, user string) (*u2f.Challenge, []u2f.Registration, error) {
+	recs, err := h.Registrations.List(r.Context(), user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(recs) == 0 {
+		return nil, nil, errorf(http.StatusBadRequest, "no registered tokens")
+	}
+	c, err := u2f.NewChallengeContext(r.Context(), h.AppID, h.facets())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := h.Challenges.Put(r.Context(), signKey(user), c); err != nil {
+		return nil, nil, err
+	}
+	return c, store.Registrations(recs), nil
+}
+
+// finishSign verifies an authentication response made with the key handle
+// with authenticate and stores the new counter.
+func (h *Handler) finishSign(w http.ResponseWriter, r *http.Request, user, keyHandle string,
+	authenticate func(reg *u2f.Registration, c u2f.Challenge, counter uint32) (uint32, error)) (interface{}, error) {
+	c, err := h.takeChallenge(r, signKey(user))
+	if err != nil {
+		return nil, err
+	}
+
+	kh, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(keyHandle, "="))
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid key handle")
+	}
+	rec, err := h.Registrations.Get(r.Context(), user, kh)
+	if err == store.ErrNotFound {
+		return nil, errorf(http.StatusBadRequest, "unknown key handle")
+	} else if err != nil {
+		return nil, err
+	}
+
+	counter, err := authenticate(&rec.Registration, *c, rec.Counter)
+	if err != nil {
+		return nil, errorf(http.StatusUnauthorized, err.Error())
+	}
+
+	// The store checks the counter again, in case a concurrent
+	// authentication with a higher counter finished first.
+	fingerprint := rec.Registration.Fingerprint()
+	err = h.Registrations.UpdateCounter(r.Context(), user, fingerprint, counter)
+	if err == u2f.ErrCounterTooLow {
+		return nil, errorf(http.StatusUnauthorized, err.Error())
+	} else if err != nil {
+		return nil, err
+	}
+	rec.Counter = counter
+
+	if h.Authenticated != nil {
+		h.Authenticated(w, r, user, rec)
+	}
+	return &SignResult{Fingerprint: fingerprint, Counter: counter}, nil
+}
+
+func (h *Handler) takeChallenge(r *http.Request, key string) (*u2f.Challenge, error) {
+	c, err := h.Challenges.Take(r.Context(), key)
+	if err == store.ErrChallengeNotFound {
+		return nil, errorf(http.StatusBadRequest, "no pending challenge")
+	}
+	return c, err
+}
+
+func (h *Handler) facets() u2f.FacetResolver {
+	if h.Facets != nil {
+		return h.Facets
+	}
+	if len(h.TrustedFacets) > 0 {
+		return u2f.StaticFacets(h.TrustedFacets)
+	}
+	return u2f.StaticFacets{h.AppID}
+}
+
+func (h *Handler) writeError(w http.ResponseWriter, err error) {
+	var he *httpError
+	if !errors.As(err, &he) {
+		h.logf("u2fhttp: %v", err)
+		he = &httpError{status: http.StatusInternalServerError, message: "internal error"}
+	}
+	writeJSON(w, he.status, struct {
+		Error string `json:"error"`
+	}{he.message})
+}
+
+func (h *Handler) logf(format string, args ...interface{}) {
+	if h.ErrorLog != nil {
+		h.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func decodeJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return errorf(http.StatusRequestEntityTooLarge, "request body too large")
+		}
+		return errorf(http.StatusBadRequest, "invalid JSON: "+err.Error())
+	}
+	return nil
+}
+
+// The challenges of registrations and authentications are stored apart so
+// that one can't be used to finish the other.
+func registerKey(user string) string { return "register:" + user }
+func signKey(user string) string     { return "sign:" + user }
@@ -0,0 +1,378 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2fhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/softtoken"
+	"github.com/tstranex/u2f/store"
+)
+
+const appID = "https://example.com"
+
+type testServer struct {
+	t             *testing.T
+	server        *httptest.Server
+	handler       *Handler
+	registrations *store.Memory
+	authenticated []string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	ts := &testServer{t: t, registrations: store.NewMemory()}
+	ts.handler = &Handler{
+		AppID:  appID,
+		Config: &u2f.Config{SkipAttestationVerify: true},
+		Users: UserResolverFunc(func(r *http.Request) (string, error) {
+			user := r.Header.Get("X-User")
+			if user == "" {
+				return "", errors.New("no user")
+			}
+			return user, nil
+		}),
+		Challenges:    store.NewMemoryChallenges(),
+		Registrations: ts.registrations,
+		Authenticated: func(w http.ResponseWriter, r *http.Request, user string, rec *store.Record) {
+			ts.authenticated = append(ts.authenticated, user)
+		},
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/u2f/", http.StripPrefix("/u2f", ts.handler))
+	ts.server = httptest.NewServer(mux)
+	t.Cleanup(ts.server.Close)
+	return ts
+}
+
+// post sends a request and decodes the response into v, returning the status
+// code and, for errors, the error message.
+func (ts *testServer) post(user, path string, body interface{}, v interface{}) (int, string) {
+	var buf []byte
+	if s, ok := body.(string); ok {
+		buf = []byte(s)
+	} else if body != nil {
+		var err error
+		if buf, err = json.Marshal(body); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	req, _ := http.NewRequest(http.MethodPost, ts.server.URL+"/u2f"+path, bytes.NewReader(buf))
+	if user != "" {
+		req.Header.Set("X-User", user)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		ts.t.Errorf("%s: unexpected content type %q", path, ct)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct{ Error string }
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+			ts.t.Fatal(err)
+		}
+		return resp.StatusCode, e.Error
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			ts.t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, ""
+}
+
+func (ts *testServer) register(user string, token *softtoken.Token) (int, string) {
+	var req u2f.WebRegisterRequest
+	if status, msg := ts.post(user, "/register/begin", nil, &req); status != http.StatusOK {
+		ts.t.Fatalf("register begin: %d %s", status, msg)
+	}
+	resp, err := token.Register(&req, appID)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	var result RegisterResult
+	return ts.post(user, "/register/finish", resp, &result)
+}
+
+func (ts *testServer) sign(user string, token *softtoken.Token) (*u2f.SignResponse, int, string) {
+	var req u2f.WebSignRequest
+	if status, msg := ts.post(user, "/sign/begin", nil, &req); status != http.StatusOK {
+		return nil, status, msg
+	}
+	resp, err := token.Sign(&req, appID)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	var result SignResult
+	status, msg := ts.post(user, "/sign/finish", resp, &result)
+	return resp, status, msg
+}
+
+func TestCeremonies(t *testing.T) {
+	ts := newTestServer(t)
+	token := softtoken.NewTest(t)
+
+	if _, status, msg := ts.sign("alice", token); status != http.StatusBadRequest || msg != "no registered tokens" {
+		t.Errorf("sign without registration: %d %s", status, msg)
+	}
+
+	if status, msg := ts.register("alice", token); status != http.StatusOK {
+		t.Fatalf("register: %d %s", status, msg)
+	}
+
+	// The registered token is excluded from new registrations.
+	var req u2f.WebRegisterRequest
+	ts.post("alice", "/register/begin", nil, &req)
+	if _, err := token.Register(&req, appID); err != softtoken.ErrAlreadyRegistered {
+		t.Errorf("expected ErrAlreadyRegistered, got %v", err)
+	}
+
+	// If a token is registered anyway, the registration is refused.
+	ts.post("carol", "/register/begin", nil, &req)
+	other := softtoken.NewTest(t)
+	regResp, err := other.Register(&req, appID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, _ := base64.RawURLEncoding.DecodeString(req.RegisterRequests[0].Challenge)
+	c := u2f.Challenge{Challenge: challenge, Timestamp: time.Now(), AppID: appID, TrustedFacets: []string{appID}}
+	reg, err := u2f.Register(*regResp, c, ts.handler.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.registrations.Add(context.Background(), "carol", store.Record{Registration: *reg})
+	if status, msg := ts.post("carol", "/register/finish", regResp, nil); status != http.StatusConflict {
+		t.Errorf("expected conflict for registering the same token twice, got %d %s", status, msg)
+	}
+
+	token.Counter = 10
+	resp, status, msg := ts.sign("alice", token)
+	if status != http.StatusOK {
+		t.Fatalf("sign: %d %s", status, msg)
+	}
+	if len(ts.authenticated) != 1 || ts.authenticated[0] != "alice" {
+		t.Errorf("Authenticated not called: %v", ts.authenticated)
+	}
+	recs, _ := ts.registrations.List(context.Background(), "alice")
+	if len(recs) != 1 || recs[0].Counter != 11 {
+		t.Errorf("unexpected records: %+v", recs)
+	}
+
+	// The challenge can't be used twice.
+	if status, msg := ts.post("alice", "/sign/finish", resp, nil); status != http.StatusBadRequest || msg != "no pending challenge" {
+		t.Errorf("replay: %d %s", status, msg)
+	}
+
+	// Nor can a registration challenge finish an authentication.
+	ts.post("alice", "/register/begin", nil, nil)
+	if status, _ := ts.post("alice", "/sign/finish", resp, nil); status != http.StatusBadRequest {
+		t.Errorf("sign with registration challenge: %d", status)
+	}
+
+	// Bob can't sign with Alice's token.
+	if _, status, _ := ts.sign("bob", token); status != http.StatusBadRequest {
+		t.Errorf("sign by other user: %d", status)
+	}
+
+	// A cloned token is detected by its counter.
+	clone := token.Clone()
+	clone.Counter = 0
+	if _, status, msg := ts.sign("alice", clone); status != http.StatusUnauthorized || msg != u2f.ErrCounterTooLow.Error() {
+		t.Errorf("sign with clone: %d %s", status, msg)
+	}
+	if len(ts.authenticated) != 1 {
+		t.Errorf("Authenticated called for failed authentication")
+	}
+}
+
+// TestWebAuthn checks the WebAuthn endpoints, and that tokens registered
+// with either API work with both.
+func TestWebAuthn(t *testing.T) {
+	ts := newTestServer(t)
+	token := softtoken.NewTest(t)
+
+	var opts u2f.PublicKeyCredentialCreationOptions
+	if status, msg := ts.post("alice", "/webauthn/register/begin", nil, &opts); status != http.StatusOK {
+		t.Fatalf("register begin: %d %s", status, msg)
+	}
+	if opts.User.Name != "alice" || opts.User.ID == "" || opts.User.ID == "alice" {
+		t.Errorf("unexpected user entity: %+v", opts.User)
+	}
+	regResp, err := token.RegisterWebAuthn(&opts, appID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, msg := ts.post("alice", "/webauthn/register/finish", regResp, nil); status != http.StatusOK {
+		t.Fatalf("register finish: %d %s", status, msg)
+	}
+
+	// A token registered with the U2F Javascript API is excluded, and can
+	// sign through the appid extension.
+	legacy := softtoken.NewTest(t)
+	if status, msg := ts.register("alice", legacy); status != http.StatusOK {
+		t.Fatalf("register: %d %s", status, msg)
+	}
+	ts.post("alice", "/webauthn/register/begin", nil, &opts)
+	if _, err := legacy.RegisterWebAuthn(&opts, appID); err != softtoken.ErrAlreadyRegistered {
+		t.Errorf("expected ErrAlreadyRegistered, got %v", err)
+	}
+
+	for _, tok := range []*softtoken.Token{token, legacy} {
+		var req u2f.PublicKeyCredentialRequestOptions
+		if status, msg := ts.post("alice", "/webauthn/sign/begin", nil, &req); status != http.StatusOK {
+			t.Fatalf("sign begin: %d %s", status, msg)
+		}
+		resp, err := tok.SignWebAuthn(&req, appID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result SignResult
+		if status, msg := ts.post("alice", "/webauthn/sign/finish", resp, &result); status != http.StatusOK {
+			t.Fatalf("sign finish: %d %s", status, msg)
+		}
+		if result.Counter != 1 {
+			t.Errorf("unexpected counter: %d", result.Counter)
+		}
+
+		if status, msg := ts.post("alice", "/webauthn/sign/finish", resp, nil); status != http.StatusBadRequest || msg != "no pending challenge" {
+			t.Errorf("replay: %d %s", status, msg)
+		}
+	}
+	if len(ts.authenticated) != 2 {
+		t.Errorf("Authenticated not called: %v", ts.authenticated)
+	}
+
+	// A signature from another origin is refused.
+	var req u2f.PublicKeyCredentialRequestOptions
+	ts.post("alice", "/webauthn/sign/begin", nil, &req)
+	resp, err := token.SignWebAuthn(&req, "https://evil.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := ts.post("alice", "/webauthn/sign/finish", resp, nil); status != http.StatusUnauthorized {
+		t.Errorf("wrong origin: %d", status)
+	}
+}
+
+type facetResolverFunc func(ctx context.Context, appID string) ([]string, error)
+
+func (f facetResolverFunc) TrustedFacets(ctx context.Context, appID string) ([]string, error) {
+	return f(ctx, appID)
+}
+
+// TestContext checks that the request's context reaches the facet resolver
+// and the event hook.
+func TestContext(t *testing.T) {
+	ts := newTestServer(t)
+	type key struct{}
+	var facetCtx, eventCtx []interface{}
+	ts.handler.Facets = facetResolverFunc(func(ctx context.Context, appID string) ([]string, error) {
+		facetCtx = append(facetCtx, ctx.Value(key{}))
+		return []string{appID}, nil
+	})
+	ts.handler.Config.Events = u2f.ContextEventHookFunc(func(ctx context.Context, e *u2f.Event) {
+		eventCtx = append(eventCtx, ctx.Value(key{}))
+	})
+
+	call := func(path string, body, v interface{}) {
+		buf, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(buf))
+		req = req.WithContext(context.WithValue(req.Context(), key{}, path))
+		req.Header.Set("X-User", "alice")
+		w := httptest.NewRecorder()
+		ts.handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d %s", path, w.Code, w.Body)
+		}
+		if v != nil {
+			if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	token := softtoken.NewTest(t)
+	var opts u2f.PublicKeyCredentialCreationOptions
+	call("/webauthn/register/begin", nil, &opts)
+	regResp, err := token.RegisterWebAuthn(&opts, appID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call("/webauthn/register/finish", regResp, nil)
+
+	var req u2f.PublicKeyCredentialRequestOptions
+	call("/webauthn/sign/begin", nil, &req)
+	signResp, err := token.SignWebAuthn(&req, appID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call("/webauthn/sign/finish", signResp, nil)
+
+	if want := []interface{}{"/webauthn/register/begin", "/webauthn/sign/begin"}; !reflect.DeepEqual(facetCtx, want) {
+		t.Errorf("facet resolver got %v, want %v", facetCtx, want)
+	}
+	if want := []interface{}{"/webauthn/register/finish", "/webauthn/sign/finish"}; !reflect.DeepEqual(eventCtx, want) {
+		t.Errorf("event hook got %v, want %v", eventCtx, want)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ts := newTestServer(t)
+	ts.handler.MaxBodySize = 100
+
+	if status, _ := ts.post("", "/register/begin", nil, nil); status != http.StatusUnauthorized {
+		t.Errorf("unknown user: %d", status)
+	}
+	if status, _ := ts.post("alice", "/unknown", nil, nil); status != http.StatusNotFound {
+		t.Errorf("unknown path: %d", status)
+	}
+	if status, _ := ts.post("alice", "/sign/finish", "{", nil); status != http.StatusBadRequest {
+		t.Errorf("invalid JSON: %d", status)
+	}
+	if status, _ := ts.post("alice", "/sign/finish", `{"keyHandle":"`+strings.Repeat("a", 200)+`"}`, nil); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("large body: %d", status)
+	}
+
+	resp, err := http.Get(ts.server.URL + "/u2f/sign/begin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != http.MethodPost {
+		t.Errorf("GET: %d", resp.StatusCode)
+	}
+
+	ts.handler.Registrations = failingStore{}
+	if status, msg := ts.post("alice", "/register/begin", nil, nil); status != http.StatusInternalServerError || msg != "internal error" {
+		t.Errorf("store error: %d %s", status, msg)
+	}
+}
+
+// failingStore fails every call.
+type failingStore struct {
+	store.RegistrationStore
+}
+
+func (failingStore) List(ctx context.Context, user string) ([]store.Record, error) {
+	return nil, errors.New("database is down")
+}
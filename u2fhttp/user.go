@@ -0,0 +1,24 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2fhttp
+
+import "net/http"
+
+// UserResolver identifies the user making a request, typically from the
+// session established by the first authentication factor.
+type UserResolver interface {
+	// User returns the ID of the user. An error makes the handler respond
+	// with 401 Unauthorized.
+	User(r *http.Request) (string, error)
+}
+
+// UserResolverFunc adapts a function to a UserResolver.
+type UserResolverFunc func(r *http.Request) (string, error)
+
+// User calls f(r).
+func (f UserResolverFunc) User(r *http.Request) (string, error) {
+	return f(r)
+}
@@ -0,0 +1,130 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+/*
+Package u2flib converts registrations to and from the form stored by
+Yubico's u2flib-server PHP library, to migrate services built on it.
+
+u2flib-server stores each registration as a JSON object:
+
+	{
+	  "keyHandle": "<base64url key handle>",
+	  "publicKey": "<base64 uncompressed P-256 point>",
+	  "certificate": "<base64 DER attestation certificate>",
+	  "counter": -1
+	}
+
+where a counter of -1 means the registration was never used to
+authenticate.
+
+Registrations imported from u2flib-server have no Raw data; MarshalBinary
+stores them in its compact encoding.
+*/
+package u2flib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/tstranex/u2f"
+)
+
+// Registration is a registration as stored by u2flib-server.
+type Registration struct {
+	KeyHandle   string `json:"keyHandle"`
+	PublicKey   string `json:"publicKey"`
+	Certificate string `json:"certificate"`
+	Counter     int64  `json:"counter"`
+}
+
+// Import converts a stored registration. It returns the registration and
+// the counter to pass to Authenticate, which is 0 for unused registrations. The public key must be a point on
+// P-256 and the certificate, if any, must parse; known malformed
+// certificates are corrected as by u2f.ParseAttestationCert.
+func Import(r *Registration) (*u2f.Registration, uint32, error) {
+	if r.Counter < -1 || r.Counter > math.MaxUint32 {
+		return nil, 0, fmt.Errorf("u2flib: invalid counter %d", r.Counter)
+	}
+	counter := uint32(0)
+	if r.Counter > 0 {
+		counter = uint32(r.Counter)
+	}
+
+	kh, err := decodeBase64(r.KeyHandle)
+	if err != nil {
+		return nil, 0, fmt.Errorf("u2flib: invalid key handle: %v", err)
+	}
+	if len(kh) == 0 || len(kh) > 255 {
+		return nil, 0, errors.New("u2flib: invalid key handle length")
+	}
+
+	pk, err := decodeBase64(r.PublicKey)
+	if err != nil {
+		return nil, 0, fmt.Errorf("u2flib: invalid public key: %v", err)
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), pk)
+	if x == nil {
+		return nil, 0, errors.New("u2flib: public key is not an uncompressed P-256 point")
+	}
+
+	reg := &u2f.Registration{
+		KeyHandle: kh,
+		PubKey:    ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y},
+	}
+
+	if r.Certificate != "" {
+		der, err := decodeBase64(r.Certificate)
+		if err != nil {
+			return nil, 0, fmt.Errorf("u2flib: invalid certificate: %v", err)
+		}
+		reg.AttestationCert, err = u2f.ParseAttestationCert(der)
+		if err != nil {
+			return nil, 0, fmt.Errorf("u2flib: invalid certificate: %v", err)
+		}
+	}
+
+	return reg, counter, nil
+}
+
+// Export converts a registration and its counter to the form stored by
+// u2flib-server. The certificate is omitted if reg has none.
+//
+// A counter of 0 is written as -1, so that registrations imported unused
+// are exported unused. Like a stored counter of 0 in Authenticate, -1 lets
+// u2flib-server accept any counter from the token.
+func Export(reg *u2f.Registration, counter uint32) (*Registration, error) {
+	if reg.PubKey.Curve != elliptic.P256() || reg.PubKey.X == nil {
+		return nil, errors.New("u2flib: public key is not on P-256")
+	}
+
+	r := &Registration{
+		KeyHandle: base64.RawURLEncoding.EncodeToString(reg.KeyHandle),
+		PublicKey: base64.StdEncoding.EncodeToString(
+			elliptic.Marshal(reg.PubKey.Curve, reg.PubKey.X, reg.PubKey.Y)),
+		Counter: int64(counter),
+	}
+	if counter == 0 {
+		r.Counter = -1
+	}
+	if reg.AttestationCert != nil {
+		r.Certificate = base64.StdEncoding.EncodeToString(reg.AttestationCert.Raw)
+	}
+	return r, nil
+}
+
+// decodeBase64 decodes standard or URL safe base64, with or without
+// padding: u2flib-server uses both.
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	if strings.ContainsAny(s, "+/") {
+		return base64.RawStdEncoding.DecodeString(s)
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
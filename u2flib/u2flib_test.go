@@ -0,0 +1,105 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2flib
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/tstranex/u2f"
+)
+
+// A registration stored by u2flib-server for the token in the u2f package
+// tests.
+const storedJSON = `{"keyHandle":"mZmRK_1ltMrPtNU7qOc5woatIdvXkkNq0wwXEfE3kFHnoITeyPXSO0Y5juzNAiLhEZTqQ40i6uIBqvG4QUnkiw","publicKey":"BMPXsg/ttncZx3uXkCjiqqiGxRybRtxeAcumfSm/ZVY2XtIG00WjTASgB0yseUVcbMmBDP9tFlopdl8fJ3d8CjQ=","certificate":"MIICHDCCAQagAwIBAgIEJNurQDALBgkqhkiG9w0BAQswLjEsMCoGA1UEAxMjWXViaWNvIFUyRiBSb290IENBIFNlcmlhbCA0NTcyMDA2MzEwIBcNMTQwODAxMDAwMDAwWhgPMjA1MDA5MDQwMDAwMDBaMCsxKTAnBgNVBAMMIFl1YmljbyBVMkYgRUUgU2VyaWFsIDEzNTAzMjc3ODg4MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEArCUvjR9R3lBxHeOvsXKTe0qR5+qHm/sOa/r3gwgcMtb1L1pyWp447+HUf61eRuN+srClAF1HLFXuXwJ5DkaNqMSMBAwDgYKKwYBBAGCxAoBAQQAMAsGCSqGSIb3DQEBCwOCAQEAo2OuDpg68wu68SyLLfNaWb8cu0obD8toxIRVhJD2hzRYZbjbAmnDRuVTiEwsVgevDqJ7kKyM8e9DH3KsGJ2yHIJJFL8XiKVRGjPQe0yONGR86fYeFRapqbNukApAIGH2mqRuEsUyuZP5Qj76qkz5o7ZUtN3e8pJKVI/VmZVRDdT39Nmk1SGThzxxybh+hoU+ni2nXo8MbSgwU3TU791eFJb4wzkGEHvWi9Y1DarSw3gR7KPKQ7yTC3NAl972nWiNlFUMTPsYqeJLhqLl2I9JmJmgm85bgQxTbK85Dci93pYN8zDKyrwFIaGDI5V//rylnKkLILENCbUjHFjCfrpngw==","counter":-1}`
+
+const appID = "http://localhost:3483"
+
+const signRespJSON = "{\"keyHandle\":\"mZmRK_1ltMrPtNU7qOc5woatIdvXkkNq0wwXEfE3kFHnoITeyPXSO0Y5juzNAiLhEZTqQ40i6uIBqvG4QUnkiw\",\"clientData\":\"eyJ0eXAiOiJuYXZpZ2F0b3IuaWQuZ2V0QXNzZXJ0aW9uIiwiY2hhbGxlbmdlIjoiUHpONlNHaVVhZXlwRXJFM1NDSGVSbGtSeFZ3ZldsR1ZpMzVnZnE2THNkWSIsIm9yaWdpbiI6Imh0dHA6Ly9sb2NhbGhvc3Q6MzQ4MyIsImNpZF9wdWJrZXkiOiIifQ\",\"signatureData\":\"AQAAAAYwRAIgBuyafOXoc9Q7fARcs2JbCZdtnMzVCyeJC-J-2Im1IBsCIDxkzmvPX9RCY8uts4wM1y4wEX9LmNH2Mz_VFd-JdyGE\"}"
+
+func TestImport(t *testing.T) {
+	var stored Registration
+	if err := json.Unmarshal([]byte(storedJSON), &stored); err != nil {
+		t.Fatal(err)
+	}
+	reg, counter, err := Import(&stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counter != 0 {
+		t.Errorf("unexpected counter: %d", counter)
+	}
+	if reg.AttestationCert.Subject.CommonName != "Yubico U2F EE Serial 13503277888" {
+		t.Errorf("unexpected certificate subject: %s", reg.AttestationCert.Subject)
+	}
+
+	// An unused registration is exported unused.
+	exported, err := Export(reg, counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *exported != stored {
+		t.Errorf("unexpected export of unused registration: %+v", exported)
+	}
+
+	var resp u2f.SignResponse
+	if err := json.Unmarshal([]byte(signRespJSON), &resp); err != nil {
+		t.Fatal(err)
+	}
+	challenge, _ := base64.RawURLEncoding.DecodeString("PzN6SGiUaeypErE3SCHeRlkRxVwfWlGVi35gfq6LsdY")
+	c := u2f.Challenge{
+		Challenge:     challenge,
+		Timestamp:     time.Now(),
+		AppID:         appID,
+		TrustedFacets: []string{appID},
+	}
+	counter, err = reg.Authenticate(resp, c, counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err = Export(reg, counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Counter = 6
+	if *exported != stored {
+		t.Errorf("unexpected export: %+v", exported)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	var stored Registration
+	if err := json.Unmarshal([]byte(storedJSON), &stored); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, modify := range map[string]func(r *Registration){
+		"counter":     func(r *Registration) { r.Counter = -2 },
+		"key handle":  func(r *Registration) { r.KeyHandle = "" },
+		"public key":  func(r *Registration) { r.PublicKey = r.PublicKey[:40] },
+		"off curve":   func(r *Registration) { r.PublicKey = "BA" + r.PublicKey[2:] },
+		"certificate": func(r *Registration) { r.Certificate = r.Certificate[:100] },
+	} {
+		r := stored
+		modify(&r)
+		if _, _, err := Import(&r); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	r := stored
+	r.Certificate = ""
+	reg, _, err := Import(&r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.AttestationCert != nil {
+		t.Errorf("expected no certificate")
+	}
+}
@@ -0,0 +1,115 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+/*
+Package u2fmetrics measures registrations and authentications: it counts
+successes and failures by reason, records verification latency and counts
+counter regressions, which may reveal cloned tokens, by token vendor.
+
+The measurements are taken from the events of u2f.Config.Events and passed to
+a Recorder. Registry is a Recorder that writes the Prometheus text
+exposition format:
+
+	metrics := u2fmetrics.NewRegistry()
+	config := &u2f.Config{Events: u2fmetrics.Hook(metrics, auditLog)}
+	http.Handle("/metrics", metrics)
+*/
+package u2fmetrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tstranex/u2f"
+)
+
+// Failure reasons.
+const (
+	ReasonExpired           = "expired"
+	ReasonUntrustedFacet    = "untrusted_facet"
+	ReasonChallengeMismatch = "challenge_mismatch"
+	ReasonInvalidSignature  = "invalid_signature"
+	ReasonUserNotPresent    = "user_not_present"
+	ReasonCounterRegression = "counter_regression"
+	ReasonAttestation       = "attestation"
+
+	// ReasonCanceled is the reason of ceremonies whose context was done.
+	ReasonCanceled = "canceled"
+
+	// ReasonInvalid is the reason of all other failures, mostly malformed
+	// responses.
+	ReasonInvalid = "invalid"
+)
+
+// UnknownVendor is the vendor of tokens without attestation information.
+const UnknownVendor = "unknown"
+
+// Reason returns the failure reason of an error returned by the
+// registration and authentication functions of package u2f. The error may
+// wrap one of the package's errors.
+func Reason(err error) string {
+	var attErr *u2f.AttestationError
+	switch {
+	case errors.Is(err, u2f.ErrChallengeExpired):
+		return ReasonExpired
+	case errors.Is(err, u2f.ErrUntrustedFacet):
+		return ReasonUntrustedFacet
+	case errors.Is(err, u2f.ErrChallengeMismatch):
+		return ReasonChallengeMismatch
+	case errors.Is(err, u2f.ErrInvalidSignature):
+		return ReasonInvalidSignature
+	case errors.Is(err, u2f.ErrUserNotPresent):
+		return ReasonUserNotPresent
+	case errors.Is(err, u2f.ErrCounterTooLow):
+		return ReasonCounterRegression
+	case errors.As(err, &attErr):
+		return ReasonAttestation
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return ReasonCanceled
+	}
+	return ReasonInvalid
+}
+
+// Recorder receives the measurements. Its methods may be called
+// concurrently.
+type Recorder interface {
+	// Ceremony counts a registration or authentication. The reason is
+	// empty for successes.
+	Ceremony(ceremony u2f.Ceremony, protocol, outcome, reason string)
+
+	// Latency records how long the verification of a response took.
+	Latency(ceremony u2f.Ceremony, protocol string, d time.Duration)
+
+	// CounterRegression counts an authentication rejected because the
+	// token's counter was lower than the stored one. The vendor is the
+	// issuer of the token's attestation certificate, or UnknownVendor.
+	CounterRegression(vendor string)
+}
+
+// Hook returns an EventHook that records the events with r, then passes
+// them to next, if it isn't nil, for example an audit log. The hook is a
+// u2f.ContextEventHook, which passes the context of the ceremony on to next.
+func Hook(r Recorder, next u2f.EventHook) u2f.EventHook {
+	return u2f.ContextEventHookFunc(func(ctx context.Context, e *u2f.Event) {
+		reason := ""
+		if e.Outcome != u2f.OutcomeSuccess {
+			reason = Reason(e.Err)
+		}
+		r.Ceremony(e.Ceremony, e.Protocol, e.Outcome, reason)
+		r.Latency(e.Ceremony, e.Protocol, e.Duration)
+		if reason == ReasonCounterRegression {
+			vendor := e.AttestationIssuer
+			if vendor == "" {
+				vendor = UnknownVendor
+			}
+			r.CounterRegression(vendor)
+		}
+
+		if next != nil {
+			u2f.SendEvent(ctx, next, e)
+		}
+	})
+}
@@ -0,0 +1,190 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2fmetrics
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tstranex/u2f"
+	"github.com/tstranex/u2f/softtoken"
+)
+
+const appID = "https://example.com"
+
+func TestReason(t *testing.T) {
+	for err, want := range map[error]string{
+		u2f.ErrChallengeExpired:                       ReasonExpired,
+		u2f.ErrUntrustedFacet:                         ReasonUntrustedFacet,
+		u2f.ErrChallengeMismatch:                      ReasonChallengeMismatch,
+		u2f.ErrInvalidSignature:                       ReasonInvalidSignature,
+		u2f.ErrUserNotPresent:                         ReasonUserNotPresent,
+		u2f.ErrCounterTooLow:                          ReasonCounterRegression,
+		&u2f.AttestationError{Err: errors.New("x")}:   ReasonAttestation,
+		context.DeadlineExceeded:                      ReasonCanceled,
+		errors.New("u2f: trailing data"):              ReasonInvalid,
+		fmt.Errorf("login: %w", u2f.ErrCounterTooLow): ReasonCounterRegression,
+		fmt.Errorf("login: %w", context.Canceled):     ReasonCanceled,
+	} {
+		if got := Reason(err); got != want {
+			t.Errorf("Reason(%v) = %q, want %q", err, got, want)
+		}
+	}
+}
+
+// recorder records the measurements as strings.
+type recorder struct {
+	ceremonies, regressions []string
+	latencies               int
+}
+
+func (r *recorder) Ceremony(ceremony u2f.Ceremony, protocol, outcome, reason string) {
+	r.ceremonies = append(r.ceremonies, strings.Join([]string{string(ceremony), protocol, outcome, reason}, " "))
+}
+
+func (r *recorder) Latency(ceremony u2f.Ceremony, protocol string, d time.Duration) {
+	r.latencies++
+}
+
+func (r *recorder) CounterRegression(vendor string) {
+	r.regressions = append(r.regressions, vendor)
+}
+
+// TestHook checks the measurements of real ceremonies.
+func TestHook(t *testing.T) {
+	root, err := softtoken.NewAttestation("Soft U2F Root", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := softtoken.New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rec recorder
+	var audited int
+	pool := x509.NewCertPool()
+	pool.AddCert(root.Cert)
+	config := &u2f.Config{
+		RootAttestationCertPool: pool,
+		Events:                  Hook(&rec, u2f.EventHookFunc(func(e *u2f.Event) { audited++ })),
+	}
+
+	register := func(config *u2f.Config) (*u2f.Registration, error) {
+		c, _ := u2f.NewChallenge(appID, []string{appID})
+		resp, err := token.Register(u2f.NewWebRegisterRequest(c, nil), appID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u2f.Register(*resp, *c, config)
+	}
+	sign := func(reg *u2f.Registration, origin string, counter uint32) {
+		c, _ := u2f.NewChallenge(appID, []string{appID})
+		resp, err := token.Sign(c.SignRequest([]u2f.Registration{*reg}), origin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reg.AuthenticateWithConfig(*resp, *c, counter, config)
+	}
+
+	reg, err := register(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign(reg, appID, 0)
+	sign(reg, appID, 10)
+	// A forged response with a low counter is not a counter regression.
+	token.Fault = softtoken.FaultBadSignature
+	sign(reg, appID, 100)
+	token.Fault = softtoken.NoFault
+	sign(reg, "https://evil.example.com", 0)
+	untrusting := *config
+	untrusting.RootAttestationCertPool = x509.NewCertPool()
+	if _, err := register(&untrusting); err == nil {
+		t.Fatal("expected attestation error")
+	}
+
+	want := []string{
+		"register u2f success ",
+		"authenticate u2f success ",
+		"authenticate u2f failure counter_regression",
+		"authenticate u2f failure invalid_signature",
+		"authenticate u2f failure untrusted_facet",
+		"register u2f failure attestation",
+	}
+	if strings.Join(rec.ceremonies, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got ceremonies\n%s\nwant\n%s", strings.Join(rec.ceremonies, "\n"), strings.Join(want, "\n"))
+	}
+	if rec.latencies != len(want) || audited != len(want) {
+		t.Errorf("got %d latencies and %d audited events, want %d", rec.latencies, audited, len(want))
+	}
+	if len(rec.regressions) != 1 || rec.regressions[0] != "CN=Soft U2F Root" {
+		t.Errorf("unexpected regressions: %v", rec.regressions)
+	}
+}
+
+// TestHookContext checks that the context is passed on to the next hook.
+func TestHookContext(t *testing.T) {
+	type key struct{}
+	var got interface{}
+	next := u2f.ContextEventHookFunc(func(ctx context.Context, e *u2f.Event) {
+		got = ctx.Value(key{})
+	})
+	hook := Hook(&recorder{}, next)
+	u2f.SendEvent(context.WithValue(context.Background(), key{}, "t1"), hook, &u2f.Event{Outcome: u2f.OutcomeSuccess})
+	if got != "t1" {
+		t.Errorf("next hook got %v", got)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistryWithBuckets([]float64{0.001, 0.01})
+	r.Ceremony(u2f.CeremonyRegister, u2f.ProtocolWebAuthn, u2f.OutcomeSuccess, "")
+	r.Ceremony(u2f.CeremonyAuthenticate, u2f.ProtocolU2F, u2f.OutcomeFailure, ReasonCounterRegression)
+	r.Ceremony(u2f.CeremonyAuthenticate, u2f.ProtocolU2F, u2f.OutcomeFailure, ReasonCounterRegression)
+	r.Latency(u2f.CeremonyAuthenticate, u2f.ProtocolU2F, 500*time.Microsecond)
+	r.Latency(u2f.CeremonyAuthenticate, u2f.ProtocolU2F, 5*time.Millisecond)
+	r.Latency(u2f.CeremonyAuthenticate, u2f.ProtocolU2F, time.Second)
+	r.CounterRegression(`CN=Vendor "A"`)
+	r.CounterRegression(UnknownVendor)
+
+	want := `# HELP u2f_ceremonies_total Registrations and authentications by outcome and failure reason.
+# TYPE u2f_ceremonies_total counter
+u2f_ceremonies_total{ceremony="authenticate",protocol="u2f",outcome="failure",reason="counter_regression"} 2
+u2f_ceremonies_total{ceremony="register",protocol="webauthn",outcome="success",reason=""} 1
+# HELP u2f_verification_duration_seconds Time taken to verify registration and authentication responses.
+# TYPE u2f_verification_duration_seconds histogram
+u2f_verification_duration_seconds_bucket{ceremony="authenticate",protocol="u2f",le="0.001"} 1
+u2f_verification_duration_seconds_bucket{ceremony="authenticate",protocol="u2f",le="0.01"} 2
+u2f_verification_duration_seconds_bucket{ceremony="authenticate",protocol="u2f",le="+Inf"} 3
+u2f_verification_duration_seconds_sum{ceremony="authenticate",protocol="u2f"} 1.0055
+u2f_verification_duration_seconds_count{ceremony="authenticate",protocol="u2f"} 3
+# HELP u2f_counter_regressions_total Authentications rejected for a counter regression, by token vendor.
+# TYPE u2f_counter_regressions_total counter
+u2f_counter_regressions_total{vendor="CN=Vendor \"A\""} 1
+u2f_counter_regressions_total{vendor="unknown"} 1
+`
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") || w.Body.String() != want {
+		t.Errorf("unexpected response %q: %s", ct, w.Body.String())
+	}
+}
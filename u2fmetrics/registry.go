@@ -0,0 +1,209 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2fmetrics
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tstranex/u2f"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency histogram
+// buckets of NewRegistry. Verifications take around a millisecond.
+var DefaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+type ceremonyKey struct {
+	ceremony u2f.Ceremony
+	protocol string
+	outcome  string
+	reason   string
+}
+
+type latencyKey struct {
+	ceremony u2f.Ceremony
+	protocol string
+}
+
+type histogram struct {
+	// counts holds the number of observations of each bucket, not
+	// cumulative, and of the +Inf bucket last.
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Registry is a Recorder that keeps the measurements in memory and writes
+// them in the Prometheus text exposition format. It serves them over HTTP.
+type Registry struct {
+	buckets []float64
+
+	mu          sync.Mutex
+	ceremonies  map[ceremonyKey]uint64
+	latencies   map[latencyKey]*histogram
+	regressions map[string]uint64
+}
+
+// NewRegistry returns an empty Registry with DefaultBuckets.
+func NewRegistry() *Registry {
+	return NewRegistryWithBuckets(DefaultBuckets)
+}
+
+// NewRegistryWithBuckets returns an empty Registry with the given latency
+// histogram buckets, in seconds and in increasing order.
+func NewRegistryWithBuckets(buckets []float64) *Registry {
+	return &Registry{
+		buckets:     append([]float64(nil), buckets...),
+		ceremonies:  make(map[ceremonyKey]uint64),
+		latencies:   make(map[latencyKey]*histogram),
+		regressions: make(map[string]uint64),
+	}
+}
+
+// Ceremony implements Recorder.
+func (r *Registry) Ceremony(ceremony u2f.Ceremony, protocol, outcome, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ceremonies[ceremonyKey{ceremony, protocol, outcome, reason}]++
+}
+
+// Latency implements Recorder.
+func (r *Registry) Latency(ceremony u2f.Ceremony, protocol string, d time.Duration) {
+	v := d.Seconds()
+	i := sort.SearchFloat64s(r.buckets, v)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := latencyKey{ceremony, protocol}
+	h := r.latencies[k]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(r.buckets)+1)}
+		r.latencies[k] = h
+	}
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// CounterRegression implements Recorder.
+func (r *Registry) CounterRegression(vendor string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.regressions[vendor]++
+}
+
+// WriteText writes the metrics in the text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	r.mu.Lock()
+	ceremonies := make([]ceremonyKey, 0, len(r.ceremonies))
+	for k := range r.ceremonies {
+		ceremonies = append(ceremonies, k)
+	}
+	sort.Slice(ceremonies, func(i, j int) bool {
+		a, b := ceremonies[i], ceremonies[j]
+		if a.ceremony != b.ceremony {
+			return a.ceremony < b.ceremony
+		}
+		if a.protocol != b.protocol {
+			return a.protocol < b.protocol
+		}
+		if a.outcome != b.outcome {
+			return a.outcome < b.outcome
+		}
+		return a.reason < b.reason
+	})
+	header(bw, "u2f_ceremonies_total", "counter", "Registrations and authentications by outcome and failure reason.")
+	for _, k := range ceremonies {
+		sample(bw, "u2f_ceremonies_total", labels("ceremony", string(k.ceremony), "protocol", k.protocol, "outcome", k.outcome, "reason", k.reason), float64(r.ceremonies[k]))
+	}
+
+	latencies := make([]latencyKey, 0, len(r.latencies))
+	for k := range r.latencies {
+		latencies = append(latencies, k)
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		a, b := latencies[i], latencies[j]
+		if a.ceremony != b.ceremony {
+			return a.ceremony < b.ceremony
+		}
+		return a.protocol < b.protocol
+	})
+	header(bw, "u2f_verification_duration_seconds", "histogram", "Time taken to verify registration and authentication responses.")
+	for _, k := range latencies {
+		h := r.latencies[k]
+		var cumulative uint64
+		for i, n := range h.counts {
+			cumulative += n
+			le := "+Inf"
+			if i < len(r.buckets) {
+				le = formatFloat(r.buckets[i])
+			}
+			sample(bw, "u2f_verification_duration_seconds_bucket", labels("ceremony", string(k.ceremony), "protocol", k.protocol, "le", le), float64(cumulative))
+		}
+		l := labels("ceremony", string(k.ceremony), "protocol", k.protocol)
+		sample(bw, "u2f_verification_duration_seconds_sum", l, h.sum)
+		sample(bw, "u2f_verification_duration_seconds_count", l, float64(h.count))
+	}
+
+	vendors := make([]string, 0, len(r.regressions))
+	for v := range r.regressions {
+		vendors = append(vendors, v)
+	}
+	sort.Strings(vendors)
+	header(bw, "u2f_counter_regressions_total", "counter", "Authentications rejected for a counter regression, by token vendor.")
+	for _, v := range vendors {
+		sample(bw, "u2f_counter_regressions_total", labels("vendor", v), float64(r.regressions[v]))
+	}
+	r.mu.Unlock()
+
+	return bw.Flush()
+}
+
+// ServeHTTP writes the metrics in the text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+func header(w *bufio.Writer, name, typ, help string) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func sample(w *bufio.Writer, name, labels string, v float64) {
+	w.WriteString(name + labels + " " + formatFloat(v) + "\n")
+}
+
+// labels formats label name and value pairs.
+func labels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
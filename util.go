@@ -40,12 +40,19 @@ To perform an authentication:
     reg.Counter = new_counter
     // Store updated Registration in the database.
 
+NewChallengeContext, RegisterContext, AuthenticateContext and their WebAuthn
+counterparts take a context.Context. It is passed on to the FacetResolver and
+to the Config's Events hook, for example to carry trace IDs into audit logs,
+and an error is returned if it is done. The other variants, such as
+AuthenticateWithConfig, are thin wrappers that pass the background context.
+
 The FIDO U2F specification can be found here:
 https://fidoalliance.org/specifications/download
 */
 package u2f
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/subtle"
 	"encoding/base64"
@@ -98,28 +105,79 @@ func NewChallenge(appID string, trustedFacets []string) (*Challenge, error) {
 	return &c, nil
 }
 
-func verifyClientData(clientData []byte, challenge Challenge) error {
+// FacetResolver looks up the trusted facets of an AppID, for example by
+// fetching its trusted facet list.
+type FacetResolver interface {
+	TrustedFacets(ctx context.Context, appID string) ([]string, error)
+}
+
+// StaticFacets is a FacetResolver that returns the same facets for every
+// AppID.
+type StaticFacets []string
+
+// TrustedFacets implements FacetResolver.
+func (f StaticFacets) TrustedFacets(ctx context.Context, appID string) ([]string, error) {
+	return f, nil
+}
+
+// NewChallengeContext generates a challenge for the given application, with
+// the trusted facets that facets returns for it. The context is passed to
+// facets, and an error is returned if it is done. If facets is nil, the AppID
+// is the only trusted facet.
+func NewChallengeContext(ctx context.Context, appID string, facets FacetResolver) (*Challenge, error) {
+	if facets == nil {
+		facets = StaticFacets{appID}
+	}
+	trustedFacets, err := facets.TrustedFacets(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return NewChallenge(appID, trustedFacets)
+}
+
+// VerifyClientData checks the origin and challenge of the client data of a
+// RegisterResponse or SignResponse, as Register and Authenticate do. It
+// returns ErrUntrustedFacet or ErrChallengeMismatch if they don't match the
+// challenge. The challenge's expiry is not checked.
+func VerifyClientData(clientData []byte, challenge Challenge) error {
 	var cd ClientData
 	if err := json.Unmarshal(clientData, &cd); err != nil {
 		return err
 	}
+	return verifyOriginAndChallenge(cd.Origin, cd.Challenge, challenge)
+}
 
-	foundFacetID := false
+// verifyOriginAndChallenge checks the origin and challenge reported by the
+// client, which are common to U2F and WebAuthn client data.
+func verifyOriginAndChallenge(origin, clientChallenge string, challenge Challenge) error {
+	if err := VerifyOrigin(origin, challenge); err != nil {
+		return err
+	}
+	return VerifyChallenge(clientChallenge, challenge)
+}
+
+// VerifyOrigin checks that the origin reported by the client is one of the
+// challenge's trusted facets. It returns ErrUntrustedFacet if it isn't.
+func VerifyOrigin(origin string, challenge Challenge) error {
 	for _, facetID := range challenge.TrustedFacets {
-		if facetID == cd.Origin {
-			foundFacetID = true
-			break
+		if facetID == origin {
+			return nil
 		}
 	}
-	if !foundFacetID {
-		return errors.New("u2f: untrusted facet id")
-	}
+	return ErrUntrustedFacet
+}
 
+// VerifyChallenge checks the base64url encoded challenge reported by the
+// client against the challenge. It returns ErrChallengeMismatch if they
+// differ.
+func VerifyChallenge(clientChallenge string, challenge Challenge) error {
 	c := encodeBase64(challenge.Challenge)
-	if len(c) != len(cd.Challenge) ||
-		subtle.ConstantTimeCompare([]byte(c), []byte(cd.Challenge)) != 1 {
-		return errors.New("u2f: challenge does not match")
+	if len(c) != len(clientChallenge) ||
+		subtle.ConstantTimeCompare([]byte(c), []byte(clientChallenge)) != 1 {
+		return ErrChallengeMismatch
 	}
-
 	return nil
 }
@@ -0,0 +1,194 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2f
+
+import (
+	"errors"
+	"net/url"
+	"time"
+)
+
+const publicKeyCredentialType = "public-key"
+
+// coseAlgES256 is the COSE algorithm identifier for ECDSA with SHA-256,
+// the only signature algorithm supported by U2F tokens.
+const coseAlgES256 = -7
+
+// PublicKeyCredentialRpEntity as defined by Web Authentication Level 2.
+type PublicKeyCredentialRpEntity struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+// PublicKeyCredentialUserEntity as defined by Web Authentication Level 2.
+// ID is the base64url encoded user handle.
+type PublicKeyCredentialUserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// PublicKeyCredentialParameters as defined by Web Authentication Level 2.
+type PublicKeyCredentialParameters struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+// PublicKeyCredentialDescriptor as defined by Web Authentication Level 2.
+// ID is the base64url encoded credential ID, which for U2F tokens is the
+// key handle.
+type PublicKeyCredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// AuthenticatorSelectionCriteria as defined by Web Authentication Level 2.
+type AuthenticatorSelectionCriteria struct {
+	ResidentKey      string `json:"residentKey,omitempty"`
+	UserVerification string `json:"userVerification,omitempty"`
+}
+
+// AuthenticationExtensionsClientInputs contains the WebAuthn extensions
+// needed to use credentials created with the U2F Javascript API.
+type AuthenticationExtensionsClientInputs struct {
+	AppID        string `json:"appid,omitempty"`
+	AppIDExclude string `json:"appidExclude,omitempty"`
+}
+
+// PublicKeyCredentialCreationOptions contains the parameters needed for
+// navigator.credentials.create() as defined by Web Authentication Level 2.
+// The JSON encoding matches PublicKeyCredentialCreationOptionsJSON, which
+// browsers accept through PublicKeyCredential.parseCreationOptionsFromJSON().
+type PublicKeyCredentialCreationOptions struct {
+	RP                     PublicKeyCredentialRpEntity           `json:"rp"`
+	User                   PublicKeyCredentialUserEntity         `json:"user"`
+	Challenge              string                                `json:"challenge"`
+	PubKeyCredParams       []PublicKeyCredentialParameters       `json:"pubKeyCredParams"`
+	Timeout                int64                                 `json:"timeout,omitempty"`
+	ExcludeCredentials     []PublicKeyCredentialDescriptor       `json:"excludeCredentials"`
+	AuthenticatorSelection *AuthenticatorSelectionCriteria       `json:"authenticatorSelection,omitempty"`
+	Attestation            string                                `json:"attestation,omitempty"`
+	Extensions             *AuthenticationExtensionsClientInputs `json:"extensions,omitempty"`
+}
+
+// PublicKeyCredentialRequestOptions contains the parameters needed for
+// navigator.credentials.get() as defined by Web Authentication Level 2.
+// The JSON encoding matches PublicKeyCredentialRequestOptionsJSON, which
+// browsers accept through PublicKeyCredential.parseRequestOptionsFromJSON().
+type PublicKeyCredentialRequestOptions struct {
+	Challenge        string                                `json:"challenge"`
+	Timeout          int64                                 `json:"timeout,omitempty"`
+	RPID             string                                `json:"rpId,omitempty"`
+	AllowCredentials []PublicKeyCredentialDescriptor       `json:"allowCredentials"`
+	UserVerification string                                `json:"userVerification,omitempty"`
+	Extensions       *AuthenticationExtensionsClientInputs `json:"extensions,omitempty"`
+}
+
+// rpIDFromAppID derives the WebAuthn relying party ID from a U2F AppID,
+// which must be a URL.
+func rpIDFromAppID(appID string) (string, error) {
+	u, err := url.Parse(appID)
+	if err != nil {
+		return "", err
+	}
+	if u.Hostname() == "" {
+		return "", errors.New("u2f: app id is not a url")
+	}
+	return u.Hostname(), nil
+}
+
+// timeoutMillis returns the remaining lifetime of the challenge in
+// milliseconds, at least 1 since a zero timeout is omitted and means the
+// browser's default. It returns ErrChallengeExpired if the challenge has
+// expired.
+func (c *Challenge) timeoutMillis() (int64, error) {
+	remaining := timeout - time.Now().Sub(c.Timestamp)
+	if remaining <= 0 {
+		return 0, ErrChallengeExpired
+	}
+	if remaining < time.Millisecond {
+		return 1, nil
+	}
+	return int64(remaining / time.Millisecond), nil
+}
+
+func getCredentialDescriptor(r Registration) PublicKeyCredentialDescriptor {
+	return PublicKeyCredentialDescriptor{
+		Type: publicKeyCredentialType,
+		ID:   encodeBase64(r.KeyHandle),
+	}
+}
+
+// NewWebAuthnCreationOptions creates WebAuthn options to enrol a new token.
+// regs is the list of the user's existing registrations, which the browser
+// will refuse to register again. The relying party ID is the host of the
+// challenge's AppID, and the appidExclude extension is set so that tokens
+// registered through the U2F Javascript API are also excluded. An error is
+// returned if the challenge has expired.
+func NewWebAuthnCreationOptions(c *Challenge, user PublicKeyCredentialUserEntity, regs []Registration) (*PublicKeyCredentialCreationOptions, error) {
+	rpID, err := rpIDFromAppID(c.AppID)
+	if err != nil {
+		return nil, err
+	}
+	timeoutMS, err := c.timeoutMillis()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := PublicKeyCredentialCreationOptions{
+		RP:        PublicKeyCredentialRpEntity{ID: rpID, Name: rpID},
+		User:      user,
+		Challenge: encodeBase64(c.Challenge),
+		PubKeyCredParams: []PublicKeyCredentialParameters{
+			{Type: publicKeyCredentialType, Alg: coseAlgES256},
+		},
+		Timeout:            timeoutMS,
+		ExcludeCredentials: []PublicKeyCredentialDescriptor{},
+		AuthenticatorSelection: &AuthenticatorSelectionCriteria{
+			ResidentKey:      "discouraged",
+			UserVerification: "discouraged",
+		},
+		Attestation: "direct",
+		Extensions:  &AuthenticationExtensionsClientInputs{AppIDExclude: c.AppID},
+	}
+
+	for _, r := range uniqueRegistrations(regs) {
+		opts.ExcludeCredentials = append(opts.ExcludeCredentials, getCredentialDescriptor(r))
+	}
+
+	return &opts, nil
+}
+
+// WebAuthnRequestOptions creates WebAuthn options to initiate an
+// authentication. The appid extension is set so that tokens registered
+// through the U2F Javascript API can be used. An error is returned if the
+// challenge has expired.
+func (c *Challenge) WebAuthnRequestOptions(regs []Registration) (*PublicKeyCredentialRequestOptions, error) {
+	rpID, err := rpIDFromAppID(c.AppID)
+	if err != nil {
+		return nil, err
+	}
+	timeoutMS, err := c.timeoutMillis()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := PublicKeyCredentialRequestOptions{
+		Challenge:        encodeBase64(c.Challenge),
+		Timeout:          timeoutMS,
+		RPID:             rpID,
+		AllowCredentials: []PublicKeyCredentialDescriptor{},
+		UserVerification: "discouraged",
+		Extensions:       &AuthenticationExtensionsClientInputs{AppID: c.AppID},
+	}
+
+	for _, r := range uniqueRegistrations(regs) {
+		opts.AllowCredentials = append(opts.AllowCredentials, getCredentialDescriptor(r))
+	}
+
+	return &opts, nil
+}
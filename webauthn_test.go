@@ -0,0 +1,130 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2f
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestWebAuthnCreationOptions(t *testing.T) {
+	regResp, _ := hex.DecodeString(testRegRespHex)
+	reg, _, err := parseRegistration(regResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewChallenge("https://example.com:8443", []string{"https://example.com:8443"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Timestamp = time.Now().Add(-time.Minute)
+
+	user := PublicKeyCredentialUserEntity{ID: "dXNlcg", Name: "user", DisplayName: "User"}
+	opts, err := NewWebAuthnCreationOptions(c, user, []Registration{*reg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if opts.RP.ID != "example.com" {
+		t.Errorf("unexpected rp id: %s", opts.RP.ID)
+	}
+	if opts.Challenge != encodeBase64(c.Challenge) {
+		t.Errorf("unexpected challenge: %s", opts.Challenge)
+	}
+	if opts.Timeout <= 0 || opts.Timeout > int64((timeout-time.Minute)/time.Millisecond) {
+		t.Errorf("unexpected timeout: %d", opts.Timeout)
+	}
+	if len(opts.ExcludeCredentials) != 1 ||
+		opts.ExcludeCredentials[0].ID != encodeBase64(reg.KeyHandle) {
+		t.Errorf("unexpected excludeCredentials: %+v", opts.ExcludeCredentials)
+	}
+	if opts.Extensions.AppIDExclude != c.AppID {
+		t.Errorf("unexpected appidExclude: %s", opts.Extensions.AppIDExclude)
+	}
+
+	buf, err := json.Marshal(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf, &m); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"rp", "user", "challenge", "pubKeyCredParams", "timeout", "excludeCredentials", "extensions"} {
+		if _, ok := m[k]; !ok {
+			t.Errorf("missing %q in %s", k, buf)
+		}
+	}
+}
+
+func TestWebAuthnRequestOptions(t *testing.T) {
+	regResp, _ := hex.DecodeString(testRegRespHex)
+	reg, _, err := parseRegistration(regResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewChallenge("https://example.com", []string{"https://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := c.WebAuthnRequestOptions([]Registration{*reg})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if opts.RPID != "example.com" {
+		t.Errorf("unexpected rp id: %s", opts.RPID)
+	}
+	if len(opts.AllowCredentials) != 1 ||
+		opts.AllowCredentials[0].ID != encodeBase64(reg.KeyHandle) ||
+		opts.AllowCredentials[0].Type != "public-key" {
+		t.Errorf("unexpected allowCredentials: %+v", opts.AllowCredentials)
+	}
+	if opts.Extensions.AppID != c.AppID {
+		t.Errorf("unexpected appid: %s", opts.Extensions.AppID)
+	}
+
+	opts, err = c.WebAuthnRequestOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.AllowCredentials == nil {
+		t.Errorf("allowCredentials should encode as an empty list")
+	}
+}
+
+func TestWebAuthnOptionsInvalidAppID(t *testing.T) {
+	c := &Challenge{AppID: "not a url"}
+	if _, err := c.WebAuthnRequestOptions(nil); err == nil {
+		t.Errorf("expected error for non-url app id")
+	}
+}
+
+func TestWebAuthnOptionsExpiredChallenge(t *testing.T) {
+	c, _ := NewChallenge("https://example.com", []string{"https://example.com"})
+	c.Timestamp = time.Now().Add(-time.Hour)
+	if _, err := NewWebAuthnCreationOptions(c, PublicKeyCredentialUserEntity{}, nil); err != ErrChallengeExpired {
+		t.Errorf("creation options: expected ErrChallengeExpired, got %v", err)
+	}
+	if _, err := c.WebAuthnRequestOptions(nil); err != ErrChallengeExpired {
+		t.Errorf("request options: expected ErrChallengeExpired, got %v", err)
+	}
+
+	// Nearly expired challenges still get a timeout.
+	c.Timestamp = time.Now().Add(-timeout + time.Second)
+	opts, err := c.WebAuthnRequestOptions(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Timeout <= 0 || opts.Timeout > 1000 {
+		t.Errorf("unexpected timeout %d", opts.Timeout)
+	}
+}
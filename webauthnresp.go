@@ -0,0 +1,445 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2f
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/tstranex/u2f/internal/cbor"
+)
+
+// AuthenticatorAttestationResponse as defined by Web Authentication Level 2.
+// The binary fields are base64url encoded.
+type AuthenticatorAttestationResponse struct {
+	ClientDataJSON    string   `json:"clientDataJSON"`
+	AttestationObject string   `json:"attestationObject"`
+	Transports        []string `json:"transports,omitempty"`
+}
+
+// AuthenticatorAssertionResponse as defined by Web Authentication Level 2.
+// The binary fields are base64url encoded.
+type AuthenticatorAssertionResponse struct {
+	ClientDataJSON    string `json:"clientDataJSON"`
+	AuthenticatorData string `json:"authenticatorData"`
+	Signature         string `json:"signature"`
+	UserHandle        string `json:"userHandle,omitempty"`
+}
+
+// AuthenticationExtensionsClientOutputs contains the results of the
+// extensions in AuthenticationExtensionsClientInputs. AppID reports that
+// the credential was used with the appid extension's AppID.
+type AuthenticationExtensionsClientOutputs struct {
+	AppID bool `json:"appid,omitempty"`
+}
+
+// WebAuthnRegistrationResponse is the credential returned by
+// navigator.credentials.create(). The JSON encoding matches
+// RegistrationResponseJSON, as returned by PublicKeyCredential.toJSON().
+type WebAuthnRegistrationResponse struct {
+	ID                     string                                `json:"id"`
+	RawID                  string                                `json:"rawId"`
+	Type                   string                                `json:"type"`
+	Response               AuthenticatorAttestationResponse      `json:"response"`
+	ClientExtensionResults AuthenticationExtensionsClientOutputs `json:"clientExtensionResults"`
+}
+
+// WebAuthnAuthenticationResponse is the credential returned by
+// navigator.credentials.get(). The JSON encoding matches
+// AuthenticationResponseJSON, as returned by PublicKeyCredential.toJSON().
+type WebAuthnAuthenticationResponse struct {
+	ID                     string                                `json:"id"`
+	RawID                  string                                `json:"rawId"`
+	Type                   string                                `json:"type"`
+	Response               AuthenticatorAssertionResponse        `json:"response"`
+	ClientExtensionResults AuthenticationExtensionsClientOutputs `json:"clientExtensionResults"`
+}
+
+// KeyHandle returns the base64url encoded key handle of the credential, as
+// passed to FindRegistration.
+func (resp *WebAuthnAuthenticationResponse) KeyHandle() string {
+	if resp.RawID != "" {
+		return resp.RawID
+	}
+	return resp.ID
+}
+
+// collectedClientData is the client data of WebAuthn ceremonies.
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func verifyCollectedClientData(clientData []byte, typ string, c Challenge) error {
+	var cd collectedClientData
+	if err := json.Unmarshal(clientData, &cd); err != nil {
+		return err
+	}
+	if cd.Type != typ {
+		return errors.New("u2f: wrong client data type")
+	}
+	if cd.CrossOrigin {
+		return errors.New("u2f: cross-origin requests are not supported")
+	}
+	return verifyOriginAndChallenge(cd.Origin, cd.Challenge, c)
+}
+
+// Flags of authenticator data.
+const (
+	authDataUserPresent        = 0x01
+	authDataAttestedCredential = 0x40
+	authDataExtensions         = 0x80
+)
+
+// authenticatorData as defined by Web Authentication Level 2.
+type authenticatorData struct {
+	rpIDHash [32]byte
+	flags    byte
+	counter  uint32
+
+	// credentialID and pubKey are set for registrations.
+	credentialID []byte
+	pubKey       *ecdsa.PublicKey
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 32+1+4 {
+		return nil, errors.New("u2f: authenticator data is too short")
+	}
+	var ad authenticatorData
+	copy(ad.rpIDHash[:], data)
+	ad.flags = data[32]
+	ad.counter = binary.BigEndian.Uint32(data[33:])
+	rest := data[37:]
+
+	if ad.flags&authDataAttestedCredential != 0 {
+		// AAGUID, credential ID length and credential ID.
+		if len(rest) < 16+2 {
+			return nil, errors.New("u2f: attested credential data is too short")
+		}
+		n := int(binary.BigEndian.Uint16(rest[16:]))
+		rest = rest[18:]
+		if len(rest) < n {
+			return nil, errors.New("u2f: attested credential data is too short")
+		}
+		ad.credentialID = rest[:n]
+
+		var err error
+		ad.pubKey, rest, err = parseCOSEKeyPrefix(rest[n:])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if ad.flags&authDataExtensions != 0 {
+		var err error
+		if _, rest, err = cbor.UnmarshalFirst(rest); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(rest) != 0 {
+		return nil, errors.New("u2f: trailing data after authenticator data")
+	}
+	return &ad, nil
+}
+
+// RegisterWebAuthn validates the response to options created with
+// NewWebAuthnCreationOptions to enrol a new token, as Register does for the
+// U2F Javascript API. The "fido-u2f" and "packed" attestation formats are
+// supported, as well as "none" if config.SkipAttestationVerify is set.
+//
+// The returned Registration can be used with both Authenticate and
+// AuthenticateWebAuthn. Its Raw data is the compact encoding.
+func RegisterWebAuthn(resp WebAuthnRegistrationResponse, c Challenge, config *Config) (*Registration, error) {
+	return RegisterWebAuthnContext(context.Background(), resp, c, config)
+}
+
+// RegisterWebAuthnContext is RegisterWebAuthn with a context, which is passed
+// to the Events hook. An error is returned if the context is done.
+func RegisterWebAuthnContext(ctx context.Context, resp WebAuthnRegistrationResponse, c Challenge, config *Config) (*Registration, error) {
+	if config == nil {
+		config = &Config{}
+	}
+
+	e := config.newEvent(ctx, CeremonyRegister, ProtocolWebAuthn, c)
+	var reg *Registration
+	err := ctx.Err()
+	if err == nil {
+		reg, err = registerWebAuthn(resp, c, config)
+	}
+	if e != nil {
+		e.Origin = clientDataOrigin(resp.Response.ClientDataJSON)
+		config.emit(ctx, e, reg, err)
+	}
+	return reg, err
+}
+
+func registerWebAuthn(resp WebAuthnRegistrationResponse, c Challenge, config *Config) (*Registration, error) {
+	if time.Now().Sub(c.Timestamp) > timeout {
+		return nil, ErrChallengeExpired
+	}
+	if resp.Type != publicKeyCredentialType {
+		return nil, errors.New("u2f: wrong credential type")
+	}
+
+	clientData, err := decodeBase64(resp.Response.ClientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyCollectedClientData(clientData, "webauthn.create", c); err != nil {
+		return nil, err
+	}
+
+	attObjData, err := decodeBase64(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, err
+	}
+	v, err := cbor.Unmarshal(attObjData)
+	if err != nil {
+		return nil, err
+	}
+	attObj, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("u2f: attestation object is not a map")
+	}
+	format, _ := attObj["fmt"].(string)
+	attStmt, _ := attObj["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := attObj["authData"].([]byte)
+	if attStmt == nil || rawAuthData == nil {
+		return nil, errors.New("u2f: invalid attestation object")
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	rpID, err := rpIDFromAppID(c.AppID)
+	if err != nil {
+		return nil, err
+	}
+	if authData.rpIDHash != sha256.Sum256([]byte(rpID)) {
+		return nil, errors.New("u2f: relying party id does not match")
+	}
+	if authData.flags&authDataUserPresent == 0 {
+		return nil, ErrUserNotPresent
+	}
+	if authData.pubKey == nil {
+		return nil, errors.New("u2f: no attested credential data")
+	}
+	if len(authData.credentialID) == 0 || len(authData.credentialID) > 255 {
+		return nil, errors.New("u2f: invalid credential id length")
+	}
+	if resp.RawID != "" && resp.RawID != encodeBase64(authData.credentialID) {
+		return nil, errors.New("u2f: credential id does not match")
+	}
+
+	reg := &Registration{
+		KeyHandle: append([]byte(nil), authData.credentialID...),
+		PubKey:    *authData.pubKey,
+	}
+	clientDataHash := sha256.Sum256(clientData)
+	reg.AttestationCert, err = verifyAttestationStatement(format, attStmt, rawAuthData, authData, clientDataHash)
+	if err == ErrInvalidSignature {
+		return nil, err
+	} else if err != nil {
+		return nil, &AttestationError{err}
+	}
+
+	if reg.AttestationCert == nil {
+		if !config.SkipAttestationVerify {
+			return nil, &AttestationError{errors.New("u2f: no attestation certificate")}
+		}
+	} else if err := verifyAttestationCert(*reg, config); err != nil {
+		return nil, err
+	}
+
+	if config.StripAttestationCert && reg.AttestationCert != nil {
+		if err := reg.stripAttestationCert(!config.SkipAttestationVerify); err != nil {
+			return nil, err
+		}
+		return reg, nil
+	}
+	if reg.Raw, err = reg.MarshalBinary(); err != nil {
+		return nil, err
+	}
+	return reg, nil
+}
+
+// verifyAttestationStatement verifies the attestation signature and returns
+// the attestation certificate, or nil for self and no attestation. Invalid
+// signatures are reported as ErrInvalidSignature.
+func verifyAttestationStatement(format string, attStmt map[interface{}]interface{}, rawAuthData []byte, authData *authenticatorData, clientDataHash [32]byte) (*x509.Certificate, error) {
+	sig, _ := attStmt["sig"].([]byte)
+	var cert *x509.Certificate
+	if x5c, ok := attStmt["x5c"].([]interface{}); ok {
+		// Intermediate certificates, if any, are ignored.
+		if len(x5c) == 0 {
+			return nil, errors.New("u2f: invalid attestation certificates")
+		}
+		der, ok := x5c[0].([]byte)
+		if !ok {
+			return nil, errors.New("u2f: invalid attestation certificates")
+		}
+		var err error
+		if cert, err = ParseAttestationCert(der); err != nil {
+			return nil, err
+		}
+	}
+
+	switch format {
+	case "fido-u2f":
+		// The signature of a U2F registration response, with the
+		// relying party ID hash as application parameter.
+		if cert == nil || sig == nil {
+			return nil, errors.New("u2f: invalid fido-u2f attestation statement")
+		}
+		buf := []byte{0}
+		buf = append(buf, authData.rpIDHash[:]...)
+		buf = append(buf, clientDataHash[:]...)
+		buf = append(buf, authData.credentialID...)
+		buf = append(buf, elliptic.Marshal(authData.pubKey.Curve, authData.pubKey.X, authData.pubKey.Y)...)
+		if err := checkAttestationSignature(cert, buf, sig); err != nil {
+			return nil, err
+		}
+		return cert, nil
+
+	case "packed":
+		if alg, _ := attStmt["alg"].(int64); alg != coseAlgES256 || sig == nil {
+			return nil, errors.New("u2f: invalid packed attestation statement")
+		}
+		signed := append(append([]byte(nil), rawAuthData...), clientDataHash[:]...)
+		if cert == nil {
+			// Self attestation, signed by the credential key.
+			hash := sha256.Sum256(signed)
+			if !ecdsa.VerifyASN1(authData.pubKey, hash[:], sig) {
+				return nil, ErrInvalidSignature
+			}
+			return nil, nil
+		}
+		if err := checkAttestationSignature(cert, signed, sig); err != nil {
+			return nil, err
+		}
+		return cert, nil
+
+	case "none":
+		if len(attStmt) != 0 {
+			return nil, errors.New("u2f: invalid none attestation statement")
+		}
+		return nil, nil
+	}
+	return nil, errors.New("u2f: unsupported attestation format " + format)
+}
+
+// AuthenticateWebAuthn validates the response to options created with
+// Challenge.WebAuthnRequestOptions, as Authenticate does for the U2F
+// Javascript API. Credentials registered with either API are accepted: the
+// relying party ID hash may match the relying party ID or, through the appid
+// extension, the AppID.
+//
+// The counter should be the stored counter of the registration. The new
+// counter is returned, which the caller should store.
+func (reg *Registration) AuthenticateWebAuthn(resp WebAuthnAuthenticationResponse, c Challenge, counter uint32) (newCounter uint32, err error) {
+	return reg.AuthenticateWebAuthnContext(context.Background(), resp, c, counter, nil)
+}
+
+// AuthenticateWebAuthnWithConfig calls AuthenticateWebAuthnContext with the
+// background context.
+func (reg *Registration) AuthenticateWebAuthnWithConfig(resp WebAuthnAuthenticationResponse, c Challenge, counter uint32, config *Config) (newCounter uint32, err error) {
+	return reg.AuthenticateWebAuthnContext(context.Background(), resp, c, counter, config)
+}
+
+// AuthenticateWebAuthnContext is AuthenticateWebAuthn with a context and a
+// Config, which may be nil. The config's Events hook, if any, receives the
+// outcome and the context. An error is returned if the context is done.
+func (reg *Registration) AuthenticateWebAuthnContext(ctx context.Context, resp WebAuthnAuthenticationResponse, c Challenge, counter uint32, config *Config) (newCounter uint32, err error) {
+	e := config.newEvent(ctx, CeremonyAuthenticate, ProtocolWebAuthn, c)
+	if err = ctx.Err(); err == nil {
+		newCounter, err = reg.authenticateWebAuthn(resp, c, counter)
+	}
+	if e != nil {
+		e.Origin = clientDataOrigin(resp.Response.ClientDataJSON)
+		e.CounterBefore = counter
+		e.CounterAfter = newCounter
+		config.emit(ctx, e, reg, err)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return newCounter, nil
+}
+
+// authenticateWebAuthn returns the token's counter if the response's
+// signature verified, even if the response fails to validate otherwise, and
+// zero if it didn't.
+func (reg *Registration) authenticateWebAuthn(resp WebAuthnAuthenticationResponse, c Challenge, counter uint32) (uint32, error) {
+	if time.Now().Sub(c.Timestamp) > timeout {
+		return 0, ErrChallengeExpired
+	}
+	if resp.Type != publicKeyCredentialType {
+		return 0, errors.New("u2f: wrong credential type")
+	}
+	if resp.KeyHandle() != encodeBase64(reg.KeyHandle) {
+		return 0, errors.New("u2f: wrong key handle")
+	}
+
+	clientData, err := decodeBase64(resp.Response.ClientDataJSON)
+	if err != nil {
+		return 0, err
+	}
+	rawAuthData, err := decodeBase64(resp.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+	sig, err := decodeBase64(resp.Response.Signature)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := verifyCollectedClientData(clientData, "webauthn.get", c); err != nil {
+		return 0, err
+	}
+
+	authData, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	rpID, err := rpIDFromAppID(c.AppID)
+	if err != nil {
+		return 0, err
+	}
+	if authData.rpIDHash != sha256.Sum256([]byte(rpID)) &&
+		authData.rpIDHash != sha256.Sum256([]byte(c.AppID)) {
+		return 0, errors.New("u2f: relying party id does not match")
+	}
+
+	clientDataHash := sha256.Sum256(clientData)
+	hash := sha256.Sum256(append(append([]byte(nil), rawAuthData...), clientDataHash[:]...))
+	if !ecdsa.VerifyASN1(&reg.PubKey, hash[:], sig) {
+		return 0, ErrInvalidSignature
+	}
+
+	if authData.flags&authDataUserPresent == 0 {
+		return authData.counter, ErrUserNotPresent
+	}
+
+	// The counter is checked after the signature, so that forged responses
+	// can't be mistaken for cloned tokens.
+	if authData.counter < counter {
+		return authData.counter, ErrCounterTooLow
+	}
+
+	return authData.counter, nil
+}
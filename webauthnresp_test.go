@@ -0,0 +1,250 @@
+// Go FIDO U2F Library
+// Copyright 2015 The Go FIDO U2F Library Authors. All rights reserved.
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package u2f
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+
+	"github.com/tstranex/u2f/internal/cbor"
+)
+
+// testCredential builds the responses of a WebAuthn authenticator. The
+// fido-u2f format and the appid extension are tested with package softtoken.
+type testCredential struct {
+	t       *testing.T
+	key     *ecdsa.PrivateKey
+	kh      []byte
+	rpID    string
+	origin  string
+	typ     string
+	flags   byte
+	counter uint32
+}
+
+func newTestCredential(t *testing.T) *testCredential {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCredential{t: t, key: key, kh: []byte("credential id"), rpID: "example.com", origin: "https://example.com", flags: authDataUserPresent}
+}
+
+func (tc *testCredential) clientData(typ string, c *Challenge) []byte {
+	if tc.typ != "" {
+		typ = tc.typ
+	}
+	data, _ := json.Marshal(collectedClientData{Type: typ, Challenge: encodeBase64(c.Challenge), Origin: tc.origin})
+	return data
+}
+
+func (tc *testCredential) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(tc.rpID))
+	buf := append([]byte(nil), rpIDHash[:]...)
+	flags := tc.flags
+	if attested {
+		flags |= authDataAttestedCredential
+	}
+	buf = append(buf, flags, byte(tc.counter>>24), byte(tc.counter>>16), byte(tc.counter>>8), byte(tc.counter))
+	if attested {
+		coseKey, err := MarshalCOSEKey(&tc.key.PublicKey)
+		if err != nil {
+			tc.t.Fatal(err)
+		}
+		buf = append(buf, make([]byte, 16)...)
+		buf = append(buf, byte(len(tc.kh)>>8), byte(len(tc.kh)))
+		buf = append(buf, tc.kh...)
+		buf = append(buf, coseKey...)
+	}
+	return buf
+}
+
+func (tc *testCredential) sign(authData, clientData []byte) []byte {
+	clientDataHash := sha256.Sum256(clientData)
+	hash := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, tc.key, hash[:])
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	return sig
+}
+
+// create returns a registration response with "packed" self attestation, or
+// "none" attestation.
+func (tc *testCredential) create(c *Challenge, format string) WebAuthnRegistrationResponse {
+	clientData := tc.clientData("webauthn.create", c)
+	authData := tc.authData(true)
+	attStmt := map[interface{}]interface{}{}
+	if format == "packed" {
+		attStmt["alg"] = coseAlgES256
+		attStmt["sig"] = tc.sign(authData, clientData)
+	}
+	attObj, err := cbor.Marshal(map[interface{}]interface{}{
+		"fmt":      format,
+		"authData": authData,
+		"attStmt":  attStmt,
+	})
+	if err != nil {
+		tc.t.Fatal(err)
+	}
+	return WebAuthnRegistrationResponse{
+		ID:    encodeBase64(tc.kh),
+		RawID: encodeBase64(tc.kh),
+		Type:  publicKeyCredentialType,
+		Response: AuthenticatorAttestationResponse{
+			ClientDataJSON:    encodeBase64(clientData),
+			AttestationObject: encodeBase64(attObj),
+		},
+	}
+}
+
+func (tc *testCredential) get(c *Challenge) WebAuthnAuthenticationResponse {
+	clientData := tc.clientData("webauthn.get", c)
+	authData := tc.authData(false)
+	return WebAuthnAuthenticationResponse{
+		ID:    encodeBase64(tc.kh),
+		RawID: encodeBase64(tc.kh),
+		Type:  publicKeyCredentialType,
+		Response: AuthenticatorAssertionResponse{
+			ClientDataJSON:    encodeBase64(clientData),
+			AuthenticatorData: encodeBase64(authData),
+			Signature:         encodeBase64(tc.sign(authData, clientData)),
+		},
+	}
+}
+
+func TestRegisterWebAuthn(t *testing.T) {
+	skip := &Config{SkipAttestationVerify: true}
+	for _, format := range []string{"packed", "none"} {
+		tc := newTestCredential(t)
+		c, _ := NewChallenge("https://example.com", []string{"https://example.com"})
+		resp := tc.create(c, format)
+
+		if _, err := RegisterWebAuthn(resp, *c, nil); err == nil {
+			t.Errorf("%s: expected error without attestation certificate", format)
+		}
+		reg, err := RegisterWebAuthn(resp, *c, skip)
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if string(reg.KeyHandle) != "credential id" || !reg.PubKey.Equal(&tc.key.PublicKey) || reg.AttestationCert != nil {
+			t.Errorf("%s: unexpected registration: %+v", format, reg)
+		}
+		if parsed, err := parseCompactRegistration(reg.Raw); err != nil || parsed.Fingerprint() != reg.Fingerprint() {
+			t.Errorf("%s: Raw is not the compact encoding: %v", format, err)
+		}
+	}
+
+	for name, modify := range map[string]func(tc *testCredential){
+		"wrong type":          func(tc *testCredential) { tc.typ = "webauthn.get" },
+		"wrong origin":        func(tc *testCredential) { tc.origin = "https://evil.example.com" },
+		"wrong rp id":         func(tc *testCredential) { tc.rpID = "evil.example.com" },
+		"user not present":    func(tc *testCredential) { tc.flags = 0 },
+		"long credential id":  func(tc *testCredential) { tc.kh = make([]byte, 256) },
+		"empty credential id": func(tc *testCredential) { tc.kh = nil },
+	} {
+		tc := newTestCredential(t)
+		modify(tc)
+		c, _ := NewChallenge("https://example.com", []string{"https://example.com"})
+		if _, err := RegisterWebAuthn(tc.create(c, "packed"), *c, skip); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	// The packed signature covers the client data.
+	tc := newTestCredential(t)
+	c, _ := NewChallenge("https://example.com", []string{"https://example.com"})
+	resp := tc.create(c, "packed")
+	resp.Response.ClientDataJSON = encodeBase64(append(tc.clientData("webauthn.create", c), ' '))
+	if _, err := RegisterWebAuthn(resp, *c, skip); err == nil {
+		t.Errorf("expected error for invalid self attestation")
+	}
+}
+
+func TestAuthenticateWebAuthn(t *testing.T) {
+	tc := newTestCredential(t)
+	c, _ := NewChallenge("https://example.com", []string{"https://example.com"})
+	reg, err := RegisterWebAuthn(tc.create(c, "none"), *c, &Config{SkipAttestationVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tc.counter = 7
+	c, _ = NewChallenge("https://example.com", []string{"https://example.com"})
+	counter, err := reg.AuthenticateWebAuthn(tc.get(c), *c, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counter != 7 {
+		t.Errorf("unexpected counter: %d", counter)
+	}
+	if _, err := reg.AuthenticateWebAuthn(tc.get(c), *c, 8); err != ErrCounterTooLow {
+		t.Errorf("expected ErrCounterTooLow, got %v", err)
+	}
+
+	// The rp id hash may be that of the AppID.
+	tc.rpID = c.AppID
+	if _, err := reg.AuthenticateWebAuthn(tc.get(c), *c, 0); err != nil {
+		t.Errorf("AppID as rp id: %v", err)
+	}
+
+	for name, modify := range map[string]func(tc *testCredential){
+		"wrong type":       func(tc *testCredential) { tc.typ = "webauthn.create" },
+		"wrong origin":     func(tc *testCredential) { tc.origin = "https://evil.example.com" },
+		"wrong rp id":      func(tc *testCredential) { tc.rpID = "evil.example.com" },
+		"user not present": func(tc *testCredential) { tc.flags = 0 },
+		"wrong key handle": func(tc *testCredential) { tc.kh = []byte("other") },
+	} {
+		bad := *tc
+		bad.rpID = "example.com"
+		modify(&bad)
+		if _, err := reg.AuthenticateWebAuthn(bad.get(c), *c, 0); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+
+	resp := tc.get(c)
+	resp.Response.Signature = tc.get(c).Response.Signature[:10]
+	if _, err := reg.AuthenticateWebAuthn(resp, *c, 0); err == nil {
+		t.Errorf("expected error for invalid signature")
+	}
+}
+
+func TestParseAuthenticatorData(t *testing.T) {
+	tc := newTestCredential(t)
+	data := tc.authData(true)
+	ad, err := parseAuthenticatorData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(ad.credentialID) != "credential id" || !ad.pubKey.Equal(&tc.key.PublicKey) {
+		t.Errorf("unexpected authenticator data: %+v", ad)
+	}
+
+	// Extensions follow the credential data.
+	ext, _ := cbor.Marshal(map[interface{}]interface{}{"credProtect": int64(1)})
+	withExt := append(append([]byte(nil), data...), ext...)
+	withExt[32] |= authDataExtensions
+	if _, err := parseAuthenticatorData(withExt); err != nil {
+		t.Errorf("extensions: %v", err)
+	}
+
+	for name, bad := range map[string][]byte{
+		"short":         data[:36],
+		"short key":     data[:len(data)-1],
+		"trailing data": append(append([]byte(nil), data...), 0),
+		"short cred id": data[:37+18+5],
+		"no extensions": append(append([]byte(nil), data[:32]...), append([]byte{data[32] | authDataExtensions}, data[33:]...)...),
+	} {
+		if _, err := parseAuthenticatorData(bad); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}